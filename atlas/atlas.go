@@ -0,0 +1,204 @@
+// Package atlas packs block textures into a single image.
+//
+// Packing is deterministic: the same set of textures always produces the
+// same image and the same rectangles, regardless of map iteration order.
+package atlas
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Rect is the area of one texture in the atlas, in texture coordinates.
+//
+// U0, V0 is the bottom-left corner of the texture (local UV 0,0) and DU, DV
+// the offset to its top-right corner (local UV 1,1). The atlas image is
+// uploaded top row first, so DV is negative.
+type Rect struct {
+	U0, V0, DU, DV float32
+}
+
+// Full is the rect of a texture that is not in an atlas.
+var Full = Rect{0, 0, 1, 1}
+
+// Atlas is a packed set of textures.
+type Atlas struct {
+	Image *image.RGBA
+	rects map[string]Rect
+	names []string
+}
+
+// Build packs the images into one atlas.
+//
+// Textures are placed on shelves, tallest first and then by name, in an atlas
+// whose sides are powers of two.
+func Build(images map[string]image.Image) (*Atlas, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("atlas: no textures")
+	}
+
+	names := make([]string, 0, len(images))
+	area, maxW := 0, 0
+	for name, img := range images {
+		names = append(names, name)
+		s := img.Bounds().Size()
+		area += s.X * s.Y
+		maxW = max(maxW, s.X)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		hi, hj := images[names[i]].Bounds().Dy(), images[names[j]].Bounds().Dy()
+		if hi != hj {
+			return hi > hj
+		}
+		return names[i] < names[j]
+	})
+
+	width := 1
+	for width < maxW || width*width < area {
+		width *= 2
+	}
+
+	// Shelf packing
+	pos := make(map[string]image.Point, len(names))
+	x, y, shelf := 0, 0, 0
+	for _, name := range names {
+		s := images[name].Bounds().Size()
+		if x+s.X > width {
+			x, y, shelf = 0, y+shelf, 0
+		}
+		pos[name] = image.Point{x, y}
+		x += s.X
+		shelf = max(shelf, s.Y)
+	}
+	height := 1
+	for height < y+shelf {
+		height *= 2
+	}
+
+	a := &Atlas{
+		Image: image.NewRGBA(image.Rect(0, 0, width, height)),
+		rects: make(map[string]Rect, len(names)),
+	}
+	for _, name := range names {
+		img := images[name]
+		b := img.Bounds()
+		p := pos[name]
+		draw.Draw(a.Image, image.Rectangle{p, p.Add(b.Size())}, img, b.Min, draw.Src)
+
+		a.rects[name] = Rect{
+			U0: float32(p.X) / float32(width),
+			V0: float32(p.Y+b.Dy()) / float32(height),
+			DU: float32(b.Dx()) / float32(width),
+			DV: -float32(b.Dy()) / float32(height),
+		}
+	}
+	a.names = append(a.names, names...)
+	sort.Strings(a.names)
+	return a, nil
+}
+
+// Load reads the named PNG textures from dir (name without the .png
+// extension) and packs them. With no names, every PNG in dir is packed.
+func Load(dir string, names ...string) (*Atlas, error) {
+	if len(names) == 0 {
+		files, err := filepath.Glob(filepath.Join(dir, "*.png"))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			names = append(names, strings.TrimSuffix(filepath.Base(f), ".png"))
+		}
+	}
+
+	images := make(map[string]image.Image, len(names))
+	for _, name := range names {
+		img, err := loadPNG(filepath.Join(dir, name+".png"))
+		if err != nil {
+			return nil, err
+		}
+		images[name] = img
+	}
+	return Build(images)
+}
+
+func loadPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return img, nil
+}
+
+// Rect returns the area of the named texture. Unknown names get ok=false.
+func (a *Atlas) Rect(name string) (Rect, bool) {
+	r, ok := a.rects[name]
+	return r, ok
+}
+
+// Tile returns the area of the named texture as U0, V0, DU, DV, or the
+// whole atlas for unknown names.
+func (a *Atlas) Tile(name string) [4]float32 {
+	r, ok := a.rects[name]
+	if !ok {
+		r = Full
+	}
+	return [4]float32{r.U0, r.V0, r.DU, r.DV}
+}
+
+// Average returns the mean colour of the named texture, or transparent black
+// for unknown names.
+func (a *Atlas) Average(name string) color.RGBA {
+	r, ok := a.rects[name]
+	if !ok {
+		return color.RGBA{}
+	}
+	size := a.Image.Bounds().Size()
+	x0 := int(r.U0*float32(size.X) + 0.5)
+	y1 := int(r.V0*float32(size.Y) + 0.5)
+	x1 := x0 + int(r.DU*float32(size.X)+0.5)
+	y0 := y1 + int(r.DV*float32(size.Y)-0.5)
+
+	var sum [4]int
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			c := a.Image.RGBAAt(x, y)
+			sum[0] += int(c.R)
+			sum[1] += int(c.G)
+			sum[2] += int(c.B)
+			sum[3] += int(c.A)
+		}
+	}
+	n := (x1 - x0) * (y1 - y0)
+	return color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), uint8(sum[3] / n)}
+}
+
+// Names returns the sorted names of the packed textures.
+func (a *Atlas) Names() []string {
+	return a.names
+}
+
+// SavePNG writes the atlas image to path, for inspection.
+func (a *Atlas) SavePNG(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, a.Image); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,142 @@
+package atlas
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solid(w, h int, c color.RGBA) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func testImages() map[string]image.Image {
+	return map[string]image.Image{
+		"a":     solid(16, 16, color.RGBA{255, 0, 0, 255}),
+		"b":     solid(16, 16, color.RGBA{0, 255, 0, 255}),
+		"big":   solid(32, 32, color.RGBA{0, 0, 255, 255}),
+		"wide":  solid(32, 8, color.RGBA{255, 255, 0, 255}),
+		"other": solid(16, 16, color.RGBA{0, 255, 255, 255}),
+	}
+}
+
+func TestBuildDeterministic(t *testing.T) {
+	first, err := Build(testImages())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		again, err := Build(testImages())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(first.Image.Pix, again.Image.Pix) {
+			t.Fatalf("atlas image differs between builds")
+		}
+		for _, name := range first.Names() {
+			r1, _ := first.Rect(name)
+			r2, _ := again.Rect(name)
+			if r1 != r2 {
+				t.Fatalf("rect of %q differs: %v vs %v", name, r1, r2)
+			}
+		}
+	}
+}
+
+func TestBuildLayout(t *testing.T) {
+	a, err := Build(testImages())
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := a.Image.Bounds().Size()
+	if size.X != 64 || size.Y != 64 {
+		t.Errorf("atlas size = %v, want 64x64", size)
+	}
+
+	// Tallest first, then by name
+	want := map[string]image.Rectangle{
+		"big":   image.Rect(0, 0, 32, 32),
+		"a":     image.Rect(32, 0, 48, 16),
+		"b":     image.Rect(48, 0, 64, 16),
+		"other": image.Rect(0, 32, 16, 48),
+		"wide":  image.Rect(16, 32, 48, 40),
+	}
+	for name, px := range want {
+		r, ok := a.Rect(name)
+		if !ok {
+			t.Fatalf("missing %q", name)
+		}
+		got := image.Rect(
+			int(r.U0*64), int((r.V0+r.DV)*64),
+			int((r.U0+r.DU)*64), int(r.V0*64),
+		)
+		if got != px {
+			t.Errorf("%s at %v, want %v", name, got, px)
+		}
+
+		// Every pixel of the tile comes from the source image
+		src := testImages()[name].At(0, 0)
+		for y := px.Min.Y; y < px.Max.Y; y++ {
+			for x := px.Min.X; x < px.Max.X; x++ {
+				if a.Image.At(x, y) != src {
+					t.Fatalf("%s: pixel %d,%d = %v, want %v", name, x, y, a.Image.At(x, y), src)
+				}
+			}
+		}
+	}
+}
+
+func TestTile(t *testing.T) {
+	a, err := Build(testImages())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Tile("a"); got != [4]float32{0.5, 0.25, 0.25, -0.25} {
+		t.Errorf("Tile(a) = %v", got)
+	}
+	if got := a.Tile("missing"); got != [4]float32{0, 0, 1, 1} {
+		t.Errorf("Tile(missing) = %v, want the full atlas", got)
+	}
+}
+
+func TestBuildEmpty(t *testing.T) {
+	if _, err := Build(nil); err == nil {
+		t.Errorf("expected error for empty atlas")
+	}
+}
+
+func TestLoadRepositoryTextures(t *testing.T) {
+	a, err := Load("../textures", "dirt", "grass_top", "grass_side", "rock", "sand", "water")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Names()) != 6 {
+		t.Errorf("names = %v", a.Names())
+	}
+	if _, err := Load("../textures", "does_not_exist"); err == nil {
+		t.Errorf("expected error for missing texture")
+	}
+}
+
+func TestAverage(t *testing.T) {
+	a, err := Build(testImages())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, img := range testImages() {
+		want := img.(*image.RGBA).RGBAAt(0, 0)
+		if got := a.Average(name); got != want {
+			t.Errorf("Average(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if got := a.Average("missing"); got != (color.RGBA{}) {
+		t.Errorf("Average of unknown texture = %v, want transparent", got)
+	}
+}
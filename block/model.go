@@ -0,0 +1,509 @@
+package block
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Side is one of the six sides of a block, in the order of Faces.list.
+type Side int
+
+const (
+	Top    Side = iota
+	Bottom      // -Y
+	North       // -Z
+	South       // +Z
+	East        // +X
+	West        // -X
+)
+
+// Sides lists every side.
+var Sides = []Side{Top, Bottom, North, South, East, West}
+
+var sideNames = [...]string{"top", "bottom", "north", "south", "east", "west"}
+
+var sideNormals = [...][3]int{
+	Top:    {0, 1, 0},
+	Bottom: {0, -1, 0},
+	North:  {0, 0, -1},
+	South:  {0, 0, 1},
+	East:   {1, 0, 0},
+	West:   {-1, 0, 0},
+}
+
+func (s Side) String() string {
+	return sideNames[s]
+}
+
+// Normal returns the direction the side points to.
+func (s Side) Normal() [3]int {
+	return sideNormals[s]
+}
+
+// Opposite returns the side pointing the other way.
+func (s Side) Opposite() Side {
+	return s ^ 1
+}
+
+// axis returns the axis of the side's normal: 0 for X, 1 for Y, 2 for Z.
+func (s Side) axis() int {
+	n := s.Normal()
+	if n[0] != 0 {
+		return 0
+	} else if n[1] != 0 {
+		return 1
+	}
+	return 2
+}
+
+// positive reports whether the side faces towards +X, +Y or +Z.
+func (s Side) positive() bool {
+	n := s.Normal()
+	return n[0]+n[1]+n[2] > 0
+}
+
+// turn returns the side after quarter turns around the vertical axis, the
+// same way Rotate turns facing properties. Top and bottom stay.
+func (s Side) turn(turns int) Side {
+	n := s.Normal()
+	for i := 0; i < turns&3; i++ {
+		n[0], n[2] = -n[2], n[0]
+	}
+	for _, t := range Sides {
+		if sideNormals[t] == n {
+			return t
+		}
+	}
+	return s
+}
+
+// sideNamed returns the side with the given name.
+func sideNamed(name string) (Side, bool) {
+	for _, s := range Sides {
+		if sideNames[s] == name {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// otherAxes returns the two axes other than the normal of a side, in X, Y,
+// Z order. Areas on the side are measured along them.
+func otherAxes(s Side) (u, v int) {
+	switch s.axis() {
+	case 0:
+		return 1, 2
+	case 1:
+		return 0, 2
+	}
+	return 0, 1
+}
+
+// Model is the shape of a block, in the spirit of Minecraft block models:
+// a list of cuboid elements measured in sixteenths of a block from its
+// lowest corner. Models are named in the "models" section of blocks.json
+// and used by blocks, variants and parts.
+type Model struct {
+	// Type is "cross" for two crossed quads showing the side texture, as
+	// used by plants, "liquid" for a cube whose top sinks to Height unless
+	// the same liquid is above, or empty for a list of elements
+	Type     string    `json:"type"`
+	Elements []Element `json:"elements"`
+	Height   float32   `json:"height"` // Of liquids, 1 to 16
+
+	// Boxes that stop movement and that the cursor can point at, as from X,
+	// Y, Z and to X, Y, Z. Nil uses the elements, or a full block for cross
+	// and liquid models (cross models do not stop movement); an empty list
+	// has none.
+	Collision [][6]float32 `json:"collision"`
+	Selection [][6]float32 `json:"selection"`
+}
+
+// Model types.
+const (
+	ModelCross  = "cross"
+	ModelLiquid = "liquid"
+)
+
+// Element is one cuboid of a model.
+type Element struct {
+	From  [3]float32              `json:"from"`
+	To    [3]float32              `json:"to"`
+	Faces map[string]*ElementFace `json:"faces"` // By side name (top, north...), nil to draw all six
+}
+
+// ElementFace is a drawn face of an element.
+type ElementFace struct {
+	// Texture is a texture name, or # and a face of the block's textures
+	// such as "#top" or "#side". Empty uses the block's texture on the side
+	// the face points to once the model is rotated.
+	Texture string `json:"texture"`
+
+	// UV is the part of the texture shown, as U0, V0, U1, V1 in sixteenths.
+	// Nil shows the part a full block would show there, so textures line
+	// up across neighbouring blocks however the model is rotated.
+	UV *[4]float32 `json:"uv"`
+}
+
+// Part adds a model to the states whose properties match When, on top of
+// the block's own model. Fences and panes use parts for the sides they
+// connect on.
+type Part struct {
+	When    map[string]string `json:"when"`
+	Model   string            `json:"model"`
+	RotateY int               `json:"rotate_y"` // Degrees, a multiple of 90
+}
+
+// Shape is the resolved model of a block state. Sizes are in blocks from
+// the block's lowest corner.
+type Shape struct {
+	Cube    bool     // A full cube of the state's textures, which meshers may merge
+	Cuboids []Cuboid // What to draw when Cube is false
+	Cross   string   // Texture of two crossed quads, "" for none
+	Liquid  float32  // Surface height of liquids, see Model.Height, 0 for other shapes
+
+	Collision []Box // None for states that are not solid
+	Selection []Box
+
+	sides [6]coverage // What the shape fills of each side, by Side
+}
+
+// Cuboid is a box of a shape with its faces.
+type Cuboid struct {
+	From, To [3]float32
+	Faces    [6]*CuboidFace // By Side, nil for faces not drawn
+}
+
+// CuboidFace is a face of a cuboid.
+type CuboidFace struct {
+	Texture string
+	UV      *[4]float32 // U0, V0, U1, V1 from 0 to 1, nil to follow the face's position
+
+	// Cull is set for faces on the side of the block, which neighbours may
+	// hide; Area is the part of the side the face covers.
+	Cull bool
+	Area Area
+}
+
+// Box is an axis-aligned box, such as a collision box.
+type Box struct {
+	Min, Max [3]float32
+}
+
+// Area is a rectangle on a side of a block, in sixteenths along the other
+// two axes in X, Y, Z order: Y and Z on east and west sides, X and Z on top
+// and bottom, X and Y on north and south.
+type Area struct {
+	U0, V0, U1, V1 int
+}
+
+// FullArea covers a whole side.
+var FullArea = Area{0, 0, 16, 16}
+
+// coverage is a 16×16 grid over a side of a block: bit u of row v is set
+// when the shape fills that sixteenth.
+type coverage [16]uint16
+
+var fullCoverage = coverage{
+	0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff,
+	0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff, 0xffff,
+}
+
+func (a Area) bits() uint16 {
+	return uint16((1<<a.U1 - 1) &^ (1<<a.U0 - 1))
+}
+
+func (c *coverage) fill(a Area) {
+	for v := a.V0; v < a.V1; v++ {
+		c[v] |= a.bits()
+	}
+}
+
+func (c *coverage) covers(a Area) bool {
+	bits := a.bits()
+	for v := a.V0; v < a.V1; v++ {
+		if c[v]&bits != bits {
+			return false
+		}
+	}
+	return true
+}
+
+// cubeShape returns the shape of a full cube.
+func cubeShape(solid bool) *Shape {
+	s := &Shape{Cube: true, Selection: []Box{{Max: [3]float32{1, 1, 1}}}}
+	if solid {
+		s.Collision = s.Selection
+	}
+	for i := range s.sides {
+		s.sides[i] = fullCoverage
+	}
+	return s
+}
+
+// checkModel reports errors in a model definition.
+func checkModel(name string, m *Model) error {
+	if m.Type != "" && m.Type != ModelCross && m.Type != ModelLiquid {
+		return fmt.Errorf("model %q: unknown type %q", name, m.Type)
+	}
+	if m.Type == ModelLiquid && (m.Height < 1 || m.Height > 16) {
+		return fmt.Errorf("model %q: liquid height must be 1 to 16, got %g", name, m.Height)
+	}
+	if m.Type == "" && len(m.Elements) == 0 {
+		return fmt.Errorf("model %q: no elements", name)
+	}
+	for i, e := range m.Elements {
+		for k := 0; k < 3; k++ {
+			if e.From[k] > e.To[k] || e.From[k] < -16 || e.To[k] > 32 {
+				return fmt.Errorf("model %q: element %d must have from <= to within -16 to 32", name, i)
+			}
+		}
+		for side, f := range e.Faces {
+			if _, ok := sideNamed(side); !ok || f == nil {
+				return fmt.Errorf("model %q: element %d has a bad face %q", name, i, side)
+			}
+			if len(f.Texture) > 1 && f.Texture[0] == '#' && (&Faces{}).named(f.Texture[1:]) == nil {
+				return fmt.Errorf("model %q: element %d uses unknown texture %q", name, i, f.Texture)
+			}
+		}
+	}
+	for _, box := range append(m.Collision, m.Selection...) {
+		if box[0] > box[3] || box[1] > box[4] || box[2] > box[5] {
+			return fmt.Errorf("model %q: box %v must have from <= to", name, box)
+		}
+	}
+	return nil
+}
+
+// checkRotation reports errors in a rotation in degrees, and returns it in
+// quarter turns.
+func checkRotation(degrees int) (turns int, err error) {
+	if degrees%90 != 0 {
+		return 0, fmt.Errorf("rotate_y must be a multiple of 90, got %d", degrees)
+	}
+	return (degrees / 90) & 3, nil
+}
+
+// placedModel is a model with its rotation, as used by one state.
+type placedModel struct {
+	model *Model
+	turns int
+}
+
+// buildShape resolves the models of a state with the state's textures.
+func buildShape(models []placedModel, textures *Faces, solid bool) *Shape {
+	if len(models) == 0 {
+		return cubeShape(solid)
+	}
+	s := &Shape{}
+	var collision, selection []Box
+	for _, pm := range models {
+		m := pm.model
+		switch m.Type {
+		case ModelCross:
+			s.Cross = textures.Side
+		case ModelLiquid:
+			// Drawn by the mesher, which knows what is above
+			s.Liquid = m.Height / 16
+			s.cover(Box{Max: [3]float32{1, 1, 1}})
+		}
+		var elements []Box
+		for _, e := range m.Elements {
+			box := turnBox(sixteenths(e.From, e.To), pm.turns)
+			elements = append(elements, box)
+			s.Cuboids = append(s.Cuboids, buildCuboid(&e, box, pm.turns, textures))
+			s.cover(box)
+		}
+		if m.Type != "" {
+			elements = []Box{{Max: [3]float32{1, 1, 1}}}
+		}
+		collision = append(collision, boxes(m.Collision, elements, m.Type != ModelCross, pm.turns)...)
+		selection = append(selection, boxes(m.Selection, elements, true, pm.turns)...)
+	}
+	if solid {
+		s.Collision = collision
+	}
+	s.Selection = selection
+	return s
+}
+
+// boxes returns the boxes of a model, or its element boxes if it lists
+// none and fallback is set.
+func boxes(listed [][6]float32, elements []Box, fallback bool, turns int) []Box {
+	if listed == nil {
+		if fallback {
+			return elements
+		}
+		return nil
+	}
+	list := make([]Box, len(listed))
+	for i, b := range listed {
+		list[i] = turnBox(sixteenths([3]float32{b[0], b[1], b[2]}, [3]float32{b[3], b[4], b[5]}), turns)
+	}
+	return list
+}
+
+func sixteenths(from, to [3]float32) Box {
+	var b Box
+	for k := 0; k < 3; k++ {
+		b.Min[k], b.Max[k] = from[k]/16, to[k]/16
+	}
+	return b
+}
+
+// turnBox turns a box by quarter turns around the vertical axis through the
+// centre of the block.
+func turnBox(b Box, turns int) Box {
+	for i := 0; i < turns&3; i++ {
+		// (x, z) -> (-z, x) around the centre
+		b.Min[0], b.Max[0], b.Min[2], b.Max[2] = 1-b.Max[2], 1-b.Min[2], b.Min[0], b.Max[0]
+	}
+	return b
+}
+
+// buildCuboid resolves the faces of an element placed as box.
+func buildCuboid(e *Element, box Box, turns int, textures *Faces) Cuboid {
+	c := Cuboid{From: box.Min, To: box.Max}
+	for _, side := range Sides {
+		face := &ElementFace{}
+		if e.Faces != nil {
+			if face = e.Faces[sideNames[side]]; face == nil {
+				continue
+			}
+		}
+		to := side.turn(turns)
+		f := &CuboidFace{Texture: face.Texture}
+		switch {
+		case f.Texture == "":
+			f.Texture = *textures.list()[to]
+		case f.Texture[0] == '#':
+			f.Texture = *textures.named(f.Texture[1:])
+		}
+		if face.UV != nil {
+			uv := *face.UV
+			for i := range uv {
+				uv[i] /= 16
+			}
+			f.UV = &uv
+		}
+		k := to.axis()
+		if to.positive() && box.Max[k] == 1 || !to.positive() && box.Min[k] == 0 {
+			f.Cull = true
+			f.Area = outerArea(box, to)
+		}
+		c.Faces[to] = f
+	}
+	return c
+}
+
+// cover marks the sides of the block that a box reaches.
+func (s *Shape) cover(box Box) {
+	for _, side := range Sides {
+		k := side.axis()
+		if side.positive() && box.Max[k] >= 1 || !side.positive() && box.Min[k] <= 0 {
+			s.sides[side].fill(innerArea(box, side))
+		}
+	}
+}
+
+// outerArea returns the sixteenths of a side that a face of box touches.
+func outerArea(box Box, side Side) Area {
+	u, v := otherAxes(side)
+	return Area{
+		clampSixteenth(math.Floor(float64(box.Min[u]) * 16)),
+		clampSixteenth(math.Floor(float64(box.Min[v]) * 16)),
+		clampSixteenth(math.Ceil(float64(box.Max[u]) * 16)),
+		clampSixteenth(math.Ceil(float64(box.Max[v]) * 16)),
+	}
+}
+
+// innerArea returns the sixteenths of a side that a face of box fills
+// completely.
+func innerArea(box Box, side Side) Area {
+	u, v := otherAxes(side)
+	a := Area{
+		clampSixteenth(math.Ceil(float64(box.Min[u]) * 16)),
+		clampSixteenth(math.Ceil(float64(box.Min[v]) * 16)),
+		clampSixteenth(math.Floor(float64(box.Max[u]) * 16)),
+		clampSixteenth(math.Floor(float64(box.Max[v]) * 16)),
+	}
+	if a.U1 < a.U0 || a.V1 < a.V0 {
+		return Area{}
+	}
+	return a
+}
+
+func clampSixteenth(v float64) int {
+	return int(math.Max(0, math.Min(16, v)))
+}
+
+// ShapeOf returns the shape of a state of the block.
+func (b *Block) ShapeOf(state int) *Shape {
+	return b.state(state).shape
+}
+
+// Shape returns the shape of a state, or nil for air and unknown blocks.
+func (r *Registry) Shape(state int) *Shape {
+	b := r.Get(state)
+	if b == nil {
+		return nil
+	}
+	return b.ShapeOf(state)
+}
+
+// Surface returns the height of the top of a liquid state in blocks: the
+// model's height for sources and falling liquid, lower the farther it
+// flowed. It is 0 for states that are not liquids.
+func (r *Registry) Surface(state int) float32 {
+	s := r.Shape(state)
+	if s == nil || s.Liquid == 0 {
+		return 0
+	}
+	b := r.Get(state)
+	level, flowing := b.Level(state), b.Levels()-1
+	if level == 0 || level == flowing {
+		return s.Liquid
+	}
+	return s.Liquid * float32(flowing-level) / float32(flowing)
+}
+
+// Hides reports whether a neighbour state, next to a block state on the
+// given side of it, hides area of that side. Opaque neighbours hide where
+// their facing side is filled. Transparent ones hide nothing, except that
+// translucent blocks hide the same block, so there are no faces inside a
+// body of water or between panes of glass.
+func (r *Registry) Hides(state, neighbour int, side Side, area Area) bool {
+	b := r.Get(neighbour)
+	if b == nil {
+		return false
+	}
+	s := b.state(neighbour)
+	if s.transparent && !(b.Translucent && TypeOf(state) == b.ID) {
+		return false
+	}
+	return s.shape.sides[side.Opposite()].covers(area)
+}
+
+// Connect returns a state with its connect properties set from the blocks
+// around it; at returns the state next to the block on a side. A side
+// connects to blocks of the same Connects group, and to blocks whose facing
+// side is full.
+func (r *Registry) Connect(state int, at func(Side) int) int {
+	b := r.Get(state)
+	if b == nil {
+		return state
+	}
+	for _, p := range b.Properties {
+		if p.Kind != KindConnect {
+			continue
+		}
+		side, _ := sideNamed(p.Name)
+		n := at(side)
+		nb := r.Get(n)
+		connected := nb != nil && (b.Connects != "" && nb.Connects == b.Connects ||
+			nb.state(n).shape.sides[side.Opposite()] == fullCoverage)
+		state, _ = b.With(state, p.Name, strconv.FormatBool(connected))
+	}
+	return state
+}
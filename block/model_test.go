@@ -0,0 +1,262 @@
+package block
+
+import (
+	"slices"
+	"testing"
+)
+
+const modelDefs = `{"blocks": [
+	{"id": 1, "name": "stone", "textures": {"all": "stone"}, "solid": true},
+	{"id": 2, "name": "slab", "textures": {"all": "planks"}, "solid": true, "model": "slab",
+	 "properties": [{"name": "half", "values": ["bottom", "top"], "kind": "half"}],
+	 "variants": [{"when": {"half": "top"}, "model": "slab_top"}]},
+	{"id": 3, "name": "stairs", "textures": {"all": "planks"}, "solid": true, "model": "stairs",
+	 "properties": [{"name": "facing", "values": ["north", "east", "south", "west"], "kind": "facing"}],
+	 "variants": [{"when": {"facing": "east"}, "rotate_y": 90}, {"when": {"facing": "south"}, "rotate_y": 180}]},
+	{"id": 4, "name": "fence", "textures": {"all": "planks"}, "solid": true, "model": "post", "connects": "fence",
+	 "properties": [
+		{"name": "north", "values": ["false", "true"], "kind": "connect"},
+		{"name": "east", "values": ["false", "true"], "kind": "connect"}
+	 ],
+	 "parts": [
+		{"when": {"north": "true"}, "model": "arm"},
+		{"when": {"east": "true"}, "model": "arm", "rotate_y": 90}
+	 ]},
+	{"id": 5, "name": "flower", "textures": {"all": "flower"}, "transparent": true, "model": "plant"},
+	{"id": 6, "name": "glass", "textures": {"all": "glass"}, "solid": true, "transparent": true}
+], "models": {
+	"slab": {"elements": [{"from": [0, 0, 0], "to": [16, 8, 16]}]},
+	"slab_top": {"elements": [{"from": [0, 8, 0], "to": [16, 16, 16]}]},
+	"stairs": {"elements": [
+		{"from": [0, 0, 0], "to": [16, 8, 16]},
+		{"from": [0, 8, 0], "to": [16, 16, 8], "faces": {"top": {}, "north": {"texture": "#top"}, "south": {"texture": "trim", "uv": [0, 0, 16, 8]}}}
+	]},
+	"post": {"elements": [{"from": [6, 0, 6], "to": [10, 16, 10]}], "collision": [[6, 0, 6, 10, 24, 10]]},
+	"arm": {"elements": [{"from": [7, 6, 0], "to": [9, 15, 6]}]},
+	"plant": {"type": "cross", "selection": [[2, 0, 2, 14, 12, 14]]}
+}}`
+
+func parseModels(t *testing.T) *Registry {
+	t.Helper()
+	r, err := Parse([]byte(modelDefs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestCubeShape(t *testing.T) {
+	r := parseModels(t)
+	s := r.Shape(1)
+	if !s.Cube || len(s.Cuboids) != 0 || len(s.Collision) != 1 || s.Collision[0] != (Box{Max: [3]float32{1, 1, 1}}) {
+		t.Errorf("stone shape = %+v", s)
+	}
+	if r.Shape(0) != nil {
+		t.Errorf("air has a shape")
+	}
+	for _, side := range Sides {
+		if !r.Hides(1, 1, side, FullArea) {
+			t.Errorf("stone does not hide the %s side", side)
+		}
+		if r.Hides(1, 6, side, FullArea) || r.Hides(1, 0, side, FullArea) {
+			t.Errorf("glass or air hides the %s side", side)
+		}
+	}
+}
+
+func TestSlabShape(t *testing.T) {
+	r := parseModels(t)
+	slab := r.ByName("slab")
+	s := r.Shape(slab.Default())
+	if s.Cube || len(s.Cuboids) != 1 || s.Cuboids[0].To != [3]float32{1, 0.5, 1} {
+		t.Fatalf("slab shape = %+v", s)
+	}
+	c := s.Cuboids[0]
+	if top := c.Faces[Top]; top == nil || top.Cull || top.Texture != "planks" {
+		t.Errorf("slab top face = %+v, want drawn and never culled", top)
+	}
+	if east := c.Faces[East]; !east.Cull || east.Area != (Area{0, 0, 8, 16}) {
+		t.Errorf("slab east face = %+v, want the lower half of the side", east)
+	}
+
+	// Above a slab the neighbour below does not hide the whole side, but
+	// below it and beside it the filled parts are hidden
+	if r.Hides(1, slab.Default(), Bottom, FullArea) || !r.Hides(1, slab.Default(), Top, FullArea) {
+		t.Errorf("slab hides the wrong vertical sides")
+	}
+	if r.Hides(1, slab.Default(), East, FullArea) || !r.Hides(1, slab.Default(), East, Area{0, 4, 8, 12}) {
+		t.Errorf("slab hides the wrong part of its side")
+	}
+	top, _ := slab.With(slab.Default(), "half", "top")
+	if !r.Hides(1, top, Bottom, FullArea) || r.Hides(1, top, Top, FullArea) {
+		t.Errorf("top slab hides the wrong vertical sides")
+	}
+}
+
+func TestRotatedModel(t *testing.T) {
+	r := parseModels(t)
+	stairs := r.ByName("stairs")
+	north := r.Shape(stairs.Default())
+	step := north.Cuboids[1]
+	if step.From != [3]float32{0, 0.5, 0} || step.To != [3]float32{1, 1, 0.5} {
+		t.Errorf("north stairs step = %v to %v", step.From, step.To)
+	}
+	if step.Faces[Bottom] != nil || step.Faces[North].Texture != "planks" || !step.Faces[North].Cull {
+		t.Errorf("north stairs step faces = %+v", step.Faces)
+	}
+	if f := step.Faces[South]; f.Texture != "trim" || f.Cull || *f.UV != [4]float32{0, 0, 1, 0.5} {
+		t.Errorf("north stairs inner face = %+v", f)
+	}
+
+	// Turned to the east the step moves to +X with its faces
+	east, _ := stairs.With(stairs.Default(), "facing", "east")
+	step = r.Shape(east).Cuboids[1]
+	if step.From != [3]float32{0.5, 0.5, 0} || step.To != [3]float32{1, 1, 1} {
+		t.Errorf("east stairs step = %v to %v", step.From, step.To)
+	}
+	if step.Faces[North] != nil || step.Faces[East] == nil || step.Faces[West].Texture != "trim" {
+		t.Errorf("east stairs step faces = %+v", step.Faces)
+	}
+	if !r.Hides(1, east, West, FullArea) || r.Hides(1, east, East, FullArea) {
+		t.Errorf("east stairs should fill their east side only")
+	}
+}
+
+func TestCollisionAndSelection(t *testing.T) {
+	r := parseModels(t)
+	fence := r.Shape(r.ID("fence"))
+	if len(fence.Collision) != 1 || fence.Collision[0].Max[1] != 1.5 {
+		t.Errorf("fence collision = %v, want one box 1.5 high", fence.Collision)
+	}
+	if len(fence.Selection) != 1 || fence.Selection[0].Max[1] != 1 {
+		t.Errorf("fence selection = %v, want its post", fence.Selection)
+	}
+
+	flower := r.Shape(r.ID("flower"))
+	if flower.Cross != "flower" || len(flower.Cuboids) != 0 || flower.Collision != nil {
+		t.Errorf("flower shape = %+v", flower)
+	}
+	if want := (Box{[3]float32{0.125, 0, 0.125}, [3]float32{0.875, 0.75, 0.875}}); len(flower.Selection) != 1 || flower.Selection[0] != want {
+		t.Errorf("flower selection = %v, want %v", flower.Selection, want)
+	}
+	if got := r.Textures(); !slices.Contains(got, "trim") || !slices.Contains(got, "flower") {
+		t.Errorf("Textures = %v, want the ones models use", got)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	r := parseModels(t)
+	fence := r.ByName("fence")
+	slab := r.ID("slab")
+	connected := func(around map[Side]int) (north, east string) {
+		s := r.Connect(fence.Default(), func(side Side) int { return around[side] })
+		return fence.Value(s, "north"), fence.Value(s, "east")
+	}
+	if n, e := connected(map[Side]int{North: fence.ID, East: 1}); n != "true" || e != "true" {
+		t.Errorf("fence next to a fence and stone: north %s, east %s", n, e)
+	}
+	if n, e := connected(map[Side]int{North: slab, South: 1}); n != "false" || e != "false" {
+		t.Errorf("fence next to a slab: north %s, east %s", n, e)
+	}
+
+	s := r.Connect(fence.Default(), func(side Side) int { return fence.ID })
+	if shape := r.Shape(s); len(shape.Cuboids) != 3 || shape.Cuboids[2].From != [3]float32{1 - 6.0/16, 6.0 / 16, 7.0 / 16} {
+		t.Errorf("connected fence cuboids = %+v", shape.Cuboids)
+	}
+	north, _ := fence.With(fence.Default(), "north", "true")
+	if got := fence.Rotate(north, 1); fence.Value(got, "east") != "true" || fence.Value(got, "north") != "false" {
+		t.Errorf("fence turned a quarter: %s", r.StateName(got))
+	}
+}
+
+func TestPlacedHalf(t *testing.T) {
+	slab := parseModels(t).ByName("slab")
+	for _, c := range []struct {
+		normal [3]int
+		hit    [3]float32
+		half   string
+	}{
+		{[3]int{0, 1, 0}, [3]float32{0.5, 0, 0.5}, "bottom"},
+		{[3]int{0, -1, 0}, [3]float32{0.5, 1, 0.5}, "top"},
+		{[3]int{1, 0, 0}, [3]float32{0, 0.7, 0.5}, "top"},
+		{[3]int{0, 0, -1}, [3]float32{0.5, 0.2, 1}, "bottom"},
+	} {
+		if got := slab.Value(slab.Placed(c.normal, [3]float32{}, c.hit), "half"); got != c.half {
+			t.Errorf("slab placed on %v at %v: %s, want %s", c.normal, c.hit, got, c.half)
+		}
+	}
+}
+
+func TestModelErrors(t *testing.T) {
+	parse := func(block, models string) error {
+		if block != "" {
+			block = ", " + block
+		}
+		_, err := Parse([]byte(`{"blocks": [{"id": 1, "name": "a", "textures": {"all": "a"}` + block + `}], "models": {` + models + `}}`))
+		return err
+	}
+	cube := `"cube": {"elements": [{"from": [0, 0, 0], "to": [16, 16, 16]}]}`
+	cases := map[string][2]string{
+		"unknown model":      {`"model": "sphere"`, cube},
+		"bad rotation":       {`"model": "cube", "rotate_y": 45`, cube},
+		"variant model":      {`"properties": [{"name": "p", "values": ["a"]}], "variants": [{"when": {"p": "a"}, "model": "sphere"}]`, cube},
+		"part without model": {`"properties": [{"name": "p", "values": ["a"]}], "parts": [{"when": {"p": "a"}}]`, cube},
+		"part value":         {`"properties": [{"name": "p", "values": ["a"]}], "parts": [{"when": {"p": "b"}, "model": "cube"}]`, cube},
+		"connect name":       {`"properties": [{"name": "up", "values": ["false", "true"], "kind": "connect"}]`, cube},
+		"connect value":      {`"properties": [{"name": "north", "values": ["no", "yes"], "kind": "connect"}]`, cube},
+		"half value":         {`"properties": [{"name": "half", "values": ["lower"], "kind": "half"}]`, cube},
+		"model type":         {``, `"m": {"type": "sphere"}`},
+		"no elements":        {``, `"m": {}`},
+		"inverted element":   {``, `"m": {"elements": [{"from": [8, 0, 0], "to": [0, 16, 16]}]}`},
+		"huge element":       {``, `"m": {"elements": [{"from": [0, 0, 0], "to": [40, 16, 16]}]}`},
+		"bad face":           {``, `"m": {"elements": [{"from": [0, 0, 0], "to": [16, 16, 16], "faces": {"up": {}}}]}`},
+		"bad texture":        {``, `"m": {"elements": [{"from": [0, 0, 0], "to": [16, 16, 16], "faces": {"top": {"texture": "#all"}}}]}`},
+		"inverted box":       {``, `"m": {"type": "cross", "collision": [[0, 16, 0, 16, 0, 16]]}`},
+		"liquid height":      {``, `"m": {"type": "liquid", "height": 0}`},
+		"opaque translucent": {`"translucent": true`, cube},
+	}
+	for name, c := range cases {
+		if err := parse(c[0], c[1]); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := parse(`"model": "cube", "rotate_y": -90`, cube); err != nil {
+		t.Errorf("valid model: %v", err)
+	}
+}
+
+func TestTranslucent(t *testing.T) {
+	r, err := Parse([]byte(`{"blocks": [
+		{"id": 1, "name": "stone", "textures": {"all": "stone"}, "solid": true},
+		{"id": 2, "name": "water", "textures": {"all": "water"}, "transparent": true, "translucent": true, "model": "water"},
+		{"id": 3, "name": "glass", "textures": {"all": "glass"}, "solid": true, "transparent": true, "translucent": true},
+		{"id": 4, "name": "leaves", "textures": {"all": "leaves"}, "solid": true, "transparent": true}
+	], "models": {"water": {"type": "liquid", "height": 14}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	water := r.Shape(2)
+	if water.Cube || water.Liquid != 0.875 || len(water.Selection) != 1 || water.Collision != nil {
+		t.Errorf("water shape = %+v", water)
+	}
+	if !r.IsTranslucent(2) || r.IsTranslucent(4) || r.IsTranslucent(0) {
+		t.Errorf("IsTranslucent is wrong")
+	}
+	if !r.IsLiquid(2) || r.IsLiquid(3) || r.IsLiquid(0) {
+		t.Errorf("IsLiquid is wrong")
+	}
+
+	// Translucent blocks hide the same block only; other transparent
+	// blocks hide nothing
+	for _, c := range []struct {
+		state, neighbour int
+		hides            bool
+	}{
+		{2, 2, true}, {3, 3, true}, {4, 4, false},
+		{1, 2, false}, {2, 3, false}, {3, 2, false}, {2, 1, true},
+	} {
+		if got := r.Hides(c.state, c.neighbour, East, FullArea); got != c.hides {
+			t.Errorf("Hides(%s next to %s) = %v, want %v", r.StateName(c.state), r.StateName(c.neighbour), got, c.hides)
+		}
+	}
+}
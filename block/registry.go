@@ -0,0 +1,341 @@
+// Package block holds the data-driven definitions of every block type.
+//
+// Block types are described in a JSON file (see blocks.json at the
+// repository root) so new blocks can be added without touching Go code.
+// The same file names the models that give blocks other than full cubes
+// their shape, see model.go.
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"craft3d/world"
+)
+
+// Faces names the texture used on each side of a block. North is -Z, south
+// +Z, east +X and west -X.
+type Faces struct {
+	All    string `json:"all"` // Shorthand, fills top, bottom and side if empty
+	Top    string `json:"top"`
+	Bottom string `json:"bottom"`
+	Side   string `json:"side"` // Shorthand, fills the four sides if empty
+	North  string `json:"north"`
+	South  string `json:"south"`
+	East   string `json:"east"`
+	West   string `json:"west"`
+}
+
+// fill applies the All and Side shorthands.
+func (f *Faces) fill() {
+	for _, face := range []*string{&f.Top, &f.Bottom, &f.Side} {
+		if *face == "" {
+			*face = f.All
+		}
+	}
+	for _, face := range []*string{&f.North, &f.South, &f.East, &f.West} {
+		if *face == "" {
+			*face = f.Side
+		}
+	}
+}
+
+// list returns the six faces: top, bottom, north, south, east, west.
+func (f *Faces) list() []*string {
+	return []*string{&f.Top, &f.Bottom, &f.North, &f.South, &f.East, &f.West}
+}
+
+// named returns the face with the given JSON name, except "all", or nil.
+func (f *Faces) named(name string) *string {
+	switch name {
+	case "top":
+		return &f.Top
+	case "bottom":
+		return &f.Bottom
+	case "side":
+		return &f.Side
+	case "north":
+		return &f.North
+	case "south":
+		return &f.South
+	case "east":
+		return &f.East
+	case "west":
+		return &f.West
+	}
+	return nil
+}
+
+// override replaces the faces that o names.
+func (f *Faces) override(o *Faces) {
+	for i, face := range o.list() {
+		if *face != "" {
+			*f.list()[i] = *face
+		}
+	}
+}
+
+// Block describes one block type.
+type Block struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Textures    Faces      `json:"textures"`
+	Tint        mgl32.Vec4 `json:"tint"`
+	Solid       bool       `json:"solid"`
+	Transparent bool       `json:"transparent"`
+	Translucent bool       `json:"translucent"` // Blended after opaque blocks, such as water; must be transparent
+	Hardness    float32    `json:"hardness"`
+	Icon        string     `json:"icon"` // Hotbar texture, empty to hide from the hotbar
+	Ore         *Ore       `json:"ore"`  // Nil unless the world generator places veins of it
+
+	// Properties and variants of the block's states, see state.go
+	Properties []Property `json:"properties"`
+	Variants   []Variant  `json:"variants"`
+
+	// Shape of the block, see model.go. Without a model the block is a
+	// full cube.
+	Model    string `json:"model"`
+	RotateY  int    `json:"rotate_y"` // Degrees, a multiple of 90
+	Parts    []Part `json:"parts"`
+	Connects string `json:"connects"` // Connection group of connect properties, such as "fence"
+
+	states []stateInfo // By state index
+	levels *Property   // Property of kind level, nil if none
+}
+
+// Ore says where the world generator places veins of a block in rock.
+type Ore struct {
+	MinY  int     `json:"min_y"` // Lowest vein start
+	MaxY  int     `json:"max_y"` // Highest vein start
+	Size  int     `json:"size"`  // Blocks per vein, 1 to world.ChunkSize
+	Veins float64 `json:"veins"` // Average number of veins per 16x16x16 chunk in the height range
+}
+
+// Registry is the set of known block types, indexed by ID.
+type Registry struct {
+	blocks []*Block // Index is the block ID, nil for unused IDs (0 is air)
+	byName map[string]*Block
+	tints  map[string]string // Texture name -> biome tint kind
+	models map[string]*Model
+}
+
+type file struct {
+	Blocks []*Block `json:"blocks"`
+
+	// Textures coloured by the biome they are in, mapped to the kind of
+	// tint ("grass" or "water")
+	TintedTextures map[string]string `json:"tinted_textures"`
+
+	Models map[string]*Model `json:"models"`
+}
+
+// Load reads a registry from a JSON definition file.
+func Load(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Parse builds a registry from JSON definitions.
+func Parse(data []byte) (*Registry, error) {
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	r := &Registry{
+		byName: make(map[string]*Block),
+		tints:  f.TintedTextures,
+		models: f.Models,
+	}
+	for name, m := range f.Models {
+		if err := checkModel(name, m); err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range f.Blocks {
+		if err := r.add(b); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *Registry) add(b *Block) error {
+	if b.ID <= 0 || b.ID > MaxID {
+		return fmt.Errorf("block %q: id must be 1 to %d, got %d", b.Name, MaxID, b.ID)
+	}
+	if b.Name == "" {
+		return fmt.Errorf("block %d: missing name", b.ID)
+	}
+	if r.Get(b.ID) != nil {
+		return fmt.Errorf("block %q: id %d already used by %q", b.Name, b.ID, r.Get(b.ID).Name)
+	}
+	if r.byName[b.Name] != nil {
+		return fmt.Errorf("block %q: duplicated name", b.Name)
+	}
+
+	b.Textures.fill()
+	for _, face := range b.Textures.list() {
+		if *face == "" {
+			return fmt.Errorf("block %q: missing texture", b.Name)
+		}
+	}
+	if b.Translucent && !b.Transparent {
+		return fmt.Errorf("block %q: translucent blocks must be transparent", b.Name)
+	}
+	if b.Tint == (mgl32.Vec4{}) {
+		b.Tint = mgl32.Vec4{1, 1, 1, 1}
+	}
+	if o := b.Ore; o != nil {
+		switch {
+		case o.MinY > o.MaxY:
+			return fmt.Errorf("block %q: ore min_y %d is above max_y %d", b.Name, o.MinY, o.MaxY)
+		case o.Size < 1 || o.Size > world.ChunkSize:
+			// Longer veins could leave the start chunk's neighbours, see
+			// worldgen's placeOres
+			return fmt.Errorf("block %q: ore size must be 1 to %d, got %d", b.Name, world.ChunkSize, o.Size)
+		case o.Veins < 0:
+			return fmt.Errorf("block %q: ore veins must not be negative", b.Name)
+		}
+	}
+
+	if err := b.resolveStates(r.models); err != nil {
+		return err
+	}
+
+	for len(r.blocks) <= b.ID {
+		r.blocks = append(r.blocks, nil)
+	}
+	r.blocks[b.ID] = b
+	r.byName[b.Name] = b
+	return nil
+}
+
+// Get returns the block of a state (or plain ID), or nil for air and
+// unknown IDs.
+func (r *Registry) Get(state int) *Block {
+	id := TypeOf(state)
+	if id <= 0 || id >= len(r.blocks) {
+		return nil
+	}
+	return r.blocks[id]
+}
+
+// ByName returns the block with the given name, or nil.
+func (r *Registry) ByName(name string) *Block {
+	return r.byName[name]
+}
+
+// ID returns the ID of the named block, or 0 (air) if it is unknown.
+func (r *Registry) ID(name string) int {
+	if b := r.byName[name]; b != nil {
+		return b.ID
+	}
+	return 0
+}
+
+// Blocks returns every block, ordered by ID.
+func (r *Registry) Blocks() []*Block {
+	var list []*Block
+	for _, b := range r.blocks {
+		if b != nil {
+			list = append(list, b)
+		}
+	}
+	return list
+}
+
+// Ores returns the blocks placed as ore veins, ordered by ID.
+func (r *Registry) Ores() []*Block {
+	var list []*Block
+	for _, b := range r.Blocks() {
+		if b.Ore != nil {
+			list = append(list, b)
+		}
+	}
+	return list
+}
+
+// Hotbar returns the blocks that have a hotbar icon, ordered by ID.
+func (r *Registry) Hotbar() []*Block {
+	var list []*Block
+	for _, b := range r.Blocks() {
+		if b.Icon != "" {
+			list = append(list, b)
+		}
+	}
+	return list
+}
+
+// Textures returns the sorted names of every texture the blocks use.
+func (r *Registry) Textures() []string {
+	seen := map[string]bool{}
+	for _, b := range r.Blocks() {
+		seen[b.Icon] = true
+		for i := range b.states {
+			for _, name := range b.states[i].textures.list() {
+				seen[*name] = true
+			}
+			shape := b.states[i].shape
+			seen[shape.Cross] = true
+			for _, c := range shape.Cuboids {
+				for _, f := range c.Faces {
+					if f != nil {
+						seen[f.Texture] = true
+					}
+				}
+			}
+		}
+	}
+	delete(seen, "")
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TextureTint returns the kind of biome tint applied to a texture, or ""
+// if it is drawn as is.
+func (r *Registry) TextureTint(texture string) string {
+	return r.tints[texture]
+}
+
+// IsSolid reports whether a block state stops movement.
+func (r *Registry) IsSolid(state int) bool {
+	b := r.Get(state)
+	return b != nil && b.state(state).solid
+}
+
+// IsTranslucent reports whether a block state is drawn blended, after
+// every opaque block.
+func (r *Registry) IsTranslucent(state int) bool {
+	b := r.Get(state)
+	return b != nil && b.Translucent
+}
+
+// IsLiquid reports whether a block state is a liquid, which the player
+// swims in and blocks can be placed into.
+func (r *Registry) IsLiquid(state int) bool {
+	s := r.Shape(state)
+	return s != nil && s.Liquid > 0
+}
+
+// IsTransparent reports whether blocks behind a block state can be seen
+// through it. Air counts as transparent.
+func (r *Registry) IsTransparent(state int) bool {
+	b := r.Get(state)
+	return b == nil || b.state(state).transparent
+}
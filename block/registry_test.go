@@ -0,0 +1,94 @@
+package block
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	r, err := Parse([]byte(`{"blocks": [
+		{"id": 1, "name": "stone", "textures": {"all": "stone"}, "solid": true, "icon": "stone"},
+		{"id": 3, "name": "grass", "textures": {"all": "dirt", "top": "grass_top"}, "solid": true},
+		{"id": 4, "name": "glass", "textures": {"all": "glass"}, "transparent": true, "tint": [1, 0.5, 0.5, 0.8]}
+	], "tinted_textures": {"grass_top": "grass"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grass := r.ByName("grass")
+	if grass == nil || grass.ID != 3 {
+		t.Fatalf("ByName(grass) = %+v", grass)
+	}
+	if grass.Textures.Top != "grass_top" || grass.Textures.Side != "dirt" || grass.Textures.Bottom != "dirt" {
+		t.Errorf("grass textures = %+v", grass.Textures)
+	}
+	if grass.Tint[3] != 1 {
+		t.Errorf("default tint = %v, want white", grass.Tint)
+	}
+	if r.Get(4).Tint[1] != 0.5 {
+		t.Errorf("glass tint = %v", r.Get(4).Tint)
+	}
+
+	if r.Get(0) != nil || r.Get(2) != nil || r.Get(99) != nil {
+		t.Errorf("Get must return nil for air and unknown IDs")
+	}
+	if !r.IsSolid(1) || r.IsSolid(4) || r.IsSolid(0) {
+		t.Errorf("IsSolid mismatch")
+	}
+	if !r.IsTransparent(0) || !r.IsTransparent(4) || r.IsTransparent(1) {
+		t.Errorf("IsTransparent mismatch")
+	}
+
+	if hb := r.Hotbar(); len(hb) != 1 || hb[0].Name != "stone" {
+		t.Errorf("Hotbar = %v", hb)
+	}
+	if r.TextureTint("grass_top") != "grass" || r.TextureTint("dirt") != "" {
+		t.Errorf("TextureTint mismatch")
+	}
+
+	want := "dirt,glass,grass_top,stone"
+	if got := strings.Join(r.Textures(), ","); got != want {
+		t.Errorf("Textures = %s, want %s", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"zero id":        `{"blocks": [{"id": 0, "name": "a", "textures": {"all": "a"}}]}`,
+		"missing name":   `{"blocks": [{"id": 1, "textures": {"all": "a"}}]}`,
+		"duplicate id":   `{"blocks": [{"id": 1, "name": "a", "textures": {"all": "a"}}, {"id": 1, "name": "b", "textures": {"all": "a"}}]}`,
+		"duplicate name": `{"blocks": [{"id": 1, "name": "a", "textures": {"all": "a"}}, {"id": 2, "name": "a", "textures": {"all": "a"}}]}`,
+		"no texture":     `{"blocks": [{"id": 1, "name": "a", "textures": {"top": "a"}}]}`,
+		"bad json":       `{"blocks": [`,
+		"ore range":      `{"blocks": [{"id": 1, "name": "a", "textures": {"all": "a"}, "ore": {"min_y": 5, "max_y": 0, "size": 4, "veins": 1}}]}`,
+		"ore size":       `{"blocks": [{"id": 1, "name": "a", "textures": {"all": "a"}, "ore": {"min_y": 0, "max_y": 5, "size": 40, "veins": 1}}]}`,
+		"ore veins":      `{"blocks": [{"id": 1, "name": "a", "textures": {"all": "a"}, "ore": {"min_y": 0, "max_y": 5, "size": 4, "veins": -1}}]}`,
+	}
+	for name, data := range cases {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadRepositoryDefinitions(t *testing.T) {
+	r, err := Load("../blocks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"sand", "rock", "grass", "dirt", "water"} {
+		if r.ByName(name) == nil {
+			t.Errorf("missing block %q", name)
+		}
+	}
+	if len(r.Ores()) == 0 {
+		t.Errorf("no ores defined")
+	}
+	for _, name := range r.Textures() {
+		if _, err := os.Stat(filepath.Join("../textures", name+".png")); err != nil {
+			t.Errorf("texture %q: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package block
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A block state is a block ID plus the values of the block's properties,
+// packed into one int that fits the uint16 cells of a chunk: the ID in the
+// low IDBits bits and the index of the combination of property values
+// above it. Index 0 holds the first value of every property, so a plain
+// block ID is also the block's default state.
+const (
+	IDBits    = 8
+	MaxID     = 1<<IDBits - 1
+	MaxStates = 1 << (16 - IDBits) // Per block
+)
+
+// TypeOf returns the block ID of a state.
+func TypeOf(state int) int {
+	return state & MaxID
+}
+
+// IndexOf returns the index of a state among the states of its block.
+func IndexOf(state int) int {
+	return state >> IDBits
+}
+
+// Pack returns the state of block id with the given index.
+func Pack(id, index int) int {
+	return id | index<<IDBits
+}
+
+// Property is a named property of a block, such as the axis of a log.
+type Property struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"` // The first one is the default
+
+	// Kind gives the values a meaning, so placing and rotating the block
+	// can set them: "axis" (values among x, y and z), "facing" (among
+	// north, east, south and west), "half" (bottom or top, the half of the
+	// block clicked when placing it), "connect" (false or true, whether
+	// the block connects to its neighbour on the side the property is
+	// named after, see Registry.Connect) or "level" (0, 1, 2... in order,
+	// how far a liquid flowed from its source, see Block.Level). Empty for
+	// other properties.
+	Kind string `json:"kind"`
+}
+
+// Property kinds.
+const (
+	KindAxis    = "axis"
+	KindFacing  = "facing"
+	KindHalf    = "half"
+	KindConnect = "connect"
+	KindLevel   = "level"
+)
+
+// Variant overrides the looks or behaviour of the states whose properties
+// match When. Later variants win over earlier ones.
+type Variant struct {
+	When        map[string]string `json:"when"`
+	Textures    *Faces            `json:"textures"` // Faces left empty keep the block's
+	Solid       *bool             `json:"solid"`
+	Transparent *bool             `json:"transparent"`
+	Model       string            `json:"model"` // Empty keeps the block's
+	RotateY     *int              `json:"rotate_y"`
+}
+
+// stateInfo is what a state resolves to after applying the variants.
+type stateInfo struct {
+	textures    Faces
+	solid       bool
+	transparent bool
+	shape       *Shape
+}
+
+// resolveStates checks the properties, variants and parts of b and builds
+// the table of its states, with their models taken from models.
+func (b *Block) resolveStates(models map[string]*Model) error {
+	count := 1
+	names := map[string]*Property{}
+	for i := range b.Properties {
+		p := &b.Properties[i]
+		if p.Name == "" || names[p.Name] != nil {
+			return fmt.Errorf("block %q: property %d has a missing or duplicated name", b.Name, i)
+		}
+		names[p.Name] = p
+		if len(p.Values) == 0 {
+			return fmt.Errorf("block %q: property %q has no values", b.Name, p.Name)
+		}
+		seen := map[string]bool{}
+		for _, v := range p.Values {
+			if v == "" || seen[v] || strings.ContainsAny(v, "[]=,") {
+				return fmt.Errorf("block %q: property %q has a bad or duplicated value %q", b.Name, p.Name, v)
+			}
+			seen[v] = true
+			if !kindAllows(p.Kind, v) {
+				return fmt.Errorf("block %q: %q is not a %s value", b.Name, v, p.Kind)
+			}
+		}
+		switch p.Kind {
+		case "", KindAxis, KindFacing, KindHalf:
+		case KindConnect:
+			if _, ok := directions[p.Name]; !ok {
+				return fmt.Errorf("block %q: connect property %q is not named after a side", b.Name, p.Name)
+			}
+		case KindLevel:
+			if b.levels != nil {
+				return fmt.Errorf("block %q: more than one level property", b.Name)
+			}
+			if len(p.Values) < 3 {
+				return fmt.Errorf("block %q: level property %q needs a source, a flowing and a falling level", b.Name, p.Name)
+			}
+			for i, v := range p.Values {
+				if v != strconv.Itoa(i) {
+					return fmt.Errorf("block %q: level property %q must count from 0", b.Name, p.Name)
+				}
+			}
+			b.levels = p
+		default:
+			return fmt.Errorf("block %q: property %q has unknown kind %q", b.Name, p.Name, p.Kind)
+		}
+		count *= len(p.Values)
+		if count > MaxStates {
+			return fmt.Errorf("block %q: more than %d states", b.Name, MaxStates)
+		}
+	}
+	checkWhen := func(what string, i int, when map[string]string) error {
+		for name, value := range when {
+			p := names[name]
+			if p == nil || indexOf(p.Values, value) < 0 {
+				return fmt.Errorf("block %q: %s %d matches unknown %s=%s", b.Name, what, i, name, value)
+			}
+		}
+		return nil
+	}
+	checkUse := func(what, name string, degrees int) error {
+		if name != "" && models[name] == nil {
+			return fmt.Errorf("block %q: %s uses unknown model %q", b.Name, what, name)
+		}
+		if _, err := checkRotation(degrees); err != nil {
+			return fmt.Errorf("block %q: %s: %w", b.Name, what, err)
+		}
+		return nil
+	}
+	if err := checkUse("block", b.Model, b.RotateY); err != nil {
+		return err
+	}
+	for i, v := range b.Variants {
+		if err := checkWhen("variant", i, v.When); err != nil {
+			return err
+		}
+		rotate := 0
+		if v.RotateY != nil {
+			rotate = *v.RotateY
+		}
+		if err := checkUse(fmt.Sprintf("variant %d", i), v.Model, rotate); err != nil {
+			return err
+		}
+		if v.Textures != nil {
+			v.Textures.fill()
+		}
+	}
+	for i, p := range b.Parts {
+		if err := checkWhen("part", i, p.When); err != nil {
+			return err
+		}
+		if p.Model == "" {
+			return fmt.Errorf("block %q: part %d has no model", b.Name, i)
+		}
+		if err := checkUse(fmt.Sprintf("part %d", i), p.Model, p.RotateY); err != nil {
+			return err
+		}
+	}
+
+	b.states = make([]stateInfo, count)
+	for i := range b.states {
+		state := Pack(b.ID, i)
+		s := stateInfo{textures: b.Textures, solid: b.Solid, transparent: b.Transparent}
+		model, rotate := b.Model, b.RotateY
+		for _, v := range b.Variants {
+			if !b.matches(state, v.When) {
+				continue
+			}
+			if v.Textures != nil {
+				s.textures.override(v.Textures)
+			}
+			if v.Solid != nil {
+				s.solid = *v.Solid
+			}
+			if v.Transparent != nil {
+				s.transparent = *v.Transparent
+			}
+			if v.Model != "" {
+				model = v.Model
+			}
+			if v.RotateY != nil {
+				rotate = *v.RotateY
+			}
+		}
+
+		var placed []placedModel
+		if model != "" {
+			turns, _ := checkRotation(rotate)
+			placed = append(placed, placedModel{models[model], turns})
+		}
+		for _, p := range b.Parts {
+			if b.matches(state, p.When) {
+				turns, _ := checkRotation(p.RotateY)
+				placed = append(placed, placedModel{models[p.Model], turns})
+			}
+		}
+		s.shape = buildShape(placed, &s.textures, s.solid)
+		b.states[i] = s
+	}
+	return nil
+}
+
+// kindAllows reports whether v is a valid value for properties of a kind.
+func kindAllows(kind, v string) bool {
+	switch kind {
+	case KindAxis:
+		return v == "x" || v == "y" || v == "z"
+	case KindFacing:
+		_, ok := directions[v]
+		return ok
+	case KindHalf:
+		return v == "bottom" || v == "top"
+	case KindConnect:
+		return v == "false" || v == "true"
+	case KindLevel:
+		_, err := strconv.Atoi(v)
+		return err == nil
+	}
+	return true
+}
+
+func (b *Block) matches(state int, when map[string]string) bool {
+	for name, value := range when {
+		if b.Value(state, name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// state returns the resolved state, falling back to the default state for
+// indices the block does not have.
+func (b *Block) state(state int) *stateInfo {
+	i := IndexOf(state)
+	if len(b.states) == 0 {
+		// Not added to a registry
+		return &stateInfo{b.Textures, b.Solid, b.Transparent, cubeShape(b.Solid)}
+	}
+	if i >= len(b.states) {
+		i = 0
+	}
+	return &b.states[i]
+}
+
+// Default returns the default state of the block, which is its ID.
+func (b *Block) Default() int {
+	return b.ID
+}
+
+// StateCount returns the number of states of the block.
+func (b *Block) StateCount() int {
+	return len(b.states)
+}
+
+// Value returns the value of a property in a state of the block, or "" if
+// the block has no such property.
+func (b *Block) Value(state int, name string) string {
+	i := IndexOf(state)
+	for _, p := range b.Properties {
+		v := p.Values[i%len(p.Values)]
+		if p.Name == name {
+			return v
+		}
+		i /= len(p.Values)
+	}
+	return ""
+}
+
+// With returns the state with a property changed. ok is false if the block
+// has no such property or value.
+func (b *Block) With(state int, name, value string) (s int, ok bool) {
+	stride := 1
+	i := IndexOf(state)
+	for _, p := range b.Properties {
+		n := len(p.Values)
+		if p.Name == name {
+			v := indexOf(p.Values, value)
+			if v < 0 {
+				return state, false
+			}
+			i += (v - i/stride%n) * stride
+			return Pack(b.ID, i), true
+		}
+		stride *= n
+	}
+	return state, false
+}
+
+// Levels returns the number of values of the block's level property, or 0
+// if it has none. Level 0 is a source, the last level is falling and the
+// ones in between have flowed that many blocks from a source.
+func (b *Block) Levels() int {
+	if b.levels == nil {
+		return 0
+	}
+	return len(b.levels.Values)
+}
+
+// Level returns the level of a state of the block, 0 if it has no level
+// property.
+func (b *Block) Level(state int) int {
+	if b.levels == nil {
+		return 0
+	}
+	level, _ := strconv.Atoi(b.Value(state, b.levels.Name))
+	return level
+}
+
+// WithLevel returns the state at another level. The level must be below
+// Levels.
+func (b *Block) WithLevel(state, level int) int {
+	if b.levels == nil {
+		return state
+	}
+	state, _ = b.With(state, b.levels.Name, strconv.Itoa(level))
+	return state
+}
+
+// TexturesOf returns the textures of a state of the block.
+func (b *Block) TexturesOf(state int) *Faces {
+	return &b.state(state).textures
+}
+
+// Placed returns the state of the block placed against a face with the
+// given normal by someone looking along look, who clicked at hit (relative
+// to the lowest corner of the new block). Axis properties follow the
+// normal, facing properties the horizontal look direction and half
+// properties the half of the face clicked. Connect properties are left to
+// Registry.Connect.
+func (b *Block) Placed(normal [3]int, look [3]float32, hit [3]float32) int {
+	state := b.Default()
+	for _, p := range b.Properties {
+		var value string
+		switch p.Kind {
+		case KindAxis:
+			value = "y"
+			if normal[0] != 0 {
+				value = "x"
+			} else if normal[2] != 0 {
+				value = "z"
+			}
+		case KindFacing:
+			switch {
+			case math.Abs(float64(look[0])) > math.Abs(float64(look[2])) && look[0] > 0:
+				value = "east"
+			case math.Abs(float64(look[0])) > math.Abs(float64(look[2])):
+				value = "west"
+			case look[2] > 0:
+				value = "south"
+			default:
+				value = "north"
+			}
+		case KindHalf:
+			value = "bottom"
+			if normal[1] < 0 || normal[1] == 0 && hit[1] > 0.5 {
+				value = "top"
+			}
+		default:
+			continue
+		}
+		state, _ = b.With(state, p.Name, value)
+	}
+	return state
+}
+
+// directions maps facing values to their X, Z direction. A quarter turn
+// takes (x, z) to (-z, x), the same way prefabs rotate.
+var directions = map[string][2]int{
+	"east": {1, 0}, "south": {0, 1}, "west": {-1, 0}, "north": {0, -1},
+}
+
+// Rotate returns a state turned by quarter turns around the vertical axis:
+// axis properties swap x and z, facing properties turn and connect
+// properties move to the side they turn to.
+func (b *Block) Rotate(state, turns int) int {
+	turns &= 3
+	turned := state
+	for _, p := range b.Properties {
+		v := b.Value(state, p.Name)
+		switch p.Kind {
+		case KindAxis:
+			if turns%2 == 1 && v == "x" {
+				v = "z"
+			} else if turns%2 == 1 && v == "z" {
+				v = "x"
+			}
+		case KindFacing:
+			d := directions[v]
+			for i := 0; i < turns; i++ {
+				d = [2]int{-d[1], d[0]}
+			}
+			for name, dir := range directions {
+				if dir == d {
+					v = name
+				}
+			}
+		case KindConnect:
+			// Take the value of the side that turns into this one, or the
+			// default if the block has no property for that side
+			side, _ := sideNamed(p.Name)
+			if v = b.Value(state, side.turn(-turns).String()); v == "" {
+				v = p.Values[0]
+			}
+		default:
+			continue
+		}
+		turned, _ = b.With(turned, p.Name, v)
+	}
+	return turned
+}
+
+// StateName returns a state as written in prefabs and saves: the block
+// name, followed by the properties that differ from the default in
+// brackets, as in "log[axis=x]". Air is "air"; unknown blocks give "".
+func (r *Registry) StateName(state int) string {
+	if TypeOf(state) == 0 {
+		return "air"
+	}
+	b := r.Get(state)
+	if b == nil {
+		return ""
+	}
+	var props []string
+	for _, p := range b.Properties {
+		if v := b.Value(state, p.Name); v != p.Values[0] {
+			props = append(props, p.Name+"="+v)
+		}
+	}
+	if len(props) == 0 {
+		return b.Name
+	}
+	return b.Name + "[" + strings.Join(props, ",") + "]"
+}
+
+// ParseState parses a state written by StateName. Properties may be listed
+// in any order; missing ones take their default value.
+func (r *Registry) ParseState(s string) (int, error) {
+	name, props, hasProps := strings.Cut(s, "[")
+	if name == "air" && !hasProps {
+		return 0, nil
+	}
+	b := r.ByName(name)
+	if b == nil {
+		return 0, fmt.Errorf("unknown block %q", name)
+	}
+	state := b.Default()
+	if !hasProps {
+		return state, nil
+	}
+	props, ok := strings.CutSuffix(props, "]")
+	if !ok {
+		return 0, fmt.Errorf("state %q: missing ]", s)
+	}
+	for _, kv := range strings.Split(props, ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		if state, ok = b.With(state, k, v); !ok {
+			return 0, fmt.Errorf("state %q: block %s has no %s=%s", s, b.Name, k, v)
+		}
+	}
+	return state, nil
+}
+
+func indexOf(values []string, v string) int {
+	for i, s := range values {
+		if s == v {
+			return i
+		}
+	}
+	return -1
+}
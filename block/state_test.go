@@ -0,0 +1,185 @@
+package block
+
+import "testing"
+
+const stateDefs = `{"blocks": [
+	{"id": 1, "name": "stone", "textures": {"all": "stone"}, "solid": true},
+	{"id": 2, "name": "log", "textures": {"top": "log_top", "bottom": "log_top", "side": "log_side"}, "solid": true,
+	 "properties": [{"name": "axis", "values": ["y", "x", "z"], "kind": "axis"}],
+	 "variants": [{"when": {"axis": "x"}, "textures": {"all": "log_side", "east": "log_top", "west": "log_top"}}]},
+	{"id": 3, "name": "door", "textures": {"all": "door"}, "solid": true,
+	 "properties": [
+		{"name": "facing", "values": ["north", "east", "south", "west"], "kind": "facing"},
+		{"name": "open", "values": ["false", "true"]}
+	 ],
+	 "variants": [{"when": {"open": "true"}, "solid": false, "transparent": true}]}
+]}`
+
+func TestStates(t *testing.T) {
+	r, err := Parse([]byte(stateDefs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	door := r.ByName("door")
+	if door.StateCount() != 8 || r.ByName("stone").StateCount() != 1 {
+		t.Errorf("StateCount = %d, want 8", door.StateCount())
+	}
+
+	s := door.Default()
+	if s != door.ID || door.Value(s, "facing") != "north" || door.Value(s, "open") != "false" {
+		t.Errorf("default state %d: facing %s, open %s", s, door.Value(s, "facing"), door.Value(s, "open"))
+	}
+	s, _ = door.With(s, "open", "true")
+	s, _ = door.With(s, "facing", "west")
+	if door.Value(s, "facing") != "west" || door.Value(s, "open") != "true" {
+		t.Errorf("With gave facing %s, open %s", door.Value(s, "facing"), door.Value(s, "open"))
+	}
+	if TypeOf(s) != door.ID || r.Get(s) != door {
+		t.Errorf("state %d is not a door", s)
+	}
+	if _, ok := door.With(s, "open", "ajar"); ok {
+		t.Errorf("With accepted an unknown value")
+	}
+	if _, ok := door.With(s, "colour", "red"); ok {
+		t.Errorf("With accepted an unknown property")
+	}
+
+	// Variants override behaviour per state
+	if r.IsSolid(s) || !r.IsTransparent(s) || !r.IsSolid(door.ID) || r.IsTransparent(door.ID) {
+		t.Errorf("open door: solid %v, transparent %v", r.IsSolid(s), r.IsTransparent(s))
+	}
+	log := r.ByName("log")
+	x, _ := log.With(log.Default(), "axis", "x")
+	if f := log.TexturesOf(x); f.East != "log_top" || f.Top != "log_side" || f.North != "log_side" {
+		t.Errorf("log along x textures = %+v", f)
+	}
+	if f := log.TexturesOf(log.Default()); f.Top != "log_top" || f.East != "log_side" {
+		t.Errorf("standing log textures = %+v", f)
+	}
+}
+
+func TestStateNames(t *testing.T) {
+	r, err := Parse([]byte(stateDefs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	door := r.ByName("door")
+	for s := 0; s < door.StateCount(); s++ {
+		state := Pack(door.ID, s)
+		name := r.StateName(state)
+		if got, err := r.ParseState(name); err != nil || got != state {
+			t.Errorf("ParseState(%q) = %d, %v; want %d", name, got, err, state)
+		}
+	}
+	s, _ := door.With(door.Default(), "open", "true")
+	if got := r.StateName(s); got != "door[open=true]" {
+		t.Errorf("StateName = %q", got)
+	}
+	if got, err := r.ParseState("door[open=true,facing=south]"); err != nil || door.Value(got, "facing") != "south" {
+		t.Errorf("ParseState with reordered properties = %d, %v", got, err)
+	}
+	if r.StateName(0) != "air" || r.StateName(99) != "" {
+		t.Errorf("StateName of air or unknown blocks is wrong")
+	}
+	for _, bad := range []string{"granite", "door[open=maybe]", "door[open=true", "stone[axis=x]"} {
+		if _, err := r.ParseState(bad); err == nil {
+			t.Errorf("ParseState(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestPlacedAndRotate(t *testing.T) {
+	r, err := Parse([]byte(stateDefs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, door := r.ByName("log"), r.ByName("door")
+
+	for _, c := range []struct {
+		normal [3]int
+		axis   string
+	}{
+		{[3]int{0, 1, 0}, "y"}, {[3]int{-1, 0, 0}, "x"}, {[3]int{0, 0, 1}, "z"},
+	} {
+		if got := log.Value(log.Placed(c.normal, [3]float32{}, [3]float32{}), "axis"); got != c.axis {
+			t.Errorf("log placed on %v: axis %s, want %s", c.normal, got, c.axis)
+		}
+	}
+	for _, c := range []struct {
+		look   [3]float32
+		facing string
+	}{
+		{[3]float32{1, 0, 0.5}, "east"}, {[3]float32{-1, -1, 0}, "west"}, {[3]float32{0.2, 0, 1}, "south"}, {[3]float32{0, 0, -1}, "north"},
+	} {
+		if got := door.Value(door.Placed([3]int{0, 1, 0}, c.look, [3]float32{}), "facing"); got != c.facing {
+			t.Errorf("door placed looking %v: facing %s, want %s", c.look, got, c.facing)
+		}
+	}
+
+	x, _ := log.With(log.Default(), "axis", "x")
+	if log.Value(log.Rotate(x, 1), "axis") != "z" || log.Rotate(x, 2) != x || log.Rotate(log.Default(), 1) != log.Default() {
+		t.Errorf("log rotation is wrong")
+	}
+	east, _ := door.With(door.Default(), "facing", "east")
+	east, _ = door.With(east, "open", "true")
+	for turns, want := range []string{"east", "south", "west", "north", "east"} {
+		s := door.Rotate(east, turns)
+		if door.Value(s, "facing") != want || door.Value(s, "open") != "true" {
+			t.Errorf("door turned %d times: facing %s, want %s", turns, door.Value(s, "facing"), want)
+		}
+	}
+}
+
+func TestStateErrors(t *testing.T) {
+	block := func(props, variants string) string {
+		return `{"blocks": [{"id": 1, "name": "a", "textures": {"all": "a"}, "properties": ` + props + `, "variants": ` + variants + `}]}`
+	}
+	many := `[{"name": "a", "values": ["0","1","2","3","4","5","6","7","8","9","10","11","12","13","14","15","16"]},
+		{"name": "b", "values": ["0","1","2","3","4","5","6","7","8","9","10","11","12","13","14","15","16"]}]`
+	cases := map[string]string{
+		"big id":          `{"blocks": [{"id": 256, "name": "a", "textures": {"all": "a"}}]}`,
+		"no values":       block(`[{"name": "p", "values": []}]`, `[]`),
+		"duplicate value": block(`[{"name": "p", "values": ["a", "a"]}]`, `[]`),
+		"bad value":       block(`[{"name": "p", "values": ["a=b"]}]`, `[]`),
+		"duplicate name":  block(`[{"name": "p", "values": ["a"]}, {"name": "p", "values": ["b"]}]`, `[]`),
+		"bad axis":        block(`[{"name": "p", "values": ["up"], "kind": "axis"}]`, `[]`),
+		"bad facing":      block(`[{"name": "p", "values": ["up"], "kind": "facing"}]`, `[]`),
+		"unknown kind":    block(`[{"name": "p", "values": ["a"], "kind": "colour"}]`, `[]`),
+		"too many states": block(many, `[]`),
+		"variant value":   block(`[{"name": "p", "values": ["a"]}]`, `[{"when": {"p": "b"}}]`),
+		"variant name":    block(`[{"name": "p", "values": ["a"]}]`, `[{"when": {"q": "a"}}]`),
+		"level order":     block(`[{"name": "p", "values": ["0", "2", "1"], "kind": "level"}]`, `[]`),
+		"few levels":      block(`[{"name": "p", "values": ["0", "1"], "kind": "level"}]`, `[]`),
+		"two levels": block(`[{"name": "p", "values": ["0", "1", "2"], "kind": "level"},
+			{"name": "q", "values": ["0", "1", "2"], "kind": "level"}]`, `[]`),
+	}
+	for name, data := range cases {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	r, err := Parse([]byte(`{"blocks": [
+		{"id": 1, "name": "stone", "textures": {"all": "stone"}, "solid": true},
+		{"id": 2, "name": "water", "textures": {"all": "water"}, "transparent": true, "model": "water",
+		 "properties": [{"name": "level", "values": ["0", "1", "2", "3", "4"], "kind": "level"}]}
+	], "models": {"water": {"type": "liquid", "height": 16}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	water, stone := r.ByName("water"), r.ByName("stone")
+	if water.Levels() != 5 || stone.Levels() != 0 {
+		t.Errorf("Levels = %d and %d, want 5 and 0", water.Levels(), stone.Levels())
+	}
+	for level, surface := range []float32{1, 0.75, 0.5, 0.25, 1} {
+		s := water.WithLevel(water.Default(), level)
+		if water.Level(s) != level || r.Surface(s) != surface {
+			t.Errorf("level %d: Level = %d, Surface = %v, want %v", level, water.Level(s), r.Surface(s), surface)
+		}
+	}
+	if stone.Level(1) != 0 || stone.WithLevel(1, 2) != 1 || r.Surface(1) != 0 || r.Surface(0) != 0 {
+		t.Errorf("levels of a block without a level property")
+	}
+}
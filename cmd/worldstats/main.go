@@ -0,0 +1,59 @@
+// Command worldstats generates part of a world and prints how many blocks
+// of each ore it contains per height band, to tune and check the ore
+// settings in blocks.json without starting the game.
+//
+// Usage:
+//
+//	go run ./cmd/worldstats [-seed 42] [-radius 8] [-band 16] [-all]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"craft3d/block"
+	"craft3d/prefab"
+	"craft3d/worldgen"
+)
+
+func main() {
+	blocksPath := flag.String("blocks", "blocks.json", "block definitions")
+	prefabDir := flag.String("prefabs", "prefabs", "decoration prefabs, empty for bare terrain")
+	generatorName := flag.String("generator", "noise", fmt.Sprintf("terrain generator %v", worldgen.Names()))
+	seed := flag.Int64("seed", 0, "world seed")
+	radius := flag.Int("radius", 8, "count the chunks within this many chunks of the origin")
+	band := flag.Int("band", 16, "height of a band, in blocks")
+	all := flag.Bool("all", false, "count every block, not only ores")
+	flag.Parse()
+
+	if *radius < 1 || *band < 1 {
+		log.Fatalln("radius and band must be positive")
+	}
+	reg, err := block.Load(*blocksPath)
+	if err != nil {
+		log.Fatalln("failed to load block definitions:", err)
+	}
+	gen, err := worldgen.New(*generatorName, reg)
+	if err != nil {
+		log.Fatalln("failed to create terrain generator:", err)
+	}
+	if src, ok := gen.(worldgen.SurfaceSource); ok && *prefabDir != "" {
+		prefabs, err := prefab.LoadDir(*prefabDir, reg, worldgen.BiomeNames())
+		if err != nil {
+			log.Fatalln("failed to load prefabs:", err)
+		}
+		gen = worldgen.Decorate(src, prefabs)
+	}
+
+	blocks := reg.Ores()
+	if *all {
+		blocks = reg.Blocks()
+	}
+	stats := worldgen.Count(gen, *seed, *radius, *band)
+	fmt.Printf("%s terrain, seed %d, %d chunks\n\n", *generatorName, *seed, stats.Chunks)
+	if err := stats.Write(os.Stdout, blocks); err != nil {
+		log.Fatalln(err)
+	}
+}
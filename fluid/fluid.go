@@ -0,0 +1,213 @@
+// Package fluid makes liquids flow.
+//
+// A liquid is a block with a liquid model and a level property (see
+// block.Block.Level). Level 0 is a source, which stays where it is put.
+// Sources feed the cells beside them at level 1, those feed level 2 and so
+// on, until the last flowing level; liquid with nowhere to fall spreads
+// sideways, otherwise it falls at the last level, which feeds the cells
+// beside where it lands as a source would. A cell between two sources
+// over solid ground or another source becomes a source itself, and liquid
+// that is no longer fed recedes one level at a time until it is gone.
+//
+// Cells are updated from a queue of scheduled ticks, FlowDelay after
+// something next to them changed, so the work per tick is bounded and the
+// result only depends on the edits and the number of ticks, never on
+// timing or map order.
+package fluid
+
+import (
+	"slices"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+// TickRate is the number of ticks per second the game runs Tick at.
+const TickRate = 20
+
+// FlowDelay is the number of ticks between a change and the update of the
+// cells next to it, so liquids flow TickRate / FlowDelay blocks a second.
+const FlowDelay = 5
+
+// DefaultMaxUpdates is the default of Sim.MaxUpdates.
+const DefaultMaxUpdates = 4096
+
+// World is the part of a world the simulation reads and writes.
+// *world.World implements it.
+type World interface {
+	GetBlock(p world.BlockPos) int
+	SetBlock(p world.BlockPos, state int)
+}
+
+// Bounded is implemented by worlds that only hold part of the terrain,
+// such as the chunks loaded around the player. Liquids do not flow into
+// cells outside.
+type Bounded interface {
+	Contains(p world.BlockPos) bool
+}
+
+// Sim is the queue of liquid updates for a world.
+type Sim struct {
+	// MaxUpdates bounds the cells updated per tick; the others wait for
+	// the following ticks, in order.
+	MaxUpdates int
+
+	reg     *block.Registry
+	tick    int64
+	due     map[int64][]world.BlockPos // Updates by tick, in scheduling order
+	pending map[world.BlockPos]int64   // Tick each queued cell is due at
+}
+
+// New returns a simulation with nothing scheduled.
+func New(reg *block.Registry) *Sim {
+	return &Sim{
+		MaxUpdates: DefaultMaxUpdates,
+		reg:        reg,
+		due:        make(map[int64][]world.BlockPos),
+		pending:    make(map[world.BlockPos]int64),
+	}
+}
+
+// neighbours are the cells whose liquid depends on a cell: the one below
+// and the four beside it, and the one above for sources forming below.
+var neighbours = []world.BlockPos{
+	{Y: -1}, {Z: -1}, {X: 1}, {Z: 1}, {X: -1}, {Y: 1},
+}
+
+// Changed schedules an update of p and the cells around it, after the block
+// at p was set. Cells already waiting keep their turn.
+func (s *Sim) Changed(p world.BlockPos) {
+	s.schedule(p)
+	for _, d := range neighbours {
+		s.schedule(world.BlockPos{X: p.X + d.X, Y: p.Y + d.Y, Z: p.Z + d.Z})
+	}
+}
+
+func (s *Sim) schedule(p world.BlockPos) {
+	if _, ok := s.pending[p]; ok {
+		return
+	}
+	at := s.tick + FlowDelay
+	s.pending[p] = at
+	s.due[at] = append(s.due[at], p)
+}
+
+// Pending returns the number of cells waiting for an update.
+func (s *Sim) Pending() int {
+	return len(s.pending)
+}
+
+// Tick advances the simulation by one tick and updates the cells due then,
+// at most MaxUpdates of them.
+func (s *Sim) Tick(w World) {
+	s.tick++
+	cells := s.due[s.tick]
+	delete(s.due, s.tick)
+	if len(cells) > s.MaxUpdates {
+		// The rest go first next tick
+		later := cells[s.MaxUpdates:]
+		cells = cells[:s.MaxUpdates]
+		for _, p := range later {
+			s.pending[p] = s.tick + 1
+		}
+		s.due[s.tick+1] = slices.Concat(later, s.due[s.tick+1])
+	}
+	for _, p := range cells {
+		delete(s.pending, p)
+	}
+	for _, p := range cells {
+		s.update(w, p)
+	}
+}
+
+// update sets the cell at p to the liquid that flows there, if it is empty
+// or holds liquid that is not a source.
+func (s *Sim) update(w World, p world.BlockPos) {
+	if b, ok := w.(Bounded); ok && !b.Contains(p) {
+		return
+	}
+	state := w.GetBlock(p)
+	var liquid *block.Block
+	if state != world.Air {
+		liquid = s.liquid(state)
+		if liquid == nil || liquid.Level(state) == 0 {
+			return
+		}
+	}
+	flow := s.flow(w, p, liquid)
+	if flow != state {
+		w.SetBlock(p, flow)
+		s.Changed(p)
+	}
+}
+
+// flow returns the state of the cell at p given its neighbours: liquid
+// falling from above, a new source, liquid fed from the side or air.
+// liquid is the liquid already in the cell, nil if it is empty.
+func (s *Sim) flow(w World, p world.BlockPos, liquid *block.Block) int {
+	if above := w.GetBlock(world.BlockPos{X: p.X, Y: p.Y + 1, Z: p.Z}); s.feeds(liquid, above) {
+		b := s.liquid(above)
+		return b.WithLevel(b.Default(), b.Levels()-1)
+	}
+
+	sources, fed := 0, 0
+	for _, d := range neighbours[1:5] {
+		n := world.BlockPos{X: p.X + d.X, Y: p.Y, Z: p.Z + d.Z}
+		state := w.GetBlock(n)
+		if !s.feeds(liquid, state) {
+			continue
+		}
+		liquid = s.liquid(state)
+		falling := liquid.Levels() - 1
+		level := liquid.Level(state)
+		if level == 0 {
+			sources++
+		}
+		if !s.rests(w, n, liquid) {
+			continue
+		}
+		if level == falling {
+			level = 0
+		}
+		if fed == 0 || level+1 < fed {
+			fed = level + 1
+		}
+	}
+	if liquid == nil {
+		return world.Air
+	}
+
+	if sources >= 2 && s.rests(w, p, liquid) {
+		return liquid.Default()
+	}
+	if fed == 0 || fed >= liquid.Levels()-1 {
+		return world.Air
+	}
+	return liquid.WithLevel(liquid.Default(), fed)
+}
+
+// feeds reports whether a neighbour state is a liquid that can flow into a
+// cell holding liquid (nil for an empty cell).
+func (s *Sim) feeds(liquid *block.Block, state int) bool {
+	b := s.liquid(state)
+	return b != nil && (liquid == nil || b == liquid)
+}
+
+// rests reports whether liquid at p rests on something other than flowing
+// liquid, so it spreads to its sides instead of falling.
+func (s *Sim) rests(w World, p world.BlockPos, liquid *block.Block) bool {
+	below := w.GetBlock(world.BlockPos{X: p.X, Y: p.Y - 1, Z: p.Z})
+	return below != world.Air && (s.liquid(below) != liquid || liquid.Level(below) == 0)
+}
+
+// liquid returns the block of a state if it is a liquid with levels.
+func (s *Sim) liquid(state int) *block.Block {
+	if !s.reg.IsLiquid(state) {
+		return nil
+	}
+	b := s.reg.Get(state)
+	if b.Levels() == 0 {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,216 @@
+package fluid
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+func testRegistry(t *testing.T) *block.Registry {
+	t.Helper()
+	r, err := block.Parse([]byte(`{"blocks": [
+		{"id": 1, "name": "stone", "textures": {"all": "stone"}, "solid": true},
+		{"id": 2, "name": "water", "textures": {"all": "water"}, "transparent": true, "model": "water",
+		 "properties": [{"name": "level", "values": ["0", "1", "2", "3", "4"], "kind": "level"}]}
+	], "models": {"water": {"type": "liquid", "height": 14}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+const (
+	stone = 1
+	water = 2
+)
+
+// floor returns a world with a stone floor at y=0 from -size to size.
+func floor(size int) *world.World {
+	w := world.New()
+	for x := -size; x <= size; x++ {
+		for z := -size; z <= size; z++ {
+			w.SetBlock(world.BlockPos{X: x, Y: 0, Z: z}, stone)
+		}
+	}
+	return w
+}
+
+// run ticks the simulation until nothing is pending, failing after a
+// generous number of ticks.
+func run(t *testing.T, s *Sim, w World) {
+	t.Helper()
+	for ticks := 0; s.Pending() > 0; ticks++ {
+		if ticks > 1000 {
+			t.Fatalf("still %d cells pending after %d ticks", s.Pending(), ticks)
+		}
+		s.Tick(w)
+	}
+}
+
+// row describes the cells of a world along X at y and z=0: '#' for stone,
+// '.' for air, 'S' for a source, 'F' for falling water and the level of
+// other water.
+func row(w *world.World, reg *block.Registry, y, from, to int) string {
+	var b strings.Builder
+	for x := from; x <= to; x++ {
+		state := w.GetBlock(world.BlockPos{X: x, Y: y, Z: 0})
+		water := reg.Get(state)
+		switch {
+		case state == world.Air:
+			b.WriteByte('.')
+		case state == stone:
+			b.WriteByte('#')
+		case water.Level(state) == 0:
+			b.WriteByte('S')
+		case water.Level(state) == water.Levels()-1:
+			b.WriteByte('F')
+		default:
+			fmt.Fprint(&b, water.Level(state))
+		}
+	}
+	return b.String()
+}
+
+// place sets a block and tells the simulation, as the game does.
+func place(s *Sim, w World, p world.BlockPos, state int) {
+	w.SetBlock(p, state)
+	s.Changed(p)
+}
+
+func TestSpread(t *testing.T) {
+	reg := testRegistry(t)
+	w, s := floor(6), New(reg)
+	place(s, w, world.BlockPos{Y: 1}, water)
+	run(t, s, w)
+	if got := row(w, reg, 1, -5, 5); got != "..321S123.." {
+		t.Errorf("water row = %q", got)
+	}
+	// Diagonals are two steps away
+	if got := w.GetBlock(world.BlockPos{X: 1, Y: 1, Z: 1}); reg.Get(got).Level(got) != 2 {
+		t.Errorf("diagonal water = %s, want level 2", reg.StateName(got))
+	}
+
+	// Removing the source drains everything
+	place(s, w, world.BlockPos{Y: 1}, world.Air)
+	run(t, s, w)
+	if got := row(w, reg, 1, -5, 5); got != "..........." {
+		t.Errorf("water row after removing the source = %q", got)
+	}
+}
+
+func TestFall(t *testing.T) {
+	reg := testRegistry(t)
+	w, s := floor(6), New(reg)
+	// A source on a pillar 3 blocks above the floor
+	for y := 1; y <= 3; y++ {
+		w.SetBlock(world.BlockPos{X: -1, Y: y}, stone)
+	}
+	place(s, w, world.BlockPos{X: -1, Y: 4}, water)
+	run(t, s, w)
+	for y, want := range map[int]string{
+		4: "1S1...",
+		3: "F#F...",
+		2: "F#F...",
+		1: "F#F123",
+	} {
+		if got := row(w, reg, y, -2, 3); got != want {
+			t.Errorf("row y=%d = %q, want %q", y, got, want)
+		}
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	reg := testRegistry(t)
+	w, s := floor(6), New(reg)
+	// Walls keep the water in a three-block trench
+	for x := -2; x <= 2; x++ {
+		w.SetBlock(world.BlockPos{X: x, Y: 1, Z: -1}, stone)
+		w.SetBlock(world.BlockPos{X: x, Y: 1, Z: 1}, stone)
+	}
+	w.SetBlock(world.BlockPos{X: -2, Y: 1}, stone)
+	w.SetBlock(world.BlockPos{X: 2, Y: 1}, stone)
+	place(s, w, world.BlockPos{X: -1, Y: 1}, water)
+	place(s, w, world.BlockPos{X: 1, Y: 1}, water)
+	run(t, s, w)
+	if got := row(w, reg, 1, -2, 2); got != "#SSS#" {
+		t.Errorf("trench = %q, want a new source in the middle", got)
+	}
+
+	// The new source stays when one of the others is removed
+	place(s, w, world.BlockPos{X: 1, Y: 1}, world.Air)
+	run(t, s, w)
+	if got := row(w, reg, 1, -2, 2); got != "#SS1#" {
+		t.Errorf("trench after removing a source = %q", got)
+	}
+}
+
+func TestMaxUpdates(t *testing.T) {
+	reg := testRegistry(t)
+	w, s := floor(6), New(reg)
+	s.MaxUpdates = 2
+	place(s, w, world.BlockPos{Y: 1}, water)
+	for range FlowDelay {
+		s.Tick(w)
+	}
+	// The source and its six neighbours were due; two were updated
+	if s.Pending() != 5 {
+		t.Errorf("pending = %d, want 5", s.Pending())
+	}
+	run(t, s, w)
+	if got := row(w, reg, 1, -5, 5); got != "..321S123.." {
+		t.Errorf("water row = %q", got)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	reg := testRegistry(t)
+	// The same edits on the same ticks give the same world
+	simulate := func() string {
+		w, s := floor(8), New(reg)
+		for i, p := range []world.BlockPos{{X: 3, Y: 1}, {X: -2, Y: 3, Z: 4}, {X: 0, Y: 1, Z: -5}} {
+			place(s, w, p, water)
+			for range i * 3 {
+				s.Tick(w)
+			}
+		}
+		place(s, w, world.BlockPos{X: 2, Y: 1}, stone)
+		run(t, s, w)
+		var blocks []string
+		w.ForEachBlock(func(pos world.BlockPos, id int) {
+			if id != stone {
+				blocks = append(blocks, fmt.Sprintf("%v=%s", pos, reg.StateName(id)))
+			}
+		})
+		sort.Strings(blocks)
+		return strings.Join(blocks, " ")
+	}
+	first := simulate()
+	for range 5 {
+		if again := simulate(); again != first {
+			t.Fatalf("runs differ:\n%s\n%s", first, again)
+		}
+	}
+}
+
+// boundedWorld holds only the blocks with x >= 0.
+type boundedWorld struct {
+	*world.World
+}
+
+func (boundedWorld) Contains(p world.BlockPos) bool {
+	return p.X >= 0
+}
+
+func TestBounded(t *testing.T) {
+	reg := testRegistry(t)
+	w, s := floor(6), New(reg)
+	place(s, boundedWorld{w}, world.BlockPos{Y: 1}, water)
+	run(t, s, boundedWorld{w})
+	if got := row(w, reg, 1, -5, 5); got != ".....S123.." {
+		t.Errorf("water row = %q, want nothing at x < 0", got)
+	}
+}
@@ -0,0 +1,398 @@
+// Package game runs the simulation: the player, liquids and other
+// entities, advanced together by ticks of a fixed length.
+//
+// Real time is turned into ticks with an accumulator: Advance adds the time
+// a frame took and runs as many whole ticks as fit, keeping the rest for
+// the next frame. Every tick is the same length whatever the frame rate, so
+// the same input on the same ticks always gives the same world, and the
+// renderer draws the player between the last two ticks, Alpha of the way.
+package game
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"craft3d/block"
+	"craft3d/fluid"
+	"craft3d/physics"
+	"craft3d/world"
+)
+
+// TickRate is the number of ticks per second.
+const TickRate = 60
+
+// Step is the length of a tick in seconds.
+const Step = 1.0 / TickRate
+
+// MaxTicks is the most ticks Advance runs at once. Time beyond them is
+// dropped, so after a stall the game slows down instead of freezing while
+// it catches up.
+const MaxTicks = TickRate / 4
+
+// fluidTicks is the number of game ticks per fluid tick.
+const fluidTicks = TickRate / fluid.TickRate
+
+const (
+	gravity   = 25.0
+	jumpSpeed = 8.0
+	airAccel  = 30.0 // Horizontal acceleration off the ground, when not flying
+
+	// In liquids
+	swimUpSpeed = 4.0 // Top speed swimming up, holding jump
+	swimAccel   = 20.0
+	buoyancy    = 0.8 // Part of gravity liquids cancel
+	liquidDrag  = 3.0 // Vertical speed lost per second, as a rate
+	swimDepth   = 0.6 // Height above the feet that must be in a liquid to swim
+
+	flyUpSpeed = 8.0          // Vertical speed flying, holding jump or sneak
+	doubleTap  = TickRate / 4 // Most ticks between the presses of a double tap
+
+	deathY = -100.0 // The player dies falling below it
+)
+
+// movement is how fast the player moves one way: their top horizontal
+// speed, and how quickly they get to it and stop, in blocks a second and
+// blocks a second per second.
+type movement struct {
+	speed, accel float32
+}
+
+var (
+	walk    = movement{speed: 8, accel: 80}
+	sprint  = movement{speed: 12, accel: 80}
+	sneak   = movement{speed: 2.5, accel: 60}
+	swim    = movement{speed: 4, accel: 20}
+	fly     = movement{speed: 12, accel: 40}
+	flyFast = movement{speed: 24, accel: 40} // Sprinting
+)
+
+// Eye heights of the player above their feet, standing and sneaking.
+const (
+	EyeHeight      = 1.5
+	SneakEyeHeight = 1.2
+)
+
+// PlayerBody is the player's collision box: 0.8 wide and deep, slightly
+// less than a block to fit in 1-wide gaps, and 2 high. Half-block ledges
+// such as slabs are climbed without jumping.
+var PlayerBody = physics.Body{HalfWidth: 0.4, Height: 2, StepHeight: 0.5}
+
+// World is the part of a world the game reads and writes. Contains reports
+// whether the chunk holding a block is loaded: the player does not fall
+// into chunks that are not, and liquids do not flow into them.
+type World interface {
+	GetBlock(p world.BlockPos) int
+	SetBlock(p world.BlockPos, state int)
+	Contains(p world.BlockPos) bool
+}
+
+// Player is the state of the player.
+type Player struct {
+	Position mgl32.Vec3 // Centre of the feet
+	Velocity mgl32.Vec3
+	Yaw      float64 // Degrees, 0 facing +X and 90 facing +Z
+	Pitch    float64
+	OnGround bool
+	IsDead   bool
+
+	Flying    bool // Double-tap jump to start and stop
+	Sprinting bool
+	Sneaking  bool // Lower and not walking off ledges
+
+	last     mgl32.Vec3 // Position before the last tick
+	jumpHeld bool
+	tapped   bool  // Jump was pressed, and not yet as part of a double tap
+	tappedAt int64 // Tick of that press
+}
+
+// EyeHeight returns the height of the player's eyes above their feet.
+func (p *Player) EyeHeight() float32 {
+	if p.Sneaking {
+		return SneakEyeHeight
+	}
+	return EyeHeight
+}
+
+// Teleport puts the player at pos, without drawing them on the way there.
+func (p *Player) Teleport(pos mgl32.Vec3) {
+	p.Position, p.last = pos, pos
+}
+
+// At returns where to draw the player, alpha of the way from their
+// position before the last tick to their position now.
+func (p *Player) At(alpha float32) mgl32.Vec3 {
+	return p.last.Add(p.Position.Sub(p.last).Mul(alpha))
+}
+
+// Input is what the player asks for during a tick.
+type Input struct {
+	Forward, Back bool
+	Left, Right   bool // Strafe
+	Jump          bool // Or swim or fly up; double-tap to fly
+	Sprint        bool // Going forward
+	Sneak         bool // Or fly down
+}
+
+// Entity is something besides the player that moves by itself.
+type Entity interface {
+	// Tick advances the entity by one tick of length Step.
+	Tick(g *Game)
+}
+
+// Game is the simulated world.
+type Game struct {
+	World    World
+	Registry *block.Registry
+	Fluids   *fluid.Sim
+	Player   Player
+	Entities []Entity // Ticked in order, after the player
+
+	ticks int64
+	acc   float64 // Seconds not ticked yet
+}
+
+// New returns a game in w with the player at the origin, facing -Z.
+func New(w World, reg *block.Registry) *Game {
+	return &Game{
+		World:    w,
+		Registry: reg,
+		Fluids:   fluid.New(reg),
+		Player:   Player{Yaw: -90},
+	}
+}
+
+// Ticks returns the number of ticks run so far.
+func (g *Game) Ticks() int64 {
+	return g.ticks
+}
+
+// Advance runs the ticks that fit in the time elapsed since the last call,
+// with the same input, and returns how many it ran.
+func (g *Game) Advance(elapsed float64, in Input) int {
+	g.acc += elapsed
+	n := 0
+	for ; g.acc >= Step; g.acc -= Step {
+		if n == MaxTicks {
+			g.acc = 0
+			break
+		}
+		g.Tick(in)
+		n++
+	}
+	return n
+}
+
+// Alpha returns how far the time Advance has not ticked yet goes into the
+// next tick, from 0 to 1.
+func (g *Game) Alpha() float32 {
+	return float32(g.acc / Step)
+}
+
+// Tick advances the game by one tick: the player moves, then liquids flow
+// and entities move.
+func (g *Game) Tick(in Input) {
+	g.tickPlayer(in)
+	if g.ticks%fluidTicks == 0 {
+		g.Fluids.Tick(g.World)
+	}
+	for _, e := range g.Entities {
+		e.Tick(g)
+	}
+	g.ticks++
+}
+
+func (g *Game) tickPlayer(in Input) {
+	p := &g.Player
+	p.last = p.Position
+
+	if p.Position.Y() < deathY {
+		p.IsDead = true
+	}
+	if p.IsDead {
+		in = Input{}
+		p.Flying = false
+	}
+
+	// Double-tapping jump starts or stops flying
+	pressed := in.Jump && !p.jumpHeld
+	p.jumpHeld = in.Jump
+	if pressed && p.tapped && g.ticks-p.tappedAt <= doubleTap {
+		p.Flying, p.tapped = !p.Flying, false
+	} else if pressed {
+		p.tapped, p.tappedAt = true, g.ticks
+	}
+
+	// Swimming while the body is in a liquid
+	swimming := !p.Flying && g.InLiquid(p.Position.Add(mgl32.Vec3{0, swimDepth, 0}))
+	p.Sneaking = in.Sneak && !p.Flying && !swimming
+	p.Sprinting = in.Sprint && in.Forward && !in.Back && !p.Sneaking && !swimming
+	m := p.movement(swimming)
+
+	// Horizontal movement, towards the speed of the mode the player is in
+	radYaw := p.Yaw * (math.Pi / 180.0)
+	forward := mgl32.Vec3{float32(math.Cos(radYaw)), 0, float32(math.Sin(radYaw))}
+	right := mgl32.Vec3{-forward.Z(), 0, forward.X()}
+	var wish mgl32.Vec3
+	if in.Forward {
+		wish = wish.Add(forward)
+	}
+	if in.Back {
+		wish = wish.Sub(forward)
+	}
+	if in.Right {
+		wish = wish.Add(right)
+	}
+	if in.Left {
+		wish = wish.Sub(right)
+	}
+	if wish.Len() > 0 {
+		wish = wish.Normalize().Mul(m.speed)
+	}
+	accel := m.accel
+	if !p.OnGround && !p.Flying && !swimming {
+		accel = airAccel
+	}
+	vel := approach(mgl32.Vec3{p.Velocity.X(), 0, p.Velocity.Z()}, wish, accel*Step)
+	p.Velocity = mgl32.Vec3{vel.X(), p.Velocity.Y(), vel.Z()}
+
+	// Flying up and down, jumping, or swimming up
+	switch {
+	case p.Flying:
+		var up float32
+		if in.Jump {
+			up += flyUpSpeed
+		}
+		if in.Sneak {
+			up -= flyUpSpeed
+		}
+		vy := approach(mgl32.Vec3{0, p.Velocity.Y(), 0}, mgl32.Vec3{0, up, 0}, m.accel*Step)
+		p.Velocity = mgl32.Vec3{p.Velocity.X(), vy.Y(), p.Velocity.Z()}
+	case in.Jump && swimming:
+		up := min(p.Velocity.Y()+swimAccel*Step, swimUpSpeed)
+		p.Velocity = mgl32.Vec3{p.Velocity.X(), up, p.Velocity.Z()}
+	case in.Jump && p.OnGround:
+		p.Velocity = mgl32.Vec3{p.Velocity.X(), jumpSpeed, p.Velocity.Z()}
+		p.OnGround = false
+	}
+
+	// Gravity, unless flying or the ground under the player is not loaded
+	// yet. Liquids hold the player up and slow sinking and rising alike
+	if !g.World.Contains(BlockAt(p.Position)) {
+		p.Velocity = mgl32.Vec3{p.Velocity.X(), 0, p.Velocity.Z()}
+	} else if !p.Flying {
+		fall := float32(gravity)
+		if swimming {
+			fall *= 1 - buoyancy
+		}
+		p.Velocity = p.Velocity.Sub(mgl32.Vec3{0, fall * Step, 0})
+		if swimming {
+			drag := float32(math.Exp(-liquidDrag * Step))
+			p.Velocity = mgl32.Vec3{p.Velocity.X(), p.Velocity.Y() * drag, p.Velocity.Z()}
+		}
+	}
+
+	// Sneaking stops at the edge of what the player stands on
+	delta := p.Velocity.Mul(Step)
+	if p.Sneaking && p.OnGround {
+		delta = g.keepOnLedge(p.Position, delta)
+		if delta.X() == 0 {
+			p.Velocity = mgl32.Vec3{0, p.Velocity.Y(), p.Velocity.Z()}
+		}
+		if delta.Z() == 0 {
+			p.Velocity = mgl32.Vec3{p.Velocity.X(), p.Velocity.Y(), 0}
+		}
+	}
+
+	// Move, sliding along walls, climbing ledges and stopping on floors
+	// and ceilings. Landing ends flying
+	var contacts physics.Contacts
+	p.Position, contacts = physics.Move(g.World, g.Registry, PlayerBody, p.Position, delta, p.OnGround)
+	p.OnGround = contacts.Ground
+	if contacts.Ground {
+		p.Flying = false
+	}
+	if contacts.Ground || contacts.Ceiling {
+		p.Velocity = mgl32.Vec3{p.Velocity.X(), 0, p.Velocity.Z()}
+	}
+	if contacts.WallX {
+		p.Velocity = mgl32.Vec3{0, p.Velocity.Y(), p.Velocity.Z()}
+	}
+	if contacts.WallZ {
+		p.Velocity = mgl32.Vec3{p.Velocity.X(), p.Velocity.Y(), 0}
+	}
+}
+
+// movement returns how the player moves now.
+func (p *Player) movement(swimming bool) movement {
+	switch {
+	case p.Flying && p.Sprinting:
+		return flyFast
+	case p.Flying:
+		return fly
+	case swimming:
+		return swim
+	case p.Sneaking:
+		return sneak
+	case p.Sprinting:
+		return sprint
+	}
+	return walk
+}
+
+// approach returns v moved towards target by at most step.
+func approach(v, target mgl32.Vec3, step float32) mgl32.Vec3 {
+	d := target.Sub(v)
+	if d.Len() <= step {
+		return target
+	}
+	return v.Add(d.Normalize().Mul(step))
+}
+
+// keepOnLedge cuts the parts of a move along X and Z that would take the
+// player at pos off the edge of what they stand on.
+func (g *Game) keepOnLedge(pos, delta mgl32.Vec3) mgl32.Vec3 {
+	if delta[0] != 0 && !g.supported(pos.Add(mgl32.Vec3{delta[0], 0, 0})) {
+		delta[0] = 0
+	}
+	if delta[2] != 0 && !g.supported(pos.Add(mgl32.Vec3{0, 0, delta[2]})) {
+		delta[2] = 0
+	}
+	if delta[0] != 0 && delta[2] != 0 && !g.supported(pos.Add(mgl32.Vec3{delta[0], 0, delta[2]})) {
+		delta[2] = 0
+	}
+	return delta
+}
+
+// supported reports whether the player at pos would have something to
+// stand on no more than a step below their feet.
+func (g *Game) supported(pos mgl32.Vec3) bool {
+	_, c := physics.Move(g.World, g.Registry, PlayerBody, pos, mgl32.Vec3{0, -PlayerBody.StepHeight, 0}, false)
+	return c.Ground
+}
+
+// InLiquid reports whether a point is under the surface of a liquid. The
+// surface is lower than the top of the block unless more liquid is above,
+// as drawn by the mesher.
+func (g *Game) InLiquid(p mgl32.Vec3) bool {
+	b := BlockAt(p)
+	state := g.World.GetBlock(b)
+	surface := g.Registry.Surface(state)
+	if surface == 0 {
+		return false
+	}
+	if g.Registry.Get(g.World.GetBlock(world.BlockPos{X: b.X, Y: b.Y + 1, Z: b.Z})) == g.Registry.Get(state) {
+		surface = 1
+	}
+	return p.Y()-(float32(b.Y)-0.5) < surface
+}
+
+// BlockAt returns the block a point is in; blocks are centred on integer
+// coordinates.
+func BlockAt(p mgl32.Vec3) world.BlockPos {
+	return world.BlockPos{
+		X: int(math.Round(float64(p.X()))),
+		Y: int(math.Round(float64(p.Y()))),
+		Z: int(math.Round(float64(p.Z()))),
+	}
+}
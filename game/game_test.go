@@ -0,0 +1,309 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+// testWorld is a world with a rock floor at y=0, whose top is at 0.5, and
+// nothing loaded at x < -20.
+type testWorld struct {
+	*world.World
+}
+
+func (testWorld) Contains(p world.BlockPos) bool {
+	return p.X >= -20
+}
+
+func newGame(t *testing.T) *Game {
+	t.Helper()
+	reg, err := block.Load("../blocks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := world.New()
+	for x := -8; x <= 8; x++ {
+		for z := -8; z <= 8; z++ {
+			w.SetBlock(world.BlockPos{X: x, Y: 0, Z: z}, reg.ID("rock"))
+		}
+	}
+	g := New(testWorld{w}, reg)
+	g.Player.Teleport(mgl32.Vec3{0, 3, 0})
+	return g
+}
+
+func TestAdvance(t *testing.T) {
+	g := newGame(t)
+	if n := g.Advance(Step/2, Input{}); n != 0 || g.Alpha() != 0.5 {
+		t.Errorf("half a tick: %d ticks, alpha %v", n, g.Alpha())
+	}
+	if n := g.Advance(Step*2, Input{}); n != 2 || g.Ticks() != 2 {
+		t.Errorf("two more ticks: ran %d, %d in all", n, g.Ticks())
+	}
+	if a := g.Alpha(); a < 0.49 || a > 0.51 {
+		t.Errorf("alpha = %v, want 0.5", a)
+	}
+	// A stall runs MaxTicks and drops the rest
+	if n := g.Advance(10, Input{}); n != MaxTicks || g.Alpha() != 0 {
+		t.Errorf("after a stall: %d ticks, alpha %v", n, g.Alpha())
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	g := newGame(t)
+	g.Tick(Input{})
+	before, after := mgl32.Vec3{0, 3, 0}, g.Player.Position
+	if before == after {
+		t.Fatal("the player did not fall")
+	}
+	if got := g.Player.At(0); got != before {
+		t.Errorf("At(0) = %v, want %v", got, before)
+	}
+	if got := g.Player.At(1); got != after {
+		t.Errorf("At(1) = %v, want %v", got, after)
+	}
+	g.Player.Teleport(mgl32.Vec3{5, 5, 5})
+	if got := g.Player.At(0.5); got != (mgl32.Vec3{5, 5, 5}) {
+		t.Errorf("At(0.5) after a teleport = %v", got)
+	}
+}
+
+func TestFrameRate(t *testing.T) {
+	// The same input gives the same player after the same ticks, whatever
+	// the frames
+	in := Input{Forward: true, Right: true, Jump: true}
+	walk := func(frames int, frame float64) Player {
+		g := newGame(t)
+		for range frames {
+			g.Advance(frame, in)
+		}
+		for g.Ticks() < TickRate {
+			g.Tick(in)
+		}
+		return g.Player
+	}
+	slow, fast := walk(TickRate/2, 2*Step), walk(TickRate*3, Step/3)
+	if slow != fast {
+		t.Errorf("players differ:\n%+v\n%+v", slow, fast)
+	}
+}
+
+func TestFalls(t *testing.T) {
+	g := newGame(t)
+	for range TickRate {
+		g.Tick(Input{})
+	}
+	if !g.Player.OnGround || g.Player.Position != (mgl32.Vec3{0, 0.5, 0}) {
+		t.Errorf("player at %v, on ground %v; want standing on the floor", g.Player.Position, g.Player.OnGround)
+	}
+
+	// Not where nothing is loaded
+	g.Player.Teleport(mgl32.Vec3{-30, 3, 0})
+	g.Tick(Input{})
+	if g.Player.Position != (mgl32.Vec3{-30, 3, 0}) {
+		t.Errorf("player at %v, want held up", g.Player.Position)
+	}
+}
+
+func TestWalks(t *testing.T) {
+	// Facing -Z
+	cases := []struct {
+		name string
+		in   Input
+		want mgl32.Vec3
+	}{
+		{"forward", Input{Forward: true}, mgl32.Vec3{0, 0, -walk.speed}},
+		{"back", Input{Back: true}, mgl32.Vec3{0, 0, walk.speed}},
+		{"strafe right", Input{Right: true}, mgl32.Vec3{walk.speed, 0, 0}},
+		{"strafe left", Input{Left: true}, mgl32.Vec3{-walk.speed, 0, 0}},
+		{"diagonally", Input{Forward: true, Left: true}, mgl32.Vec3{-1, 0, -1}.Normalize().Mul(walk.speed)},
+		{"sprint", Input{Forward: true, Sprint: true}, mgl32.Vec3{0, 0, -sprint.speed}},
+		{"sprint backwards", Input{Back: true, Sprint: true}, mgl32.Vec3{0, 0, walk.speed}},
+		{"sneak", Input{Forward: true, Sneak: true}, mgl32.Vec3{0, 0, -sneak.speed}},
+		{"sneak and sprint", Input{Forward: true, Sneak: true, Sprint: true}, mgl32.Vec3{0, 0, -sneak.speed}},
+		{"stand", Input{}, mgl32.Vec3{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := newGame(t)
+			g.Player.Teleport(mgl32.Vec3{0, 0.5, 0})
+			g.Player.OnGround = true
+			for range TickRate / 4 {
+				g.Tick(c.in)
+			}
+			if v := g.Player.Velocity; !v.ApproxEqualThreshold(c.want, 1e-4) {
+				t.Errorf("velocity %v, want %v", v, c.want)
+			}
+			moved := g.Player.Position.Sub(mgl32.Vec3{0, 0.5, 0})
+			if c.want != (mgl32.Vec3{}) && moved.Dot(c.want) <= 0 {
+				t.Errorf("moved by %v, want along %v", moved, c.want)
+			}
+		})
+	}
+}
+
+func TestAccelerates(t *testing.T) {
+	g := newGame(t)
+	g.Player.Teleport(mgl32.Vec3{0, 0.5, 0})
+	g.Player.OnGround = true
+	g.Tick(Input{Forward: true})
+	if v := -g.Player.Velocity.Z(); v <= 0 || v >= walk.speed {
+		t.Errorf("speed after a tick = %v, want between 0 and %v", v, walk.speed)
+	}
+	// And stops, without going back
+	for range TickRate / 4 {
+		g.Tick(Input{})
+		if g.Player.Velocity.Z() > 0 {
+			t.Fatalf("velocity %v while stopping", g.Player.Velocity)
+		}
+	}
+	if g.Player.Velocity != (mgl32.Vec3{}) {
+		t.Errorf("velocity %v, want stopped", g.Player.Velocity)
+	}
+}
+
+func TestSneakStopsAtLedges(t *testing.T) {
+	g := newGame(t)
+	// The floor ends at z=-8.5, its edge; a slab-high step down is fine
+	g.Player.Teleport(mgl32.Vec3{0, 0.5, -6})
+	g.Player.OnGround = true
+	for range 2 * TickRate {
+		g.Tick(Input{Forward: true, Left: true, Sneak: true})
+	}
+	p := g.Player
+	if !p.OnGround || p.Position.Y() != 0.5 {
+		t.Fatalf("player at %v, on ground %v; want on the floor", p.Position, p.OnGround)
+	}
+	if z := p.Position.Z(); z > -8.5 || z < -8.5-PlayerBody.HalfWidth {
+		t.Errorf("player at z %v, want hanging over the edge at -8.5", z)
+	}
+	if p.EyeHeight() != SneakEyeHeight {
+		t.Errorf("eye height %v, want %v", p.EyeHeight(), SneakEyeHeight)
+	}
+
+	// Without sneaking they fall off
+	for range TickRate / 2 {
+		g.Tick(Input{Forward: true})
+	}
+	if g.Player.Position.Y() >= 0.5 || g.Player.EyeHeight() != EyeHeight {
+		t.Errorf("player at %v, eye height %v; want falling, standing up", g.Player.Position, g.Player.EyeHeight())
+	}
+}
+
+func TestFly(t *testing.T) {
+	g := newGame(t)
+	g.Player.Teleport(mgl32.Vec3{0, 0.5, 0})
+	g.Player.OnGround = true
+	tap := func() {
+		g.Tick(Input{Jump: true})
+		g.Tick(Input{})
+	}
+
+	// A single press jumps
+	tap()
+	for range doubleTap + 1 {
+		g.Tick(Input{})
+	}
+	if g.Player.Flying {
+		t.Fatal("flying after a single tap")
+	}
+	for range TickRate {
+		g.Tick(Input{})
+	}
+
+	// Two quick ones fly, rising while jump is held
+	tap()
+	tap()
+	if !g.Player.Flying {
+		t.Fatal("not flying after a double tap")
+	}
+	for range TickRate {
+		g.Tick(Input{Jump: true})
+	}
+	high := g.Player.Position.Y()
+	if high < 3 {
+		t.Errorf("flew up to %v", high)
+	}
+	// Hovering
+	for range TickRate {
+		g.Tick(Input{})
+	}
+	if y := g.Player.Position.Y(); y < high || y > high+1 {
+		t.Errorf("hovering at %v, up from %v", y, high)
+	}
+	if y := g.Player.Velocity.Y(); y != 0 {
+		t.Errorf("vertical speed %v hovering", y)
+	}
+	// Fast, sprinting
+	for range TickRate {
+		g.Tick(Input{Forward: true, Sprint: true})
+	}
+	if v := g.Player.Velocity; !v.ApproxEqualThreshold(mgl32.Vec3{0, 0, -flyFast.speed}, 1e-4) {
+		t.Errorf("velocity %v flying fast", v)
+	}
+
+	// Double-tapping again falls
+	tap()
+	tap()
+	if g.Player.Flying {
+		t.Error("still flying after another double tap")
+	}
+
+	// Landing stops flying too
+	g.Player.Teleport(mgl32.Vec3{0, 2, 0})
+	tap()
+	tap()
+	for range 2 * TickRate {
+		g.Tick(Input{Sneak: true})
+	}
+	if g.Player.Flying || !g.Player.OnGround {
+		t.Errorf("player %+v, want landed", g.Player)
+	}
+}
+
+func TestDies(t *testing.T) {
+	g := newGame(t)
+	g.Player.Teleport(mgl32.Vec3{0, deathY - 1, 0})
+	g.Tick(Input{Forward: true})
+	if !g.Player.IsDead || g.Player.Velocity.X() != 0 || g.Player.Velocity.Z() != 0 {
+		t.Errorf("player %+v, want dead and not walking", g.Player)
+	}
+}
+
+func TestFluids(t *testing.T) {
+	g := newGame(t)
+	p := world.BlockPos{Y: 1, Z: 5}
+	g.World.SetBlock(p, g.Registry.ID("water"))
+	g.Fluids.Changed(p)
+	// Liquids flow a block every FlowDelay fluid ticks
+	for range 3 * TickRate {
+		g.Tick(Input{})
+	}
+	next := world.BlockPos{X: 1, Y: 1, Z: 5}
+	if state := g.World.GetBlock(next); g.Registry.Get(state).Level(state) != 1 {
+		t.Errorf("next to the source: %s, want level 1", g.Registry.StateName(state))
+	}
+}
+
+// counter counts its ticks and the game ticks it sees.
+type counter struct {
+	ticks []int64
+}
+
+func (c *counter) Tick(g *Game) {
+	c.ticks = append(c.ticks, g.Ticks())
+}
+
+func TestEntities(t *testing.T) {
+	g := newGame(t)
+	c := &counter{}
+	g.Entities = append(g.Entities, c)
+	g.Advance(3*Step+Step/2, Input{})
+	if len(c.ticks) != 3 || c.ticks[0] != 0 || c.ticks[2] != 2 {
+		t.Errorf("entity ticked on %v, want 0, 1, 2", c.ticks)
+	}
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
-	_ "image/png"
+	"image/png"
 	"log"
 	"math"
 	"os"
@@ -14,6 +15,17 @@ import (
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/go-gl/mathgl/mgl32"
+
+	"craft3d/atlas"
+	"craft3d/block"
+	"craft3d/game"
+	"craft3d/mesh"
+	"craft3d/prefab"
+	"craft3d/raycast"
+	"craft3d/save"
+	"craft3d/stream"
+	"craft3d/world"
+	"craft3d/worldgen"
 )
 
 const (
@@ -27,70 +39,48 @@ var (
 		#version 410
 		in vec3 vp;
 		in vec2 vertTexCoord;
+		in vec4 vertTile;
+		in vec4 vertColor;
 		out vec2 fragTexCoord;
+		out vec4 fragTile;
+		out vec4 fragColor;
+		out float fragDistance;
 		uniform mat4 mvp;
 		void main() {
 				fragTexCoord = vertTexCoord;
+				fragTile = vertTile;
+				fragColor = vertColor;
 					gl_Position = mvp * vec4(vp, 1.0);
+				fragDistance = gl_Position.w; // Distance along the view
 			}
 		` + "\x00"
 
 	fragmentShaderSource = `
 		#version 410
 		in vec2 fragTexCoord;
+		in vec4 fragTile;
+		in vec4 fragColor;
+		in float fragDistance;
 		out vec4 frag_colour;
 		uniform sampler2D tex;
 		uniform vec4 colorTint; 
+		uniform float alphaCutoff;
+		uniform vec3 fogColor;
+		uniform float fogDensity; // 0 for no fog
 		void main() {
-				vec4 texColor = texture(tex, fragTexCoord);
-						frag_colour = texColor * colorTint;
+				// Repeat the texture inside its atlas tile
+				vec2 uv = fragTile.xy + fract(fragTexCoord) * fragTile.zw;
+				vec4 texColor = texture(tex, uv);
+				if (texColor.a < alphaCutoff) {
+					discard; // Holes in leaves and plants
+				}
+						frag_colour = texColor * fragColor * colorTint;
+				float fog = 1.0 - exp(-fogDensity * fragDistance);
+				frag_colour.rgb = mix(frag_colour.rgb, fogColor, fog);
 						}
 					` + "\x00"
 )
 
-// X, Y, Z, U, V
-var cubeVertices = []float32{
-	// Front
-	-0.5, -0.5, 0.5, 0.0, 0.0,
-	0.5, -0.5, 0.5, 1.0, 0.0,
-	0.5, 0.5, 0.5, 1.0, 1.0,
-	-0.5, 0.5, 0.5, 0.0, 1.0,
-	// Back
-	-0.5, -0.5, -0.5, 1.0, 0.0,
-	0.5, -0.5, -0.5, 0.0, 0.0,
-	0.5, 0.5, -0.5, 0.0, 1.0,
-	-0.5, 0.5, -0.5, 1.0, 1.0,
-	// Top
-	-0.5, 0.5, 0.5, 0.0, 0.0,
-	0.5, 0.5, 0.5, 1.0, 0.0,
-	0.5, 0.5, -0.5, 1.0, 1.0,
-	-0.5, 0.5, -0.5, 0.0, 1.0,
-	// Bottom
-	-0.5, -0.5, 0.5, 0.0, 1.0,
-	0.5, -0.5, 0.5, 1.0, 1.0,
-	0.5, -0.5, -0.5, 1.0, 0.0,
-	-0.5, -0.5, -0.5, 0.0, 0.0,
-	// Right
-	0.5, -0.5, 0.5, 0.0, 0.0,
-	0.5, -0.5, -0.5, 1.0, 0.0,
-	0.5, 0.5, -0.5, 1.0, 1.0,
-	0.5, 0.5, 0.5, 0.0, 1.0,
-	// Left
-	-0.5, -0.5, 0.5, 1.0, 0.0,
-	-0.5, -0.5, -0.5, 0.0, 0.0,
-	-0.5, 0.5, -0.5, 0.0, 1.0,
-	-0.5, 0.5, 0.5, 1.0, 1.0,
-}
-
-var cubeIndices = []uint32{
-	0, 1, 2, 2, 3, 0, // Front
-	6, 5, 4, 4, 7, 6, // Back
-	8, 9, 10, 10, 11, 8, // Top
-	14, 13, 12, 12, 15, 14, // Bottom
-	16, 17, 18, 18, 19, 16, // Right
-	22, 21, 20, 20, 23, 22, // Left
-}
-
 // 2D Quad for UI
 var quadVertices = []float32{
 	// x, y, z, u, v
@@ -101,96 +91,186 @@ var quadVertices = []float32{
 }
 var quadIndices = []uint32{0, 1, 2, 2, 3, 0}
 
-type BlockPos struct {
-	X, Y, Z int
-}
+// The view under water.
+var (
+	skyColor        = mgl32.Vec3{0.53, 0.81, 0.92}
+	underwaterColor = mgl32.Vec3{0.1, 0.25, 0.45}
+	underwaterTint  = mgl32.Vec4{0.3, 0.5, 1.0, 0.3}
+)
 
-type Player struct {
-	Position mgl32.Vec3
-	Velocity mgl32.Vec3
-	Yaw      float64
-	Pitch    float64
-	OnGround bool
-	IsDead   bool
-}
+const underwaterFog = 0.12 // Fog density, per block
 
+// Vertical field of view, in degrees, widened while sprinting.
 const (
-	gravity       = 25.0
-	jumpSpeed     = 8.0
-	moveSpeed     = 10.0
-	rotationSpeed = 100.0
+	baseFOV   = 45.0
+	sprintFOV = 1.15 // Times baseFOV
+	fovEase   = 10.0 // Rate the field of view changes at, per second
 )
 
 var (
-	player = Player{
-		Position: mgl32.Vec3{0, 10, 0}, // Start higher to avoid terrain
-		Velocity: mgl32.Vec3{0, 0, 0},
-		Yaw:      -90.0, // Face forward (-Z)
-		Pitch:    0.0,
-	}
+	// The player, liquids and entities, ticked game.TickRate times a
+	// second
+	simulation *game.Game
+	player     *game.Player
+
+	// How far away blocks can be broken and placed, see -reach
+	reach float32
 
 	lastMouseX = 0.0
 	lastMouseY = 0.0
 	firstMouse = true
 
-	// Map stores Type ID (1-based)
-	blocks = make(map[BlockPos]int)
+	// The cursor is hidden and moving the mouse looks around, until
+	// Escape releases it; clicking in the window captures it again
+	mouseCaptured bool
 
+	// World stores Type ID (1-based, 0 is air)
+	gameWorld = world.New()
+	worldSeed int64
+	biomes    worldgen.BiomeSource // Nil if the generator has no biomes
+
+	// Loads and unloads the chunks around the player, see -view-distance
+	chunkStreamer *stream.Streamer
+
+	// Where the world is saved, see -world and saveGame
+	saveDir    *save.Dir
+	worldLevel *save.Level
+	gameTime   float64 // Seconds played in this world
+
+	// Block types, loaded from blocks.json
+	blockRegistry    *block.Registry
+	hotbar           []*block.Block
 	currentBlockType = 1
-	blockColors      = []mgl32.Vec4{
-		{1.0, 1.0, 1.0, 1.0}, // 1: Sand
-		{1.0, 1.0, 1.0, 1.0}, // 2: Rock
-		{1.0, 1.0, 1.0, 1.0}, // 3: Grass
-		{1.0, 1.0, 1.0, 1.0}, // 4: Dirt
-		{1.0, 1.0, 1.0, 1.0}, // 5: Water
-	}
-
-	gameOverTexture uint32
-	texDirt         uint32
-	texGrassTop     uint32
-	texGrassSide    uint32
-	texRock         uint32
-	texWater        uint32
-	texSand         uint32
+
+	gameOverTexture  uint32
+	crosshairTexture uint32
+
+	// Every block texture packed in one image, see atlas.Load
+	blockAtlas   *atlas.Atlas
+	atlasTexture uint32
 )
 
 func main() {
+	mesher := flag.String("mesher", "naive", "chunk mesher: naive or greedy (toggle with G)")
+	dumpAtlas := flag.String("dump-atlas", "", "write the texture atlas to this PNG file")
+	generatorName := flag.String("generator", "noise", fmt.Sprintf("terrain generator %v", worldgen.Names()))
+	seed := flag.Int64("seed", 0, "world seed")
+	dumpSlice := flag.String("dump-slice", "", "write a vertical cross-section of the terrain to this PNG file")
+	sliceZ := flag.Int("slice-z", 0, "z of the cross-section written by -dump-slice")
+	viewDistance := flag.Int("view-distance", 6, "load chunks within this many chunks of the player")
+	workers := flag.Int("workers", max(1, runtime.NumCPU()-1), "chunk generation goroutines")
+	flag.IntVar(&meshBudget, "mesh-budget", meshBudget, "chunk meshes built and uploaded per frame")
+	worldDir := flag.String("world", "saves/default", "directory the world is saved in")
+	autosave := flag.Float64("autosave", 30, "seconds between automatic saves, 0 to save only on exit")
+	reachBlocks := flag.Float64("reach", 6, "how far away blocks can be broken and placed")
+	flag.Parse()
+	reach = float32(*reachBlocks)
+
 	fmt.Println("LOLOLOL")
 
 	runtime.LockOSThread()
 	runtime.LockOSThread()
 
-	// Generate Irregular Terrain
-	waterLevel := -1
-
-	for x := -50; x <= 50; x++ {
-		for z := -50; z <= 50; z++ {
-			// Simple wave function
-			h := int(float64(4.0) * (math.Sin(float64(x)*0.1) + math.Cos(float64(z)*0.1)))
-
-			// Fill from bottom up to height
-			for y := -5; y <= h; y++ {
-				// Determine color based on height
-				blockType := 1 // Sand default
-				if y == h {
-					// Surface block
-					if y <= waterLevel+1 {
-						blockType = 1 // Sand (Shore/Seabed)
-					} else {
-						blockType = 3 // Grass
-					}
-				} else if y < -2 {
-					blockType = 2 // Rock deep down
-				} else {
-					blockType = 4 // Dirt in between
-				}
-				blocks[BlockPos{x, y, z}] = blockType
-			}
+	var err error
+	blockRegistry, err = block.Load("blocks.json")
+	if err != nil {
+		log.Fatalln("failed to load block definitions:", err)
+	}
+	if _, ok := mesh.Meshers[*mesher]; !ok {
+		log.Fatalf("unknown mesher %q", *mesher)
+	}
+	chunkMesherName, chunkMesher = *mesher, mesh.Meshers[*mesher]
+	simulation = game.New(loadedWorld{gameWorld}, blockRegistry)
+	player = &simulation.Player
+	player.Teleport(mgl32.Vec3{0, 10, 0}) // Start higher to avoid terrain
 
-			// Fill Water
-			for y := h + 1; y <= waterLevel; y++ {
-				blocks[BlockPos{x, y, z}] = 5 // Water
-			}
+	blockAtlas, err = atlas.Load("textures", blockRegistry.Textures()...)
+	if err != nil {
+		log.Fatalln("failed to build texture atlas:", err)
+	}
+	if *dumpAtlas != "" {
+		if err := blockAtlas.SavePNG(*dumpAtlas); err != nil {
+			log.Fatalln("failed to write texture atlas:", err)
+		}
+		fmt.Printf("Texture atlas written to %s\n", *dumpAtlas)
+	}
+
+	hotbar = blockRegistry.Hotbar()
+	if len(hotbar) > 0 {
+		currentBlockType = hotbar[0].ID
+	}
+
+	// Open the saved world, or start a new one with the seed and generator
+	// from the command line
+	saveDir, err = save.Open(*worldDir, blockRegistry)
+	if err != nil {
+		log.Fatalln("failed to open world:", err)
+	}
+	worldLevel, err = saveDir.LoadLevel()
+	if err != nil {
+		log.Fatalln("failed to load world:", err)
+	}
+	newWorld := worldLevel == nil
+	if newWorld {
+		worldLevel = &save.Level{Seed: *seed, Generator: *generatorName}
+	} else {
+		fmt.Printf("Loading world %s (seed %d, %s terrain)\n", *worldDir, worldLevel.Seed, worldLevel.Generator)
+	}
+	gameTime = worldLevel.Time
+
+	// Generate Terrain
+	gen, err := worldgen.New(worldLevel.Generator, blockRegistry)
+	if err != nil {
+		log.Fatalln("failed to create terrain generator:", err)
+	}
+	if src, ok := gen.(worldgen.SurfaceSource); ok {
+		prefabs, err := prefab.LoadDir("prefabs", blockRegistry, worldgen.BiomeNames())
+		if err != nil {
+			log.Fatalln("failed to load prefabs:", err)
+		}
+		gen = worldgen.Decorate(src, prefabs)
+	}
+	worldSeed = worldLevel.Seed
+	biomes, _ = gen.(worldgen.BiomeSource)
+	if *dumpSlice != "" {
+		if err := saveSlice(gen, *dumpSlice, *sliceZ); err != nil {
+			log.Fatalln("failed to write terrain slice:", err)
+		}
+		fmt.Printf("Terrain slice at z=%d written to %s\n", *sliceZ, *dumpSlice)
+	}
+	saved, err := saveDir.LoadPlayer()
+	if err != nil {
+		log.Fatalln("failed to load player:", err)
+	}
+	if saved != nil {
+		player.Teleport(saved.Position)
+		player.Velocity, player.Flying = saved.Velocity, saved.Flying
+		player.Yaw, player.Pitch = saved.Yaw, saved.Pitch
+		if saved.Slot >= 0 && saved.Slot < len(hotbar) {
+			currentBlockType = hotbar[saved.Slot].ID
+		}
+	}
+
+	chunkStreamer = stream.New(gameWorld, gen, worldSeed, saveDir, *viewDistance, *workers)
+	defer func() {
+		// Unloading saves the edited chunks, then everything is written
+		if err := chunkStreamer.Close(); err != nil {
+			log.Println("failed to save chunks:", err)
+		}
+		if err := saveGame(); err != nil {
+			log.Println("failed to save world:", err)
+		}
+	}()
+	if err := chunkStreamer.Preload(world.ChunkPosOf(game.BlockAt(player.Position)), 1); err != nil {
+		log.Println("chunk streaming:", err)
+	}
+
+	if newWorld {
+		// Stand on top of the terrain at the origin
+		worldLevel.Spawn = mgl32.Vec3{0, float32(surfaceY(0, 0)) + 0.5, 0}
+		player.Teleport(worldLevel.Spawn)
+		if err := saveGame(); err != nil {
+			log.Fatalln("failed to save world:", err)
 		}
 	}
 
@@ -215,6 +295,7 @@ func main() {
 	window.SetMouseButtonCallback(mouseButtonCallback)
 	window.SetCursorPosCallback(cursorPosCallback)
 	window.SetKeyCallback(keyCallback)
+	captureMouse(window)
 
 	if err := gl.Init(); err != nil {
 		panic(err)
@@ -234,31 +315,10 @@ func main() {
 	// 	panic(err)
 	// }
 
-	// Load Textures
-	texDirt, err = loadTexture("dirt.png")
-	if err != nil {
-		fmt.Printf("Failed to load dirt.png: %v\n", err)
-	}
-	texGrassTop, err = loadTexture("grass_top.png")
-	if err != nil {
-		fmt.Printf("Failed to load grass_top.png: %v\n", err)
-	}
-	texGrassSide, err = loadTexture("grass_side.png")
-	if err != nil {
-		fmt.Printf("Failed to load grass_side.png: %v\n", err)
-	}
-	texRock, err = loadTexture("rock.png")
-	if err != nil {
-		fmt.Printf("Failed to load rock.png: %v\n", err)
-	}
-	texWater, err = loadTexture("water.png")
-	if err != nil {
-		fmt.Printf("Failed to load water.png: %v\n", err)
-	}
-	texSand, err = loadTexture("sand.png")
-	if err != nil {
-		fmt.Printf("Failed to load sand.png: %v\n", err)
-	}
+	// Block textures (atlas)
+	atlasTexture = newAtlasTexture(blockAtlas)
+
+	crosshairTexture = newCrosshairTexture()
 
 	// Game Over Texture
 	gameOverTexture, err = loadTexture("game_over.png")
@@ -268,27 +328,17 @@ func main() {
 	}
 
 	gl.ActiveTexture(gl.TEXTURE0)
-	gl.BindTexture(gl.TEXTURE_2D, texDirt)
 	gl.Uniform1i(gl.GetUniformLocation(program, gl.Str("tex\x00")), 0)
 
-	// Cube Mesh
-	var vaoCube, vboCube, eboCube uint32
-	gl.GenVertexArrays(1, &vaoCube)
-	gl.BindVertexArray(vaoCube)
-	gl.GenBuffers(1, &vboCube)
-	gl.BindBuffer(gl.ARRAY_BUFFER, vboCube)
-	gl.BufferData(gl.ARRAY_BUFFER, len(cubeVertices)*4, gl.Ptr(cubeVertices), gl.STATIC_DRAW)
-	gl.GenBuffers(1, &eboCube)
-	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, eboCube)
-	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(cubeIndices)*4, gl.Ptr(cubeIndices), gl.STATIC_DRAW)
-
-	stride := int32(5 * 4)
-	vertAttrib := uint32(gl.GetAttribLocation(program, gl.Str("vp\x00")))
-	gl.EnableVertexAttribArray(vertAttrib)
-	gl.VertexAttribPointer(vertAttrib, 3, gl.FLOAT, false, stride, gl.PtrOffset(0))
-	texCoordAttrib := uint32(gl.GetAttribLocation(program, gl.Str("vertTexCoord\x00")))
-	gl.EnableVertexAttribArray(texCoordAttrib)
-	gl.VertexAttribPointer(texCoordAttrib, 2, gl.FLOAT, false, stride, gl.PtrOffset(12))
+	// Block meshes are built per chunk (see render.go)
+	vertAttrib = uint32(gl.GetAttribLocation(program, gl.Str("vp\x00")))
+	texCoordAttrib = uint32(gl.GetAttribLocation(program, gl.Str("vertTexCoord\x00")))
+	tileAttrib = uint32(gl.GetAttribLocation(program, gl.Str("vertTile\x00")))
+	colorAttrib = uint32(gl.GetAttribLocation(program, gl.Str("vertColor\x00")))
+	// The UI quad has no per-vertex colour or tile, so it reads these
+	// constants instead (see setQuadTile)
+	gl.VertexAttrib4f(colorAttrib, 1, 1, 1, 1)
+	setQuadTile(atlas.Full)
 
 	// UI Quad Mesh
 	var vaoQuad, vboQuad, eboQuad uint32
@@ -301,6 +351,7 @@ func main() {
 	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, eboQuad)
 	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(quadIndices)*4, gl.Ptr(quadIndices), gl.STATIC_DRAW)
 
+	stride := int32(5 * 4)
 	gl.EnableVertexAttribArray(vertAttrib)
 	gl.VertexAttribPointer(vertAttrib, 3, gl.FLOAT, false, stride, gl.PtrOffset(0))
 	gl.EnableVertexAttribArray(texCoordAttrib)
@@ -309,160 +360,94 @@ func main() {
 	// Shared Uniforms
 	mvpUniform := gl.GetUniformLocation(program, gl.Str("mvp\x00"))
 	tintUniform := gl.GetUniformLocation(program, gl.Str("colorTint\x00"))
+	cutoffUniform := gl.GetUniformLocation(program, gl.Str("alphaCutoff\x00"))
+	gl.Uniform1f(cutoffUniform, opaqueCutoff)
+	fogColorUniform := gl.GetUniformLocation(program, gl.Str("fogColor\x00"))
+	fogDensityUniform := gl.GetUniformLocation(program, gl.Str("fogDensity\x00"))
 
 	gl.Enable(gl.DEPTH_TEST)
 	gl.DepthFunc(gl.LESS)
 	gl.Enable(gl.CULL_FACE)
 	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
-	gl.Enable(gl.BLEND)                  // Enable blending globally
-	gl.ClearColor(0.53, 0.81, 0.92, 1.0) // Sky Blue
+	gl.Enable(gl.BLEND) // Enable blending globally
 
 	// Time tracking
 	lastTime := glfw.GetTime()
+	lastFrame, lastSave := lastTime, lastTime
 	frameCount := 0
+	fov := float32(baseFOV) // Vertical field of view, in degrees
 
 	for !window.ShouldClose() {
 		// Dynamic Window Size
 		fbWidth, fbHeight := window.GetFramebufferSize()
 		gl.Viewport(0, 0, int32(fbWidth), int32(fbHeight))
 
-		projection3D := mgl32.Perspective(mgl32.DegToRad(45.0), float32(fbWidth)/float32(fbHeight), 0.1, 100.0)
 		projection2D := mgl32.Ortho(0, float32(fbWidth), 0, float32(fbHeight), -1, 1)
 
 		currentTime := glfw.GetTime()
-		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 		gl.UseProgram(program)
 
-		// --- 3D Pass ---
-		// --- Physics & Movement ---
-		dt := currentTime - lastTime
-		if dt > 0.1 {
-			dt = 0.1 // Cap dt to avoid large jumps
-		}
-
-		// Death Check
-		if player.Position.Y() < -100.0 && !player.IsDead {
-			player.IsDead = true
-		}
-
-		// Input Handling
-		// Convert Yaw to Radians for math.Cos/Sin (takes float64)
-		radYaw := player.Yaw * (math.Pi / 180.0)
-		radPitch := player.Pitch * (math.Pi / 180.0)
-
-		forward := mgl32.Vec3{
-			float32(math.Cos(radYaw)),
-			0,
-			float32(math.Sin(radYaw)),
-		}
-		// right vector removed as unused for input
+		// The game runs in fixed ticks, as many as fit in the time since
+		// the last frame, with the keys held now
+		elapsed := currentTime - lastFrame
+		gameTime += elapsed
+		lastFrame = currentTime
 
-		// Horizontal Movement
-		vel := mgl32.Vec3{0, 0, 0}
-		if !player.IsDead {
-			if window.GetKey(glfw.KeyW) == glfw.Press {
-				vel = vel.Add(forward)
-			}
-			if window.GetKey(glfw.KeyS) == glfw.Press {
-				vel = vel.Sub(forward)
+		if *autosave > 0 && currentTime-lastSave >= *autosave {
+			if err := saveGame(); err != nil {
+				log.Println("autosave failed:", err)
 			}
-			if window.GetKey(glfw.KeyD) == glfw.Press {
-				player.Yaw += rotationSpeed * float64(dt)
-			}
-			if window.GetKey(glfw.KeyA) == glfw.Press {
-				player.Yaw -= rotationSpeed * float64(dt)
-			}
-		} else {
-			// Stop horizontal movement when dead
-			player.Velocity = mgl32.Vec3{0, player.Velocity.Y(), 0}
-		}
-
-		if vel.Len() > 0 {
-			vel = vel.Normalize().Mul(moveSpeed)
-			player.Velocity = mgl32.Vec3{vel.X(), player.Velocity.Y(), vel.Z()}
-		} else if !player.IsDead {
-			player.Velocity = mgl32.Vec3{0, player.Velocity.Y(), 0}
-		}
-
-		// Jumping
-		if !player.IsDead && window.GetKey(glfw.KeySpace) == glfw.Press && player.OnGround {
-			player.Velocity = mgl32.Vec3{player.Velocity.X(), jumpSpeed, player.Velocity.Z()}
-			player.OnGround = false
-		}
-
-		// Gravity
-		player.Velocity = player.Velocity.Sub(mgl32.Vec3{0, gravity * float32(dt), 0})
-
-		// Axis Separated Movement & Collision
-		// Y Axis
-		player.Position = player.Position.Add(mgl32.Vec3{0, player.Velocity.Y() * float32(dt), 0})
-		if checkCollision(player.Position) {
-			if player.Velocity.Y() < 0 {
-				// Falling down, hit floor
-				player.OnGround = true
-				// Snap to block top?
-				// Simple snap: Round position to nearest integer or just step back?
-				// To start simple: just undo movement
-				// But undoing movement is jittery.
-				// Proper way: Find the block we hit and snap to its top.
-				// But we are intersecting potentially multiple blocks.
-				// Let's iterate find the highest block floor we are in?
-				// Doing simple iterative resolution:
-				// If we are collided, move back until not collided? No.
-
-				// Let's assume integer grid.
-				// Player Height 2. Width 1. Depth 1.
-				// Feet at Y. Top at Y+2.
-				// If we hit something below, our Y is slightly inside a block.
-				// Floor is at int(Y) or similar.
-				// For now: reset Y to previous Y (simpler but might get stuck)
-				// Or better: round Y up to nearest integer if falling?
-				// Blocks are at integer coordinates. Top surface at BlockY + 0.5.
-
-				// Revert Y
-				player.Position = player.Position.Sub(mgl32.Vec3{0, player.Velocity.Y() * float32(dt), 0})
-
-				// Snap Y to nice value?
-				// If we hit floor at Y=-0.5, our feet should be at -0.5.
-				// For now let's just zero velocity and revert position.
-				// Improving logic:
-				// Snap to top of the block we hit. Which block?
-				// checkCollision just returns bool.
-				// Let's just Stop.
-				player.Velocity = mgl32.Vec3{player.Velocity.X(), 0, player.Velocity.Z()}
-			} else if player.Velocity.Y() > 0 {
-				// Jumping up, hit ceiling
-				player.Position = player.Position.Sub(mgl32.Vec3{0, player.Velocity.Y() * float32(dt), 0})
-				player.Velocity = mgl32.Vec3{player.Velocity.X(), 0, player.Velocity.Z()}
-			}
-		} else {
-			player.OnGround = false
+			lastSave = currentTime
 		}
 
-		// X Axis
-		player.Position = player.Position.Add(mgl32.Vec3{player.Velocity.X() * float32(dt), 0, 0})
-		if checkCollision(player.Position) {
-			player.Position = player.Position.Sub(mgl32.Vec3{player.Velocity.X() * float32(dt), 0, 0})
-			player.Velocity = mgl32.Vec3{0, player.Velocity.Y(), player.Velocity.Z()}
+		// Stream the chunks around the player
+		playerChunk := world.ChunkPosOf(game.BlockAt(player.Position))
+		if err := chunkStreamer.Update(playerChunk); err != nil {
+			log.Println("chunk streaming:", err)
 		}
 
-		// Z Axis
-		player.Position = player.Position.Add(mgl32.Vec3{0, 0, player.Velocity.Z() * float32(dt)})
-		if checkCollision(player.Position) {
-			player.Position = player.Position.Sub(mgl32.Vec3{0, 0, player.Velocity.Z() * float32(dt)})
-			player.Velocity = mgl32.Vec3{player.Velocity.X(), player.Velocity.Y(), 0}
+		simulation.Advance(elapsed, game.Input{
+			Forward: window.GetKey(glfw.KeyW) == glfw.Press,
+			Back:    window.GetKey(glfw.KeyS) == glfw.Press,
+			Left:    window.GetKey(glfw.KeyA) == glfw.Press,
+			Right:   window.GetKey(glfw.KeyD) == glfw.Press,
+			Jump:    window.GetKey(glfw.KeySpace) == glfw.Press,
+			Sprint:  window.GetKey(glfw.KeyLeftControl) == glfw.Press,
+			Sneak:   window.GetKey(glfw.KeyLeftShift) == glfw.Press,
+		})
+
+		// Sprinting widens the view, easing in and out
+		targetFOV := float32(baseFOV)
+		if player.Sprinting {
+			targetFOV *= sprintFOV
 		}
+		fov += (targetFOV - fov) * float32(min(1, elapsed*fovEase))
+		projection3D := mgl32.Perspective(mgl32.DegToRad(fov), float32(fbWidth)/float32(fbHeight), 0.1, 100.0)
 
 		// --- 3D Pass ---
 		gl.Enable(gl.DEPTH_TEST)
-		gl.BindVertexArray(vaoCube)
+
+		// Rebuild the meshes of chunks that changed, nearest first
+		updateChunkMeshes(playerChunk)
 
 		// Create Camera Matrix
-		// Camera at Position + EyeOffset (0, 1.5, 0)
-		eyePos := player.Position.Add(mgl32.Vec3{0, 1.5, 0})
+		// Camera at the eyes, drawn between the last two ticks
+		eyePos := player.At(simulation.Alpha()).Add(mgl32.Vec3{0, player.EyeHeight(), 0})
+
+		// Under water the view fades into murky blue
+		underwater := simulation.InLiquid(eyePos)
+		background, fog := skyColor, float32(0)
+		if underwater {
+			background, fog = underwaterColor, underwaterFog
+		}
+		gl.ClearColor(background.X(), background.Y(), background.Z(), 1)
+		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+		gl.Uniform3fv(fogColorUniform, 1, &background[0])
+		gl.Uniform1f(fogDensityUniform, fog)
 
 		// Look Direction
-		// Reuse radYaw/radPitch
+		radYaw := player.Yaw * (math.Pi / 180.0)
+		radPitch := player.Pitch * (math.Pi / 180.0)
 		front := mgl32.Vec3{
 			float32(math.Cos(radPitch) * math.Cos(radYaw)),
 			float32(math.Sin(radPitch)),
@@ -472,99 +457,26 @@ func main() {
 		camera := mgl32.LookAtV(eyePos, eyePos.Add(front), mgl32.Vec3{0, 1, 0})
 		vp := projection3D.Mul4(camera)
 
-		// Two passes: Opaque then Transparent (Water)
-		// Or just render water last.
-		// Since we iterate map, order is random.
-		// Construct lists first.
-		var opaqueBlocks []BlockPos
-		var waterBlocks []BlockPos
-
-		for pos, typeID := range blocks {
-			_ = typeID
-			// if typeID == 5 && false { // Water
-			// 	waterBlocks = append(waterBlocks, pos)
-			// } else {
-			// 	opaqueBlocks = append(opaqueBlocks, pos)
-			// }
-			opaqueBlocks = append(opaqueBlocks, pos)
-
-		}
-
-		drawBlock := func(pos BlockPos, typeID int) {
-			if typeID < 1 || typeID > len(blockColors) {
-				typeID = 1
-			}
-
-			model := mgl32.Translate3D(float32(pos.X), float32(pos.Y), float32(pos.Z))
-			mvp := vp.Mul4(model)
-			gl.UniformMatrix4fv(mvpUniform, 1, false, &mvp[0])
-
-			color := blockColors[typeID-1]
-			gl.Uniform4fv(tintUniform, 1, &color[0])
-
-			if typeID == 3 { // Grass (Multi-face)
-				// Top (Indices 12-17, but verify offset)
-				// Cube Indices:
-				// Front: 0-5 (0*6)
-				// Back: 6-11 (1*6)
-				// Top: 12-17 (2*6)
-				// Bottom: 18-23 (3*6)
-				// Right: 24-29 (4*6)
-				// Left: 30-35 (5*6)
-
-				// Top Face
-				gl.BindTexture(gl.TEXTURE_2D, texGrassTop)
-				gl.DrawElements(gl.TRIANGLES, 6, gl.UNSIGNED_INT, gl.PtrOffset(12*4)) // Start at index 12
-
-				// Bottom Face (Dirt)
-				gl.BindTexture(gl.TEXTURE_2D, texDirt)
-				gl.DrawElements(gl.TRIANGLES, 6, gl.UNSIGNED_INT, gl.PtrOffset(18*4))
-
-				// Sides (Grass Side)
-				gl.BindTexture(gl.TEXTURE_2D, texGrassSide)
-				// Front
-				gl.DrawElements(gl.TRIANGLES, 6, gl.UNSIGNED_INT, gl.PtrOffset(0))
-				// Back
-				gl.DrawElements(gl.TRIANGLES, 6, gl.UNSIGNED_INT, gl.PtrOffset(6*4))
-				// Right
-				gl.DrawElements(gl.TRIANGLES, 6, gl.UNSIGNED_INT, gl.PtrOffset(24*4))
-				// Left
-				gl.DrawElements(gl.TRIANGLES, 6, gl.UNSIGNED_INT, gl.PtrOffset(30*4))
-
-			} else {
-				// Standard Block
-				var typeTex uint32
-				switch typeID {
-				case 1:
-					typeTex = texSand
-				case 2:
-					typeTex = texRock
-				case 4:
-					typeTex = texDirt
-				case 5:
-					typeTex = texWater
-				default:
-					typeTex = texDirt
-				}
-				gl.BindTexture(gl.TEXTURE_2D, typeTex)
-				gl.DrawElements(gl.TRIANGLES, int32(len(cubeIndices)), gl.UNSIGNED_INT, gl.PtrOffset(0))
-			}
-		}
-
-		// Draw Opaque
-		for _, pos := range opaqueBlocks {
-			drawBlock(pos, blocks[pos])
-		}
-		// Draw Water
-		// Disable Depth Write for water? Usually helps with transparency against itself, but simple back-to-front is better.
-		// We don't have sorting, so just drawing last is best effort.
-		for _, pos := range waterBlocks {
-			drawBlock(pos, blocks[pos])
-		}
+		// One draw per chunk and biome tint, every texture comes from the
+		// atlas; translucent faces last
+		gl.BindTexture(gl.TEXTURE_2D, atlasTexture)
+		drawChunks(vp, eyePos, mvpUniform, tintUniform, cutoffUniform)
 
 		// --- 2D UI Pass (Hotbar & Game Over) ---
 		gl.Disable(gl.DEPTH_TEST)
 		gl.BindVertexArray(vaoQuad)
+		gl.Uniform1f(fogDensityUniform, 0)
+
+		if underwater {
+			// Tint the whole view
+			gl.BindTexture(gl.TEXTURE_2D, atlasTexture)
+			setAtlasQuadTile("water")
+			gl.Uniform4fv(tintUniform, 1, &underwaterTint[0])
+			model := mgl32.Scale3D(float32(fbWidth), float32(fbHeight), 1)
+			mvp := projection2D.Mul4(model)
+			gl.UniformMatrix4fv(mvpUniform, 1, false, &mvp[0])
+			gl.DrawElements(gl.TRIANGLES, int32(len(quadIndices)), gl.UNSIGNED_INT, gl.PtrOffset(0))
+		}
 
 		if player.IsDead {
 			// 1. Red Overlay
@@ -576,7 +488,8 @@ func main() {
 			// Or just disable texture? Our shader expects texture.
 			// Let's bind the standard block texture (it has white pixels) and set tint to Red with Alpha.
 			// Let's bind the standard block texture (it has white pixels) and set tint to Red with Alpha.
-			gl.BindTexture(gl.TEXTURE_2D, texRock) // Use Rock as background overlay pattern?
+			gl.BindTexture(gl.TEXTURE_2D, atlasTexture) // Use Rock as background overlay pattern?
+			setAtlasQuadTile("rock")
 
 			redOverlay := mgl32.Vec4{1.0, 0.0, 0.0, 0.5} // Red, 50% opacity
 			gl.Uniform4fv(tintUniform, 1, &redOverlay[0])
@@ -590,6 +503,7 @@ func main() {
 
 			// 2. "You Died" Text
 			gl.BindTexture(gl.TEXTURE_2D, gameOverTexture)
+			setQuadTile(atlas.Full)
 			whiteTint := mgl32.Vec4{1.0, 1.0, 1.0, 1.0}
 			gl.Uniform4fv(tintUniform, 1, &whiteTint[0])
 
@@ -617,26 +531,30 @@ func main() {
 			// Rebind standard texture for Hotbar (if we draw it? Maybe hide hotbar on death?)
 			// Let's hide hotbar.
 		} else {
-			// Draw 5 squares at bottom
-			// gl.BindTexture(gl.TEXTURE_2D, texture) // Rebind standard texture - NO, bind per icon
+			// Draw one square per hotbar block at bottom
+			gl.BindTexture(gl.TEXTURE_2D, atlasTexture) // Icons are tiles of the atlas
 
+			slots := float32(len(hotbar))
 			boxSize := float32(50.0)
 			padding := float32(10.0)
-			totalWidth := (boxSize * 5) + (padding * 4)
+			totalWidth := (boxSize * slots) + (padding * (slots - 1))
+			if fit := float32(fbWidth) * 0.95; totalWidth > fit {
+				// Shrink the slots to fit the window
+				boxSize *= fit / totalWidth
+				padding *= fit / totalWidth
+				totalWidth = fit
+			}
 			startX := (float32(fbWidth) - totalWidth) / 2
 			startY := float32(20.0)
 
-			for i := 0; i < 5; i++ {
-				typeID := i + 1
-				color := blockColors[i]
-
+			for i, def := range hotbar {
 				// Highlight selection
 				scale := float32(1.0)
-				if typeID == currentBlockType {
+				if def.ID == currentBlockType {
 					scale = 1.2
 				}
 
-				gl.Uniform4fv(tintUniform, 1, &color[0])
+				gl.Uniform4fv(tintUniform, 1, &def.Tint[0])
 
 				x := startX + float32(i)*(boxSize+padding)
 				y := startY
@@ -648,34 +566,38 @@ func main() {
 					y -= diff
 				}
 
-				// Bind Icon Texture
-				var iconTex uint32
-				switch typeID {
-				case 1:
-					iconTex = texSand
-				case 2:
-					iconTex = texRock
-				case 3:
-					iconTex = texGrassSide // Use side for icon
-				case 4:
-					iconTex = texDirt
-				case 5:
-					iconTex = texWater
-				}
-				gl.BindTexture(gl.TEXTURE_2D, iconTex)
+				// Select Icon Tile
+				setAtlasQuadTile(def.Icon)
 
 				model := mgl32.Translate3D(x, y, 0).Mul4(mgl32.Scale3D(boxSize*scale, boxSize*scale, 1))
 				mvp := projection2D.Mul4(model)
 				gl.UniformMatrix4fv(mvpUniform, 1, false, &mvp[0])
 				gl.DrawElements(gl.TRIANGLES, int32(len(quadIndices)), gl.UNSIGNED_INT, gl.PtrOffset(0))
 			}
+
+			// Crosshair at the centre of the view, where blocks are
+			// broken and placed
+			gl.BindTexture(gl.TEXTURE_2D, crosshairTexture)
+			setQuadTile(atlas.Full)
+			whiteTint := mgl32.Vec4{1.0, 1.0, 1.0, 1.0}
+			gl.Uniform4fv(tintUniform, 1, &whiteTint[0])
+			size := float32(crosshairSize * 2)
+			model := mgl32.Translate3D(float32(fbWidth/2)-size/2, float32(fbHeight/2)-size/2, 0).Mul4(mgl32.Scale3D(size, size, 1))
+			mvp := projection2D.Mul4(model)
+			gl.UniformMatrix4fv(mvpUniform, 1, false, &mvp[0])
+			gl.DrawElements(gl.TRIANGLES, int32(len(quadIndices)), gl.UNSIGNED_INT, gl.PtrOffset(0))
 		}
 
 		window.SwapBuffers()
 		// FPS Counter handled by frame counting
 		frameCount++
 		if currentTime-lastTime >= 1.0 {
-			window.SetTitle(fmt.Sprintf("%s - FPS: %d", title, frameCount))
+			status := fmt.Sprintf("%s - FPS: %d", title, frameCount)
+			if biomes != nil {
+				b := biomes.BiomeAt(worldSeed, int(math.Round(float64(player.Position.X()))), int(math.Round(float64(player.Position.Z()))))
+				status += " - " + b.Name
+			}
+			window.SetTitle(status)
 			frameCount = 0
 			lastTime = currentTime
 		}
@@ -684,17 +606,82 @@ func main() {
 	}
 }
 
-func performRaycast(w *glfw.Window) {
-	xpos, ypos := w.GetCursorPos()
-	fbWidth, fbHeight := w.GetFramebufferSize()
+// saveGame writes the edited chunks, the level and the player to saveDir.
+func saveGame() error {
+	for _, c := range gameWorld.TakeChanged() {
+		if err := saveDir.Save(c); err != nil {
+			return err
+		}
+	}
+	if err := saveDir.Flush(); err != nil {
+		return err
+	}
 
-	ndcX := (float32(xpos)/float32(fbWidth))*2 - 1
-	ndcY := 1 - (float32(ypos)/float32(fbHeight))*2
+	worldLevel.Time = gameTime
+	if err := saveDir.SaveLevel(worldLevel); err != nil {
+		return err
+	}
+	slot := 0
+	for i, b := range hotbar {
+		if b.ID == currentBlockType {
+			slot = i
+		}
+	}
+	return saveDir.SavePlayer(&save.Player{
+		Position: player.Position,
+		Velocity: player.Velocity,
+		Flying:   player.Flying,
+		Yaw:      player.Yaw,
+		Pitch:    player.Pitch,
+		Slot:     slot,
+	})
+}
 
-	projection := mgl32.Perspective(mgl32.DegToRad(45.0), float32(fbWidth)/float32(fbHeight), 0.1, 100.0)
-	// Raycast Update
-	// Need to recalculate View Matrix for raycast.
-	eyePos := player.Position.Add(mgl32.Vec3{0, 1.5, 0})
+// saveSlice writes the terrain cross-section at z to a PNG, 512 blocks wide
+// and centred on x=0. Blocks are drawn in the average colour of their side
+// texture.
+func saveSlice(gen worldgen.Generator, path string, z int) error {
+	colors := func(id int) color.RGBA {
+		b := blockRegistry.Get(id)
+		c := blockAtlas.Average(b.Textures.Side)
+		return color.RGBA{
+			uint8(float32(c.R) * b.Tint[0]),
+			uint8(float32(c.G) * b.Tint[1]),
+			uint8(float32(c.B) * b.Tint[2]),
+			255,
+		}
+	}
+	img := worldgen.Slice(gen, worldSeed, z, -256, 256, colors)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// surfaceY returns the y of the highest block in column x, z, or the bottom
+// of the world if the column is empty.
+func surfaceY(x, z int) int {
+	top := (worldgen.MaxChunkY+1)*world.ChunkSize - 1
+	bottom := worldgen.MinChunkY * world.ChunkSize
+	for y := top; y > bottom; y-- {
+		if gameWorld.HasBlock(world.BlockPos{X: x, Y: y, Z: z}) {
+			return y
+		}
+	}
+	return bottom
+}
+
+// performRaycast breaks or places the block at the centre of the view,
+// depending on the mouse button held.
+func performRaycast(w *glfw.Window) {
+	// From the eye as drawn
+	eyePos := player.At(simulation.Alpha()).Add(mgl32.Vec3{0, player.EyeHeight(), 0})
 
 	radYaw := player.Yaw * (math.Pi / 180.0)
 	radPitch := player.Pitch * (math.Pi / 180.0)
@@ -704,91 +691,110 @@ func performRaycast(w *glfw.Window) {
 		float32(math.Sin(radPitch)),
 		float32(math.Cos(radPitch) * math.Sin(radYaw)),
 	}
-	camera := mgl32.LookAtV(eyePos, eyePos.Add(front), mgl32.Vec3{0, 1, 0})
-
-	invVP := projection.Mul4(camera).Inv()
-
-	start := invVP.Mul4x1(mgl32.Vec4{ndcX, ndcY, -1, 1})
-	start = start.Mul(1.0 / start.W())
-	end := invVP.Mul4x1(mgl32.Vec4{ndcX, ndcY, 1, 1})
-	end = end.Mul(1.0 / end.W())
-
-	rayOrigin := mgl32.Vec3{start.X(), start.Y(), start.Z()}
-	rayDir := mgl32.Vec3{end.X() - start.X(), end.Y() - start.Y(), end.Z() - start.Z()}.Normalize()
-
-	step := 0.05
-	dist := 0.0
-	maxDist := 100.0
-
-	for dist < maxDist {
-		point := rayOrigin.Add(rayDir.Mul(float32(dist)))
-		bx, by, bz := int(math.Round(float64(point.X()))), int(math.Round(float64(point.Y()))), int(math.Round(float64(point.Z())))
-		hitPos := BlockPos{bx, by, bz}
-
-		if _, exists := blocks[hitPos]; exists {
-			if w.GetMouseButton(glfw.MouseButtonLeft) == glfw.Press {
-				delete(blocks, hitPos)
-				return // Destroyed
-			} else if w.GetMouseButton(glfw.MouseButtonRight) == glfw.Press {
-				prevPoint := rayOrigin.Add(rayDir.Mul(float32(dist - step*2)))
-				nx, ny, nz := int(math.Round(float64(prevPoint.X()))), int(math.Round(float64(prevPoint.Y()))), int(math.Round(float64(prevPoint.Z())))
-				newPos := BlockPos{nx, ny, nz}
-				if _, exists := blocks[newPos]; !exists {
-					blocks[newPos] = currentBlockType // Use selected type
-				}
-				return // Placed
+
+	// From the eye along the view, so reach is measured from the eye
+	rayOrigin := eyePos
+	rayDir := front
+
+	// The liquid the eye is in is looked through, until the ray leaves it;
+	// other liquids can be targeted and replaced
+	submerged := true
+	hit, ok := raycast.Cast(gameWorld, blockRegistry, rayOrigin, rayDir, reach, func(p world.BlockPos, state int) bool {
+		submerged = submerged && blockRegistry.IsLiquid(state)
+		return submerged
+	})
+	if !ok {
+		return
+	}
+	liquid := blockRegistry.IsLiquid(hit.State)
+
+	if w.GetMouseButton(glfw.MouseButtonLeft) == glfw.Press {
+		setBlock(hit.Block, world.Air)
+	} else if w.GetMouseButton(glfw.MouseButtonRight) == glfw.Press {
+		// Blocks placed on a liquid replace it, facing the way they would
+		// on a block there
+		newPos := hit.Adjacent
+		if liquid {
+			newPos = hit.Block
+		}
+		if def := blockRegistry.Get(currentBlockType); def != nil && hit.Normal != [3]int{} && replaceable(newPos) {
+			// Orient the selected block by the face it is placed on and
+			// where on the face the ray hit
+			local := [3]float32{
+				hit.Point.X() - float32(newPos.X) + 0.5,
+				hit.Point.Y() - float32(newPos.Y) + 0.5,
+				hit.Point.Z() - float32(newPos.Z) + 0.5,
 			}
+			setBlock(newPos, def.Placed(hit.Normal, front, local))
 		}
-		dist += step
 	}
 }
 
-func checkCollision(pos mgl32.Vec3) bool {
-	// Player Size: 1 width (0.5 radius), 2 height, 1 depth (0.5 radius)
-	// AABB relative to Feet Pos:
-	// Min: x-0.5, y, z-0.5
-	// Max: x+0.5, y+2, z+0.5
-	// Padding? Make it slightly smaller to avoid constant collision?
-	// Let's use strict size first.
-
-	minX, minY, minZ := pos.X()-0.4, pos.Y(), pos.Z()-0.4
-	maxX, maxY, maxZ := pos.X()+0.4, pos.Y()+2.0, pos.Z()+0.4 // Slightly < 0.5 to fit in 1-wide gaps
-
-	// Iterate blocks in this range
-	// Blocks are centered at Integer coordinates (e.g. 0,0,0 covers -0.5 to 0.5)
-	// We need to check any block whose bounds [-0.5, 0.5] overlap our [min, max].
-	// Overlap condition: BlockCenter - 0.5 < Max AND BlockCenter + 0.5 > Min
-	// BlockCenter < Max + 0.5 AND BlockCenter > Min - 0.5
-	// Closest Integer Logic: Round(Min) to Round(Max) covers the range effectively?
-	// Example: Min 0.4 (Round 0). Max 0.6 (Round 1). Block 0 (ends 0.5) overlaps. Block 1 (starts 0.5) overlaps. Correct.
-	// Example: Min 0.1 (Round 0). Max 0.3 (Round 0). Block 0 overlaps. Correct.
-	// Example: Min -0.6 (Round -1). Max -0.4 (Round 0). Block -1 overlaps. Block 0 overlaps. Correct.
-
-	startX, startY, startZ := int(math.Round(float64(minX))), int(math.Round(float64(minY))), int(math.Round(float64(minZ)))
-	endX, endY, endZ := int(math.Round(float64(maxX))), int(math.Round(float64(maxY))), int(math.Round(float64(maxZ)))
-
-	for x := startX; x <= endX; x++ {
-		for y := startY; y <= endY; y++ {
-			for z := startZ; z <= endZ; z++ {
-				if _, exists := blocks[BlockPos{x, y, z}]; exists {
-					return true
-				}
-			}
+// replaceable reports whether a block can be placed at p: there is nothing
+// there, or only a liquid.
+func replaceable(p world.BlockPos) bool {
+	state := gameWorld.GetBlock(p)
+	return state == world.Air || blockRegistry.IsLiquid(state)
+}
+
+// setBlock changes a block and updates the connections of the fences and
+// panes next to it, and of the new block itself. Liquids around it start
+// flowing.
+func setBlock(p world.BlockPos, state int) {
+	gameWorld.SetBlock(p, connected(p, state))
+	simulation.Fluids.Changed(p)
+	for _, side := range []block.Side{block.North, block.East, block.South, block.West} {
+		n := side.Normal()
+		q := world.BlockPos{X: p.X + n[0], Y: p.Y + n[1], Z: p.Z + n[2]}
+		if s := gameWorld.GetBlock(q); s != world.Air {
+			gameWorld.SetBlock(q, connected(q, s))
 		}
 	}
-	return false
+}
+
+// loadedWorld is the game world as the simulation sees it: the player does
+// not fall into chunks that are not loaded, and liquids do not flow into
+// them.
+type loadedWorld struct {
+	*world.World
+}
+
+func (loadedWorld) Contains(p world.BlockPos) bool {
+	return chunkStreamer.Loaded(world.ChunkPosOf(p))
+}
+
+// connected returns a state with its connect properties set from the blocks
+// around p.
+func connected(p world.BlockPos, state int) int {
+	return blockRegistry.Connect(state, func(side block.Side) int {
+		n := side.Normal()
+		return gameWorld.GetBlock(world.BlockPos{X: p.X + n[0], Y: p.Y + n[1], Z: p.Z + n[2]})
+	})
 }
 
 func keyCallback(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
 	if action == glfw.Press {
-		if key >= glfw.Key1 && key <= glfw.Key5 {
-			currentBlockType = int(key - glfw.Key1 + 1)
+		if key >= glfw.Key1 && key <= glfw.Key9 {
+			if slot := int(key - glfw.Key1); slot < len(hotbar) {
+				currentBlockType = hotbar[slot].ID
+			}
+		}
+		if key == glfw.KeyG {
+			toggleChunkMesher()
+		}
+		if key == glfw.KeyEscape {
+			releaseMouse(w)
 		}
 	}
 }
 
 func mouseButtonCallback(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
 	if action == glfw.Press {
+		if !mouseCaptured {
+			// The click only brings the mouse back
+			captureMouse(w)
+			return
+		}
 		if button == glfw.MouseButtonLeft || button == glfw.MouseButtonRight {
 			// Raycast
 			performRaycast(w)
@@ -796,11 +802,49 @@ func mouseButtonCallback(w *glfw.Window, button glfw.MouseButton, action glfw.Ac
 	}
 }
 
-// scrollCallback removed/empty as zoom is not needed
+// captureMouse hides the cursor and keeps it in the window, so the mouse
+// only looks around, with raw motion where the platform has it: without
+// the acceleration and scaling the desktop applies to the cursor.
+func captureMouse(w *glfw.Window) {
+	w.SetInputMode(glfw.CursorMode, glfw.CursorDisabled)
+	if glfw.RawMouseMotionSupported() {
+		w.SetInputMode(glfw.RawMouseMotion, glfw.True)
+	}
+	// The cursor jumps when it is captured, which is not a look
+	firstMouse = true
+	mouseCaptured = true
+}
+
+// releaseMouse shows the cursor again and stops looking around with it.
+func releaseMouse(w *glfw.Window) {
+	w.SetInputMode(glfw.CursorMode, glfw.CursorNormal)
+	mouseCaptured = false
+}
+
+// scrollCallback selects the next or previous hotbar block, for the blocks
+// past the number keys.
 func scrollCallback(w *glfw.Window, xoff float64, yoff float64) {
+	if len(hotbar) == 0 || yoff == 0 {
+		return
+	}
+	slot := 0
+	for i, def := range hotbar {
+		if def.ID == currentBlockType {
+			slot = i
+		}
+	}
+	if yoff < 0 {
+		slot++
+	} else {
+		slot--
+	}
+	currentBlockType = hotbar[(slot+len(hotbar))%len(hotbar)].ID
 }
 
 func cursorPosCallback(w *glfw.Window, xpos float64, ypos float64) {
+	if !mouseCaptured {
+		return
+	}
 	if firstMouse {
 		lastMouseX = xpos
 		lastMouseY = ypos
@@ -850,6 +894,40 @@ func newTexture() (uint32, error) {
 	return texture, nil
 }
 
+// crosshairSize is the width and height of the crosshair texture, drawn
+// at twice that size.
+const crosshairSize = 16
+
+// newCrosshairTexture returns a texture with a white cross with a dark
+// outline, visible against the sky and the ground alike.
+func newCrosshairTexture() uint32 {
+	rgba := image.NewRGBA(image.Rect(0, 0, crosshairSize, crosshairSize))
+	mid := crosshairSize / 2
+	// The arms are 2 texels thick, around the middle
+	arm := func(x, y, grow int) bool {
+		onX := y >= mid-1-grow && y <= mid+grow && x >= 1-grow && x <= crosshairSize-2+grow
+		onY := x >= mid-1-grow && x <= mid+grow && y >= 1-grow && y <= crosshairSize-2+grow
+		return onX || onY
+	}
+	for x := range crosshairSize {
+		for y := range crosshairSize {
+			switch {
+			case arm(x, y, 0):
+				rgba.Set(x, y, color.White)
+			case arm(x, y, 1):
+				rgba.Set(x, y, color.RGBA{0, 0, 0, 160})
+			}
+		}
+	}
+	var texture uint32
+	gl.GenTextures(1, &texture)
+	gl.BindTexture(gl.TEXTURE_2D, texture)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, crosshairSize, crosshairSize, 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(rgba.Pix))
+	return texture
+}
+
 func loadTexture(path string) (uint32, error) {
 	file, err := os.Open("textures/" + path)
 	if err != nil {
@@ -0,0 +1,101 @@
+package mesh
+
+import (
+	"craft3d/block"
+	"craft3d/world"
+)
+
+// BuildGreedy meshes the chunk at cp like Build, but merges coplanar
+// neighbouring faces of the same full-cube block state into larger quads.
+// UVs are tiled, so the result looks the same as Build with far fewer
+// triangles on flat terrain. The shader must repeat textures, either with
+// GL_REPEAT or by wrapping the coordinates inside the atlas tile. Blocks
+// drawn from a model are emitted face by face as Build does.
+func BuildGreedy(w *world.World, reg *block.Registry, tiles Tiles, cp world.ChunkPos) *Mesh {
+	m := &Mesh{}
+	c := w.ChunkAt(cp)
+	if c == nil || c.Empty() {
+		return m
+	}
+
+	n := newNeighbourhood(w, c)
+	byTexture := map[string][]quad{}
+
+	const size = world.ChunkSize
+	var mask [size][size]int // Visible block state per (u, v) cell, 0 if none
+
+	// Only full cubes merge, and model faces do not line up with the slices
+	cube := func(state int) bool {
+		b := reg.Get(state)
+		return b != nil && b.ShapeOf(state).Cube
+	}
+	c.Each(func(p world.BlockPos, state int) {
+		if b := reg.Get(state); b != nil && !cube(state) {
+			x, y, z := world.Local(p)
+			addShape(byTexture, reg, n, x, y, z, state, b.ShapeOf(state))
+		}
+	})
+
+	for _, f := range Faces {
+		axes := faceAxes[f]
+		dx, dy, dz := f.Normal()
+
+		for d := 0; d < size; d++ {
+			// Collect the visible faces of this slice
+			for v := 0; v < size; v++ {
+				for u := 0; u < size; u++ {
+					var p [3]int
+					p[axes[0]], p[axes[1]], p[axes[2]] = d, u, v
+					id := c.Get(p[0], p[1], p[2])
+					mask[u][v] = 0
+					if id != world.Air && cube(id) && !reg.Hides(id, n.get(p[0]+dx, p[1]+dy, p[2]+dz), f.side(), block.FullArea) {
+						mask[u][v] = id
+					}
+				}
+			}
+
+			// Merge runs: grow along U first, then along V while the whole
+			// row matches
+			for v := 0; v < size; v++ {
+				for u := 0; u < size; {
+					id := mask[u][v]
+					if id == 0 {
+						u++
+						continue
+					}
+
+					du := 1
+					for u+du < size && mask[u+du][v] == id {
+						du++
+					}
+					dv := 1
+				grow:
+					for v+dv < size {
+						for k := u; k < u+du; k++ {
+							if mask[k][v+dv] != id {
+								break grow
+							}
+						}
+						dv++
+					}
+
+					for j := v; j < v+dv; j++ {
+						for k := u; k < u+du; k++ {
+							mask[k][j] = 0
+						}
+					}
+
+					var p [3]int
+					p[axes[0]], p[axes[1]], p[axes[2]] = d, u, v
+					b := reg.Get(id)
+					tex := f.Texture(b, id)
+					byTexture[tex] = append(byTexture[tex], quad{p[0], p[1], p[2], f, b, du, dv, nil})
+					u += du
+				}
+			}
+		}
+	}
+
+	m.write(byTexture, reg, tiles)
+	return m
+}
@@ -0,0 +1,129 @@
+package mesh
+
+import (
+	"math"
+	"testing"
+
+	"craft3d/world"
+)
+
+// waveTerrain fills a 3x3 chunk area with the demo sin/cos hills.
+func waveTerrain(w *world.World) {
+	for x := -16; x < 32; x++ {
+		for z := -16; z < 32; z++ {
+			h := int(4 * (math.Sin(float64(x)*0.1) + math.Cos(float64(z)*0.1)))
+			for y := -5; y <= h+8; y++ {
+				id := stone
+				if y == h+8 {
+					id = grass
+				}
+				w.SetBlock(world.BlockPos{X: x, Y: y, Z: z}, id)
+			}
+		}
+	}
+}
+
+// area returns how many block faces the mesh covers, using the tiled UVs.
+func area(m *Mesh) int {
+	total := 0
+	for i := 0; i < len(m.Indices); i += 6 {
+		var maxU, maxV float32
+		for _, idx := range m.Indices[i : i+6] {
+			v := m.Vertices[int(idx)*VertexSize:]
+			maxU = max(maxU, v[3])
+			maxV = max(maxV, v[4])
+		}
+		total += int(maxU * maxV)
+	}
+	return total
+}
+
+func TestGreedyFaceCounts(t *testing.T) {
+	reg := testRegistry(t)
+
+	cases := []struct {
+		name  string
+		build func(w *world.World)
+		faces int
+	}{
+		{"single block", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, stone)
+		}, 6},
+		{"full chunk", func(w *world.World) {
+			fill(w, stone, 0, 0, 0, 15, 15, 15)
+		}, 6},
+		{"flat layer", func(w *world.World) {
+			fill(w, stone, 0, 0, 0, 15, 0, 15)
+		}, 6},
+		{"two block types side by side", func(w *world.World) {
+			fill(w, stone, 0, 0, 0, 7, 0, 15)
+			fill(w, grass, 8, 0, 0, 15, 0, 15)
+		}, 12 - 2},
+		{"L shape", func(w *world.World) {
+			fill(w, stone, 0, 0, 0, 3, 0, 0)
+			fill(w, stone, 0, 0, 1, 0, 0, 3)
+		}, 2*2 + 6},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := world.New()
+			c.build(w)
+			naive := Build(w, reg, nil, world.ChunkPos{})
+			greedy := BuildGreedy(w, reg, nil, world.ChunkPos{})
+			if got := greedy.FaceCount(); got != c.faces {
+				t.Errorf("faces = %d, want %d", got, c.faces)
+			}
+			if area(greedy) != naive.FaceCount() {
+				t.Errorf("greedy covers %d faces, naive has %d", area(greedy), naive.FaceCount())
+			}
+		})
+	}
+}
+
+func TestGreedyTerrainCoverage(t *testing.T) {
+	reg := testRegistry(t)
+	w := world.New()
+	waveTerrain(w)
+
+	for _, cp := range []world.ChunkPos{{X: 0, Y: 0, Z: 0}, {X: 1, Y: 0, Z: 0}, {X: 0, Y: -1, Z: 1}} {
+		naive := Build(w, reg, nil, cp)
+		greedy := BuildGreedy(w, reg, nil, cp)
+		if area(greedy) != naive.FaceCount() {
+			t.Errorf("chunk %v: greedy covers %d faces, naive has %d", cp, area(greedy), naive.FaceCount())
+		}
+		if greedy.FaceCount() >= naive.FaceCount() {
+			t.Errorf("chunk %v: greedy has %d quads, naive %d", cp, greedy.FaceCount(), naive.FaceCount())
+		}
+		t.Logf("chunk %v: naive %d quads, greedy %d quads", cp, naive.FaceCount(), greedy.FaceCount())
+	}
+}
+
+func TestGreedyGolden(t *testing.T) {
+	w := world.New()
+	fill(w, stone, 0, 0, 0, 2, 0, 1)
+	w.SetBlock(world.BlockPos{X: 0, Y: 1, Z: 0}, grass)
+	checkGolden(t, "testdata/greedy.golden", BuildGreedy(w, testRegistry(t), nil, world.ChunkPos{}))
+}
+
+func benchmarkMesher(b *testing.B, mesher Mesher) {
+	reg := testRegistry(b)
+	w := world.New()
+	waveTerrain(w)
+	cp := world.ChunkPos{X: 0, Y: 0, Z: 0}
+
+	b.ResetTimer()
+	var m *Mesh
+	for i := 0; i < b.N; i++ {
+		m = mesher(w, reg, nil, cp)
+	}
+	b.ReportMetric(float64(m.FaceCount()), "quads")
+}
+
+func BenchmarkNaive(b *testing.B) {
+	benchmarkMesher(b, Build)
+}
+
+func BenchmarkGreedy(b *testing.B) {
+	benchmarkMesher(b, BuildGreedy)
+}
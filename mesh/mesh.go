@@ -0,0 +1,525 @@
+// Package mesh turns chunks of blocks into renderable vertex data.
+//
+// Meshing is pure Go: it does not touch OpenGL, so the output can be
+// checked in tests and uploaded by the renderer as one buffer per chunk.
+package mesh
+
+import (
+	"sort"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+// VertexSize is the number of floats per vertex:
+//
+//	X, Y, Z         position relative to the chunk origin block
+//	U, V            texture coordinates, 0..1 per block (tiled on merged quads)
+//	U0, V0, DU, DV  area of the texture in the atlas, see atlas.Rect
+//	R, G, B, A      block tint
+//
+// The shader samples the atlas at U0,V0 + fract(U,V) * DU,DV.
+const VertexSize = 13
+
+// Tiles maps a texture name to its area in the texture atlas, as
+// U0, V0, DU, DV.
+type Tiles interface {
+	Tile(name string) [4]float32
+}
+
+// fullTile is used when there is no atlas.
+var fullTile = [4]float32{0, 0, 1, 1}
+
+// Face identifies one side of a block.
+type Face int
+
+const (
+	Front  Face = iota // +Z
+	Back               // -Z
+	Top                // +Y
+	Bottom             // -Y
+	Right              // +X
+	Left               // -X
+)
+
+// Faces lists every face, in the order used by the vertex tables.
+var Faces = []Face{Front, Back, Top, Bottom, Right, Left}
+
+// Normal returns the direction the face points to.
+func (f Face) Normal() (dx, dy, dz int) {
+	n := faceNormals[f]
+	return n[0], n[1], n[2]
+}
+
+// Texture returns the texture a state of block b uses on this face.
+func (f Face) Texture(b *block.Block, state int) string {
+	t := b.TexturesOf(state)
+	switch f {
+	case Front:
+		return t.South
+	case Back:
+		return t.North
+	case Top:
+		return t.Top
+	case Bottom:
+		return t.Bottom
+	case Right:
+		return t.East
+	default:
+		return t.West
+	}
+}
+
+// side returns the block side the face is on.
+func (f Face) side() block.Side {
+	return faceSides[f]
+}
+
+var faceSides = [6]block.Side{
+	Front:  block.South,
+	Back:   block.North,
+	Top:    block.Top,
+	Bottom: block.Bottom,
+	Right:  block.East,
+	Left:   block.West,
+}
+
+var faceNormals = [6][3]int{
+	Front:  {0, 0, 1},
+	Back:   {0, 0, -1},
+	Top:    {0, 1, 0},
+	Bottom: {0, -1, 0},
+	Right:  {1, 0, 0},
+	Left:   {-1, 0, 0},
+}
+
+// X, Y, Z, U, V of each face corner, for a block centred at the origin.
+var faceCorners = [6][4][5]float32{
+	Front: {
+		{-0.5, -0.5, 0.5, 0.0, 0.0},
+		{0.5, -0.5, 0.5, 1.0, 0.0},
+		{0.5, 0.5, 0.5, 1.0, 1.0},
+		{-0.5, 0.5, 0.5, 0.0, 1.0},
+	},
+	Back: {
+		{-0.5, -0.5, -0.5, 1.0, 0.0},
+		{0.5, -0.5, -0.5, 0.0, 0.0},
+		{0.5, 0.5, -0.5, 0.0, 1.0},
+		{-0.5, 0.5, -0.5, 1.0, 1.0},
+	},
+	Top: {
+		{-0.5, 0.5, 0.5, 0.0, 0.0},
+		{0.5, 0.5, 0.5, 1.0, 0.0},
+		{0.5, 0.5, -0.5, 1.0, 1.0},
+		{-0.5, 0.5, -0.5, 0.0, 1.0},
+	},
+	Bottom: {
+		{-0.5, -0.5, 0.5, 0.0, 1.0},
+		{0.5, -0.5, 0.5, 1.0, 1.0},
+		{0.5, -0.5, -0.5, 1.0, 0.0},
+		{-0.5, -0.5, -0.5, 0.0, 0.0},
+	},
+	Right: {
+		{0.5, -0.5, 0.5, 0.0, 0.0},
+		{0.5, -0.5, -0.5, 1.0, 0.0},
+		{0.5, 0.5, -0.5, 1.0, 1.0},
+		{0.5, 0.5, 0.5, 0.0, 1.0},
+	},
+	Left: {
+		{-0.5, -0.5, 0.5, 1.0, 0.0},
+		{-0.5, -0.5, -0.5, 0.0, 0.0},
+		{-0.5, 0.5, -0.5, 0.0, 1.0},
+		{-0.5, 0.5, 0.5, 1.0, 1.0},
+	},
+}
+
+// Axes (0=X, 1=Y, 2=Z) of each face: the normal, the one U runs along and
+// the one V runs along.
+var faceAxes = [6][3]int{
+	Front:  {2, 0, 1},
+	Back:   {2, 0, 1},
+	Top:    {1, 0, 2},
+	Bottom: {1, 0, 2},
+	Right:  {0, 2, 1},
+	Left:   {0, 2, 1},
+}
+
+// Triangle order of each face, so that front faces wind counter-clockwise.
+var faceIndices = [6][6]uint32{
+	Front:  {0, 1, 2, 2, 3, 0},
+	Back:   {2, 1, 0, 0, 3, 2},
+	Top:    {0, 1, 2, 2, 3, 0},
+	Bottom: {2, 1, 0, 0, 3, 2},
+	Right:  {0, 1, 2, 2, 3, 0},
+	Left:   {2, 1, 0, 0, 3, 2},
+}
+
+// Batch is a range of indices that share one texture.
+type Batch struct {
+	Texture string
+	Tint    string // Biome tint kind of the texture, see block.Registry.TextureTint
+	Offset  int    // First index
+	Count   int    // Number of indices
+}
+
+// Mesh is the geometry of one chunk.
+type Mesh struct {
+	Vertices []float32
+	Indices  []uint32 // Of opaque faces
+	Batches  []Batch  // Of Indices, sorted by tint, then texture name
+
+	// Faces of translucent blocks, to be blended after every opaque face
+	// from back to front, see SortTranslucent. Their vertices are in
+	// Vertices too.
+	Translucent []TranslucentFace
+}
+
+// TranslucentFace is a face of a translucent block, such as water.
+type TranslucentFace struct {
+	Center  [3]float32 // Position, for sorting
+	Tint    string     // Biome tint kind of the texture
+	Indices [6]uint32
+}
+
+// Empty reports whether the mesh has nothing to draw.
+func (m *Mesh) Empty() bool {
+	return len(m.Indices) == 0 && len(m.Translucent) == 0
+}
+
+// FaceCount returns the number of quads in the mesh.
+func (m *Mesh) FaceCount() int {
+	return len(m.Indices)/6 + len(m.Translucent)
+}
+
+// SortTranslucent orders translucent faces from the farthest to the nearest
+// to eye, given in the same coordinates as the faces, so that blending them
+// in order draws what is behind first.
+func SortTranslucent(faces []TranslucentFace, eye [3]float32) {
+	dist := func(f *TranslucentFace) float32 {
+		dx, dy, dz := f.Center[0]-eye[0], f.Center[1]-eye[1], f.Center[2]-eye[2]
+		return dx*dx + dy*dy + dz*dz
+	}
+	sort.SliceStable(faces, func(i, j int) bool {
+		return dist(&faces[i]) > dist(&faces[j])
+	})
+}
+
+// Mesher builds the mesh of one chunk.
+type Mesher func(w *world.World, reg *block.Registry, tiles Tiles, cp world.ChunkPos) *Mesh
+
+// Meshers lists the available meshers by name.
+var Meshers = map[string]Mesher{
+	"naive":  Build,
+	"greedy": BuildGreedy,
+}
+
+// quad is a face waiting to be written, grouped by texture. It covers du×dv
+// blocks starting at x, y, z along the face's U and V axes, unless corners
+// gives its exact shape.
+type quad struct {
+	x, y, z int // Local block position of the lowest corner
+	face    Face
+	block   *block.Block
+	du, dv  int
+
+	// X, Y, Z relative to the block centre and U, V of each corner, for
+	// faces of block models. Written in the face's triangle order.
+	corners *[4][5]float32
+}
+
+// Build meshes the chunk at cp. Only faces that neighbours do not hide are
+// emitted: a face is hidden where an opaque neighbour fills the side it
+// touches, so slabs and stairs only hide what they cover, and between two
+// blocks of the same translucent type, such as water. Neighbours in other
+// chunks are read from w, so border faces are culled correctly. Blocks with
+// a model are drawn from their shape, see block.Shape, and faces of
+// translucent blocks go to Mesh.Translucent. Texture coordinates come from
+// tiles, which may be nil to use whole textures.
+func Build(w *world.World, reg *block.Registry, tiles Tiles, cp world.ChunkPos) *Mesh {
+	m := &Mesh{}
+	c := w.ChunkAt(cp)
+	if c == nil || c.Empty() {
+		return m
+	}
+
+	n := newNeighbourhood(w, c)
+	byTexture := map[string][]quad{}
+
+	for y := 0; y < world.ChunkSize; y++ {
+		for z := 0; z < world.ChunkSize; z++ {
+			for x := 0; x < world.ChunkSize; x++ {
+				state := c.Get(x, y, z)
+				b := reg.Get(state)
+				if b == nil {
+					continue
+				}
+				if shape := b.ShapeOf(state); !shape.Cube {
+					addShape(byTexture, reg, n, x, y, z, state, shape)
+					continue
+				}
+				for _, f := range Faces {
+					dx, dy, dz := f.Normal()
+					if reg.Hides(state, n.get(x+dx, y+dy, z+dz), f.side(), block.FullArea) {
+						continue
+					}
+					tex := f.Texture(b, state)
+					byTexture[tex] = append(byTexture[tex], quad{x, y, z, f, b, 1, 1, nil})
+				}
+			}
+		}
+	}
+
+	m.write(byTexture, reg, tiles)
+	return m
+}
+
+// addShape queues the faces of a block drawn from its shape: the cuboid
+// faces that neighbours do not hide, and crossed quads seen from both
+// sides.
+func addShape(byTexture map[string][]quad, reg *block.Registry, n *neighbourhood, x, y, z, state int, shape *block.Shape) {
+	b := reg.Get(state)
+	if shape.Liquid > 0 {
+		addLiquid(byTexture, reg, n, x, y, z, state)
+		return
+	}
+	for i := range shape.Cuboids {
+		c := &shape.Cuboids[i]
+		for _, f := range Faces {
+			face := c.Faces[f.side()]
+			if face == nil {
+				continue
+			}
+			dx, dy, dz := f.Normal()
+			if face.Cull && reg.Hides(state, n.get(x+dx, y+dy, z+dz), f.side(), face.Area) {
+				continue
+			}
+			corners := cuboidCorners(f, c, face)
+			byTexture[face.Texture] = append(byTexture[face.Texture], quad{x, y, z, f, b, 1, 1, corners})
+		}
+	}
+	if shape.Cross != "" {
+		for _, corners := range crossCorners {
+			byTexture[shape.Cross] = append(byTexture[shape.Cross], quad{x, y, z, Front, b, 1, 1, corners})
+		}
+	}
+}
+
+// addLiquid queues the faces of a liquid block: a cube whose surface sinks
+// to the height of the liquid's level unless the same liquid is above. The
+// surface is also drawn facing down, to be seen from under water. Sides
+// facing the same liquid show only where it is lower.
+func addLiquid(byTexture map[string][]quad, reg *block.Registry, n *neighbourhood, x, y, z, state int) {
+	b := reg.Get(state)
+	c := &block.Cuboid{To: [3]float32{1, 1, 1}}
+	surface := reg.Get(n.get(x, y+1, z)) != b
+	if surface {
+		c.To[1] = reg.Surface(state)
+	}
+	for _, f := range Faces {
+		dx, dy, dz := f.Normal()
+		neighbour := n.get(x+dx, y+dy, z+dz)
+		hidden := reg.Hides(state, neighbour, f.side(), block.FullArea)
+		switch {
+		case f == Top && surface:
+			hidden = false
+		case dy == 0 && reg.Get(neighbour) == b:
+			hidden = reg.Surface(neighbour) >= reg.Surface(state)
+		}
+		if hidden {
+			continue
+		}
+		tex := f.Texture(b, state)
+		corners := cuboidCorners(f, c, &block.CuboidFace{})
+		byTexture[tex] = append(byTexture[tex], quad{x, y, z, f, b, 1, 1, corners})
+		if f == Top && surface {
+			byTexture[tex] = append(byTexture[tex], quad{x, y, z, f, b, 1, 1, flip(corners)})
+		}
+	}
+}
+
+// flip returns the corners of a face in the order that makes it face the
+// other way.
+func flip(c *[4][5]float32) *[4][5]float32 {
+	return &[4][5]float32{c[1], c[0], c[3], c[2]}
+}
+
+// cuboidCorners returns the corners of a cuboid face. Without explicit UVs
+// a corner takes the UV it would have on a full block face at the same
+// place, so the face shows that part of the texture.
+func cuboidCorners(f Face, c *block.Cuboid, face *block.CuboidFace) *[4][5]float32 {
+	axes := faceAxes[f]
+	var corners [4][5]float32
+	for i, v := range faceCorners[f] {
+		var pos [3]float32
+		for k := 0; k < 3; k++ {
+			pos[k] = c.From[k]
+			if v[k] > 0 {
+				pos[k] = c.To[k]
+			}
+			corners[i][k] = pos[k] - 0.5
+		}
+		for j, axis := range axes[1:] {
+			full := v[3+j] // 0 or 1 on a full face
+			switch {
+			case face.UV != nil:
+				uv := face.UV
+				corners[i][3+j] = uv[j] + full*(uv[j+2]-uv[j])
+			case (v[axis] > 0) == (full > 0):
+				corners[i][3+j] = pos[axis]
+			default:
+				corners[i][3+j] = 1 - pos[axis] // The texture runs against the axis
+			}
+		}
+	}
+	return &corners
+}
+
+// Corners of the two diagonal planes of cross models, each written once
+// per side since back faces are culled.
+var crossCorners = func() []*[4][5]float32 {
+	planes := [2][4][5]float32{
+		{{-0.5, -0.5, -0.5, 0, 0}, {0.5, -0.5, 0.5, 1, 0}, {0.5, 0.5, 0.5, 1, 1}, {-0.5, 0.5, -0.5, 0, 1}},
+		{{-0.5, -0.5, 0.5, 0, 0}, {0.5, -0.5, -0.5, 1, 0}, {0.5, 0.5, -0.5, 1, 1}, {-0.5, 0.5, 0.5, 0, 1}},
+	}
+	var list []*[4][5]float32
+	for _, p := range planes {
+		front := p
+		list = append(list, &front, flip(&front))
+	}
+	return list
+}()
+
+// write emits the quads sorted by tint and texture, one batch per texture.
+// Textures with the same biome tint end up next to each other, so the
+// renderer can draw them with a single colour. Quads of translucent blocks
+// go to m.Translucent instead, in the same order until they are sorted.
+func (m *Mesh) write(byTexture map[string][]quad, reg *block.Registry, tiles Tiles) {
+	textures := make([]string, 0, len(byTexture))
+	for tex := range byTexture {
+		textures = append(textures, tex)
+	}
+	sort.Slice(textures, func(i, j int) bool {
+		ti, tj := reg.TextureTint(textures[i]), reg.TextureTint(textures[j])
+		if ti != tj {
+			return ti < tj
+		}
+		return textures[i] < textures[j]
+	})
+
+	for _, tex := range textures {
+		batch := Batch{Texture: tex, Tint: reg.TextureTint(tex), Offset: len(m.Indices)}
+		tile := fullTile
+		if tiles != nil {
+			tile = tiles.Tile(tex)
+		}
+		for _, q := range byTexture[tex] {
+			indices := m.addFace(q, tile)
+			if !q.block.Translucent {
+				m.Indices = append(m.Indices, indices[:]...)
+				continue
+			}
+			f := TranslucentFace{Tint: batch.Tint, Indices: indices}
+			corners := m.Vertices[len(m.Vertices)-4*VertexSize:]
+			for i := 0; i < 4; i++ {
+				v := corners[i*VertexSize:]
+				f.Center[0] += v[0] / 4
+				f.Center[1] += v[1] / 4
+				f.Center[2] += v[2] / 4
+			}
+			m.Translucent = append(m.Translucent, f)
+		}
+		if batch.Count = len(m.Indices) - batch.Offset; batch.Count > 0 {
+			m.Batches = append(m.Batches, batch)
+		}
+	}
+}
+
+// addFace writes the four corners of a quad and returns the indices of its
+// two triangles. Corners on the positive side of an axis are pushed to the
+// far end of the quad, and UVs are scaled by the quad size so textures
+// repeat once per block instead of stretching.
+func (m *Mesh) addFace(q quad, tile [4]float32) (indices [6]uint32) {
+	base := uint32(len(m.Vertices) / VertexSize)
+	tint := q.block.Tint
+	if q.corners != nil {
+		for _, c := range q.corners {
+			m.Vertices = append(m.Vertices,
+				float32(q.x)+c[0], float32(q.y)+c[1], float32(q.z)+c[2],
+				c[3], c[4],
+				tile[0], tile[1], tile[2], tile[3],
+				tint[0], tint[1], tint[2], tint[3],
+			)
+		}
+		for k, i := range faceIndices[q.face] {
+			indices[k] = base + i
+		}
+		return indices
+	}
+
+	axes := faceAxes[q.face]
+	cell := [3]int{q.x, q.y, q.z}
+	size := [3]int{1, 1, 1}
+	size[axes[1]] = q.du
+	size[axes[2]] = q.dv
+
+	for _, v := range faceCorners[q.face] {
+		var pos [3]float32
+		for k := 0; k < 3; k++ {
+			if v[k] < 0 {
+				pos[k] = float32(cell[k]) - 0.5
+			} else {
+				pos[k] = float32(cell[k]+size[k]-1) + 0.5
+			}
+		}
+		m.Vertices = append(m.Vertices,
+			pos[0], pos[1], pos[2],
+			v[3]*float32(q.du), v[4]*float32(q.dv),
+			tile[0], tile[1], tile[2], tile[3],
+			tint[0], tint[1], tint[2], tint[3],
+		)
+	}
+	for k, i := range faceIndices[q.face] {
+		indices[k] = base + i
+	}
+	return indices
+}
+
+// neighbourhood gives fast access to a chunk and the six chunks around it.
+type neighbourhood struct {
+	center *world.Chunk
+	sides  [6]*world.Chunk // Indexed by Face
+}
+
+func newNeighbourhood(w *world.World, c *world.Chunk) *neighbourhood {
+	n := &neighbourhood{center: c}
+	for _, f := range Faces {
+		dx, dy, dz := f.Normal()
+		n.sides[f] = w.ChunkAt(c.Pos.Add(dx, dy, dz))
+	}
+	return n
+}
+
+// get returns the block at local coordinates, which may be one step outside
+// the centre chunk on a single axis.
+func (n *neighbourhood) get(x, y, z int) int {
+	const last = world.ChunkSize - 1
+	c := n.center
+	switch {
+	case x < 0:
+		c, x = n.sides[Left], last
+	case x > last:
+		c, x = n.sides[Right], 0
+	case y < 0:
+		c, y = n.sides[Bottom], last
+	case y > last:
+		c, y = n.sides[Top], 0
+	case z < 0:
+		c, z = n.sides[Back], last
+	case z > last:
+		c, z = n.sides[Front], 0
+	}
+	if c == nil {
+		return world.Air
+	}
+	return c.Get(x, y, z)
+}
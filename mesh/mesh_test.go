@@ -0,0 +1,402 @@
+package mesh
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+const (
+	stone = 1
+	glass = 2
+	grass = 3
+)
+
+func testRegistry(t testing.TB) *block.Registry {
+	t.Helper()
+	r, err := block.Parse([]byte(`{"blocks": [
+		{"id": 1, "name": "stone", "textures": {"all": "stone"}, "solid": true},
+		{"id": 2, "name": "glass", "textures": {"all": "glass"}, "solid": true, "transparent": true},
+		{"id": 3, "name": "grass", "textures": {"top": "grass_top", "bottom": "dirt", "side": "grass_side"}, "solid": true}
+	], "tinted_textures": {"grass_top": "grass"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func fill(w *world.World, id, x0, y0, z0, x1, y1, z1 int) {
+	for x := x0; x <= x1; x++ {
+		for y := y0; y <= y1; y++ {
+			for z := z0; z <= z1; z++ {
+				w.SetBlock(world.BlockPos{X: x, Y: y, Z: z}, id)
+			}
+		}
+	}
+}
+
+func TestFaceCounts(t *testing.T) {
+	reg := testRegistry(t)
+
+	cases := []struct {
+		name  string
+		build func(w *world.World)
+		chunk world.ChunkPos
+		faces int
+	}{
+		{"empty", func(w *world.World) {}, world.ChunkPos{}, 0},
+		{"single block", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, stone)
+		}, world.ChunkPos{}, 6},
+		{"two adjacent blocks", func(w *world.World) {
+			fill(w, stone, 3, 3, 3, 4, 3, 3)
+		}, world.ChunkPos{}, 10},
+		{"3x3x3 cube", func(w *world.World) {
+			fill(w, stone, 1, 1, 1, 3, 3, 3)
+		}, world.ChunkPos{}, 54},
+		{"full chunk", func(w *world.World) {
+			fill(w, stone, 0, 0, 0, 15, 15, 15)
+		}, world.ChunkPos{}, 6 * 16 * 16},
+		{"stone behind glass keeps its face", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, stone)
+			w.SetBlock(world.BlockPos{X: 4, Y: 3, Z: 3}, glass)
+		}, world.ChunkPos{}, 11},
+		{"neighbour chunk hides border face", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 15, Y: 3, Z: 3}, stone)
+			w.SetBlock(world.BlockPos{X: 16, Y: 3, Z: 3}, stone)
+		}, world.ChunkPos{}, 5},
+		{"negative chunk border", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: -1, Y: -1, Z: -1}, stone)
+			w.SetBlock(world.BlockPos{X: -1, Y: 0, Z: -1}, stone)
+		}, world.ChunkPos{X: -1, Y: -1, Z: -1}, 5},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := world.New()
+			c.build(w)
+			m := Build(w, reg, nil, c.chunk)
+			if got := m.FaceCount(); got != c.faces {
+				t.Errorf("faces = %d, want %d", got, c.faces)
+			}
+			if len(m.Vertices) != c.faces*4*VertexSize {
+				t.Errorf("vertices = %d floats, want %d", len(m.Vertices), c.faces*4*VertexSize)
+			}
+		})
+	}
+}
+
+func TestBatchesByTexture(t *testing.T) {
+	w := world.New()
+	w.SetBlock(world.BlockPos{X: 0, Y: 0, Z: 0}, grass)
+	m := Build(w, testRegistry(t), nil, world.ChunkPos{})
+
+	// Untinted textures first, then the ones tinted by biome
+	want := []Batch{
+		{Texture: "dirt", Offset: 0, Count: 6},
+		{Texture: "grass_side", Offset: 6, Count: 24},
+		{Texture: "grass_top", Tint: "grass", Offset: 30, Count: 6},
+	}
+	if fmt.Sprint(m.Batches) != fmt.Sprint(want) {
+		t.Errorf("batches = %v, want %v", m.Batches, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	w := world.New()
+	w.SetBlock(world.BlockPos{X: 0, Y: 0, Z: 0}, grass)
+	w.SetBlock(world.BlockPos{X: 1, Y: 0, Z: 0}, stone)
+	w.SetBlock(world.BlockPos{X: 0, Y: 1, Z: 0}, glass)
+	checkGolden(t, "testdata/small.golden", Build(w, testRegistry(t), nil, world.ChunkPos{}))
+}
+
+func checkGolden(t *testing.T, path string, m *Mesh) {
+	t.Helper()
+	got := dump(m)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("mesh does not match %s (run with -update to refresh)\n%s", path, got)
+	}
+}
+
+// dump formats a mesh one quad per line, grouped by batch.
+func dump(m *Mesh) string {
+	var sb strings.Builder
+	for _, b := range m.Batches {
+		fmt.Fprintf(&sb, "batch %s (%d faces)", b.Texture, b.Count/6)
+		if b.Tint != "" {
+			fmt.Fprintf(&sb, " tint %s", b.Tint)
+		}
+		sb.WriteString("\n")
+		for i := b.Offset; i < b.Offset+b.Count; i += 6 {
+			sb.WriteString(" ")
+			for _, idx := range m.Indices[i : i+6] {
+				v := m.Vertices[int(idx)*VertexSize:][:5]
+				fmt.Fprintf(&sb, " (%g %g %g|%g %g)", v[0], v[1], v[2], v[3], v[4])
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+func TestStateTextures(t *testing.T) {
+	reg, err := block.Parse([]byte(`{"blocks": [
+		{"id": 1, "name": "log", "textures": {"top": "log_top", "bottom": "log_top", "side": "log_side"},
+		 "properties": [{"name": "axis", "values": ["y", "x", "z"], "kind": "axis"}],
+		 "variants": [
+			{"when": {"axis": "x"}, "textures": {"all": "log_side", "east": "log_top", "west": "log_top"}},
+			{"when": {"axis": "z"}, "textures": {"all": "log_side", "north": "log_top", "south": "log_top"}}
+		 ]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := reg.ByName("log")
+	along := func(axis string) int {
+		s, _ := log.With(log.Default(), "axis", axis)
+		return s
+	}
+
+	w := world.New()
+	// A row of logs along X, and one standing log
+	fill(w, along("x"), 0, 0, 0, 3, 0, 0)
+	w.SetBlock(world.BlockPos{X: 8, Y: 0, Z: 8}, along("y"))
+	for name, build := range Meshers {
+		m := build(w, reg, nil, world.ChunkPos{})
+		ends := 0
+		for _, b := range m.Batches {
+			if b.Texture == "log_top" {
+				ends += b.Count / 6
+			}
+		}
+		if ends != 4 {
+			t.Errorf("%s: %d log_top faces, want 4", name, ends)
+		}
+	}
+
+	// Logs of different axes are not merged by the greedy mesher
+	w = world.New()
+	w.SetBlock(world.BlockPos{X: 0, Y: 0, Z: 0}, along("z"))
+	w.SetBlock(world.BlockPos{X: 1, Y: 0, Z: 0}, along("x"))
+	if m := BuildGreedy(w, reg, nil, world.ChunkPos{}); m.FaceCount() != 10 {
+		t.Errorf("greedy: %d faces, want 10", m.FaceCount())
+	}
+}
+
+func modelRegistry(t testing.TB) *block.Registry {
+	t.Helper()
+	r, err := block.Parse([]byte(`{"blocks": [
+		{"id": 1, "name": "stone", "textures": {"all": "stone"}, "solid": true},
+		{"id": 2, "name": "glass", "textures": {"all": "glass"}, "solid": true, "transparent": true},
+		{"id": 3, "name": "slab", "textures": {"all": "planks"}, "solid": true, "model": "slab",
+		 "properties": [{"name": "half", "values": ["bottom", "top"], "kind": "half"}],
+		 "variants": [{"when": {"half": "top"}, "model": "slab_top"}]},
+		{"id": 4, "name": "stairs", "textures": {"all": "planks"}, "solid": true, "model": "stairs"},
+		{"id": 5, "name": "flower", "textures": {"all": "flower"}, "transparent": true, "model": "plant"}
+	], "models": {
+		"slab": {"elements": [{"from": [0, 0, 0], "to": [16, 8, 16]}]},
+		"slab_top": {"elements": [{"from": [0, 8, 0], "to": [16, 16, 16]}]},
+		"stairs": {"elements": [
+			{"from": [0, 0, 0], "to": [16, 8, 16]},
+			{"from": [0, 8, 0], "to": [16, 16, 8], "faces": {"top": {}, "north": {}, "south": {"uv": [0, 8, 16, 16]}, "east": {}, "west": {}}}
+		]},
+		"plant": {"type": "cross"}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestModelFaces(t *testing.T) {
+	reg := modelRegistry(t)
+	const slab, stairs, flower = 3, 4, 5
+	topSlab, _ := reg.ByName("slab").With(slab, "half", "top")
+
+	cases := []struct {
+		name  string
+		build func(w *world.World)
+		faces int
+	}{
+		{"single slab", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, slab)
+		}, 6},
+		{"slabs side by side hide their shared sides", func(w *world.World) {
+			fill(w, slab, 3, 3, 3, 4, 3, 3)
+		}, 10},
+		{"bottom and top slabs do not hide each other", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, slab)
+			w.SetBlock(world.BlockPos{X: 4, Y: 3, Z: 3}, topSlab)
+		}, 12},
+		{"slab hides the top of stone but not its side", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, stone)
+			w.SetBlock(world.BlockPos{X: 3, Y: 4, Z: 3}, slab)
+			w.SetBlock(world.BlockPos{X: 5, Y: 3, Z: 3}, stone)
+			w.SetBlock(world.BlockPos{X: 4, Y: 3, Z: 3}, slab)
+		}, 5 + 5 + 5 + 5},
+		{"stairs", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, stairs)
+		}, 6 + 5},
+		{"stone hides the back of stairs", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, stairs)
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 2}, stone)
+		}, 9 + 5},
+		{"flower is two double-sided quads", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, flower)
+		}, 4},
+		{"flower hides nothing", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, flower)
+			w.SetBlock(world.BlockPos{X: 3, Y: 2, Z: 3}, stone)
+		}, 4 + 6},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := world.New()
+			c.build(w)
+			for name, build := range Meshers {
+				if got := build(w, reg, nil, world.ChunkPos{}).FaceCount(); got != c.faces {
+					t.Errorf("%s: faces = %d, want %d", name, got, c.faces)
+				}
+			}
+		})
+	}
+}
+
+func TestModelGolden(t *testing.T) {
+	w := world.New()
+	w.SetBlock(world.BlockPos{X: 0, Y: 0, Z: 0}, 3) // Slab
+	w.SetBlock(world.BlockPos{X: 1, Y: 0, Z: 0}, 4) // Stairs
+	w.SetBlock(world.BlockPos{X: 0, Y: 0, Z: 1}, 5) // Flower
+	checkGolden(t, "testdata/models.golden", Build(w, modelRegistry(t), nil, world.ChunkPos{}))
+}
+
+func translucentRegistry(t testing.TB) *block.Registry {
+	t.Helper()
+	r, err := block.Parse([]byte(`{"blocks": [
+		{"id": 1, "name": "stone", "textures": {"all": "stone"}, "solid": true},
+		{"id": 2, "name": "water", "textures": {"all": "water"}, "transparent": true, "translucent": true, "model": "water",
+		 "properties": [{"name": "level", "values": ["0", "1", "2", "3"], "kind": "level"}]},
+		{"id": 3, "name": "glass", "textures": {"all": "glass"}, "solid": true, "transparent": true, "translucent": true}
+	], "models": {"water": {"type": "liquid", "height": 14}}, "tinted_textures": {"water": "water"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestTranslucentFaces(t *testing.T) {
+	reg := translucentRegistry(t)
+	const water, glass = 2, 3
+
+	cases := []struct {
+		name        string
+		build       func(w *world.World)
+		opaque      int
+		translucent int
+	}{
+		{"water block", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, water)
+		}, 0, 7},
+		{"water between water is culled", func(w *world.World) {
+			fill(w, water, 3, 3, 3, 5, 3, 3)
+		}, 0, 3*2 + 2 + 3*3}, // Surfaces both ways, ends, sides and bottoms
+		{"water under water has no surface", func(w *world.World) {
+			fill(w, water, 3, 3, 3, 3, 4, 3)
+		}, 0, 5 + 6},
+		{"stone stays behind water", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, water)
+			w.SetBlock(world.BlockPos{X: 3, Y: 2, Z: 3}, stone)
+		}, 6, 6},
+		{"glass and water do not hide each other", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, glass)
+			w.SetBlock(world.BlockPos{X: 4, Y: 3, Z: 3}, water)
+		}, 0, 6 + 7},
+		{"water shows its side above lower water", func(w *world.World) {
+			w.SetBlock(world.BlockPos{X: 3, Y: 3, Z: 3}, water)
+			w.SetBlock(world.BlockPos{X: 4, Y: 3, Z: 3}, reg.ByName("water").WithLevel(water, 1))
+		}, 0, 7 + 6},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := world.New()
+			c.build(w)
+			for name, build := range Meshers {
+				m := build(w, reg, nil, world.ChunkPos{})
+				if len(m.Indices)/6 != c.opaque || len(m.Translucent) != c.translucent {
+					t.Errorf("%s: %d opaque and %d translucent faces, want %d and %d",
+						name, len(m.Indices)/6, len(m.Translucent), c.opaque, c.translucent)
+				}
+			}
+		})
+	}
+}
+
+func TestLiquidSurface(t *testing.T) {
+	w := world.New()
+	fill(w, 2, 0, 0, 0, 0, 1, 0) // Two water blocks, one above the other
+	m := Build(w, translucentRegistry(t), nil, world.ChunkPos{})
+
+	var top float32
+	for _, f := range m.Translucent {
+		if f.Tint != "water" {
+			t.Errorf("water face tint = %q", f.Tint)
+		}
+		for _, i := range f.Indices {
+			top = max(top, m.Vertices[int(i)*VertexSize+1])
+		}
+	}
+	if want := float32(1 - 0.5 + 14.0/16); top != want {
+		t.Errorf("water surface at y %g, want %g", top, want)
+	}
+
+	// Flowing water sinks with its level
+	w = world.New()
+	w.SetBlock(world.BlockPos{}, translucentRegistry(t).ByName("water").WithLevel(2, 2))
+	m = Build(w, translucentRegistry(t), nil, world.ChunkPos{})
+	top = -1
+	for _, f := range m.Translucent {
+		for _, i := range f.Indices {
+			top = max(top, m.Vertices[int(i)*VertexSize+1])
+		}
+	}
+	if want := float32(-0.5 + 14.0/16/3); math.Abs(float64(top-want)) > 1e-6 {
+		t.Errorf("level 2 water surface at y %g, want %g", top, want)
+	}
+}
+
+func TestSortTranslucent(t *testing.T) {
+	faces := []TranslucentFace{
+		{Center: [3]float32{1, 0, 0}, Tint: "near"},
+		{Center: [3]float32{9, 0, 0}, Tint: "far"},
+		{Center: [3]float32{0, 4, 0}, Tint: "middle"},
+	}
+	SortTranslucent(faces, [3]float32{0, 0, 0})
+	var order []string
+	for _, f := range faces {
+		order = append(order, f.Tint)
+	}
+	if fmt.Sprint(order) != "[far middle near]" {
+		t.Errorf("sorted faces = %v, want far to near", order)
+	}
+	SortTranslucent(faces, [3]float32{10, 0, 0})
+	if faces[0].Tint != "middle" || faces[2].Tint != "far" {
+		t.Errorf("faces sorted from the other side = %v", faces)
+	}
+}
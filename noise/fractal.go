@@ -0,0 +1,65 @@
+package noise
+
+import "math"
+
+// Fractal sums several octaves of a noise source, each one at a higher
+// frequency and lower amplitude than the previous.
+type Fractal struct {
+	Octaves    int
+	Frequency  float64 // Of the first octave
+	Lacunarity float64 // Frequency multiplier per octave, usually 2
+	Gain       float64 // Amplitude multiplier per octave, usually 0.5
+}
+
+// octaves calls fn with the frequency and amplitude of every octave and
+// returns the total amplitude, used to normalise the sum.
+func (f Fractal) octaves(fn func(freq, amp float64)) float64 {
+	freq, amp, total := f.Frequency, 1.0, 0.0
+	for o := 0; o < f.Octaves; o++ {
+		fn(freq, amp)
+		total += amp
+		freq *= f.Lacunarity
+		amp *= f.Gain
+	}
+	return total
+}
+
+// FBM2 returns fractional Brownian motion at x, y, in about -1..1.
+func (f Fractal) FBM2(src Source2, x, y float64) float64 {
+	sum := 0.0
+	total := f.octaves(func(freq, amp float64) {
+		sum += amp * src.Noise2(x*freq, y*freq)
+	})
+	return sum / total
+}
+
+// FBM3 returns fractional Brownian motion at x, y, z, in about -1..1.
+func (f Fractal) FBM3(src Source3, x, y, z float64) float64 {
+	sum := 0.0
+	total := f.octaves(func(freq, amp float64) {
+		sum += amp * src.Noise3(x*freq, y*freq, z*freq)
+	})
+	return sum / total
+}
+
+// Ridged2 returns ridged multifractal noise at x, y, in 0..1. Each octave
+// is folded around zero (1-|n|) and squared, which turns the zero crossings
+// of the noise into sharp ridges: good for mountain ranges.
+func (f Fractal) Ridged2(src Source2, x, y float64) float64 {
+	sum := 0.0
+	total := f.octaves(func(freq, amp float64) {
+		r := 1 - math.Abs(src.Noise2(x*freq, y*freq))
+		sum += amp * r * r
+	})
+	return sum / total
+}
+
+// Warp2 displaces x, y by strength times a pair of noise values taken from
+// src. Sampling other noise at the warped position bends straight features
+// into more natural, twisting shapes.
+func Warp2(src Source2, f Fractal, x, y, strength float64) (float64, float64) {
+	// Offsets decorrelate the two axes
+	dx := f.FBM2(src, x+31.7, y-12.3)
+	dy := f.FBM2(src, x-47.1, y+83.9)
+	return x + strength*dx, y + strength*dy
+}
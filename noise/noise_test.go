@@ -0,0 +1,139 @@
+package noise
+
+import (
+	"math"
+	"testing"
+)
+
+const refSeed = 1337
+
+// Reference values for seed 1337. They pin down the exact output so terrain
+// does not silently change between versions.
+var simplexRef = []struct {
+	x, y, z        float64
+	noise2, noise3 float64
+}{
+	{0.3, 0.7, 0.1, 0.255528923236, 0.278649932642},
+	{1.25, -3.75, 2.5, -0.347332753313, 0.767602083333},
+	{-10.1, 7.3, 0.2, 0.890924341538, 0.120936158025},
+	{100.7, -250.9, 33.3, 0.510258758758, -0.424885793185},
+	{0.1, 0.2, 0.3, 0.279979930128, 0.173748853333},
+}
+
+var fractalRef = []struct {
+	x, y, z             float64
+	fbm2, fbm3, ridged2 float64
+	warpedX, warpedY    float64
+}{
+	{0.3, 0.7, 0.1, 0.032836644588, 0.041695592866, 0.936730965393, 3.534918197732, -0.786103893985},
+	{1.25, -3.75, 2.5, 0.060950215170, -0.341936067899, 0.819696681861, 3.562741095793, -5.877270167238},
+	{-10.1, 7.3, 0.2, -0.325184885585, 0.602116961631, 0.364116131980, -5.025546920542, 4.519825969138},
+	{100.7, -250.9, 33.3, -0.044185956491, -0.058072786411, 0.707916146840, 104.720183612459, -244.497988313002},
+	{0.1, 0.2, 0.3, 0.011259617137, 0.010634813884, 0.977783346018, 3.322280514318, -1.604529594024},
+}
+
+var refFractal = Fractal{Octaves: 5, Frequency: 0.01, Lacunarity: 2, Gain: 0.5}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestSimplexReference(t *testing.T) {
+	s := NewSimplex(refSeed)
+	for _, r := range simplexRef {
+		if got := s.Noise2(r.x, r.y); !near(got, r.noise2) {
+			t.Errorf("Noise2(%v, %v) = %.12f, want %.12f", r.x, r.y, got, r.noise2)
+		}
+		if got := s.Noise3(r.x, r.y, r.z); !near(got, r.noise3) {
+			t.Errorf("Noise3(%v, %v, %v) = %.12f, want %.12f", r.x, r.y, r.z, got, r.noise3)
+		}
+	}
+}
+
+func TestFractalReference(t *testing.T) {
+	s := NewSimplex(refSeed)
+	f := refFractal
+	for _, r := range fractalRef {
+		if got := f.FBM2(s, r.x, r.y); !near(got, r.fbm2) {
+			t.Errorf("FBM2(%v, %v) = %.12f, want %.12f", r.x, r.y, got, r.fbm2)
+		}
+		if got := f.FBM3(s, r.x, r.y, r.z); !near(got, r.fbm3) {
+			t.Errorf("FBM3(%v, %v, %v) = %.12f, want %.12f", r.x, r.y, r.z, got, r.fbm3)
+		}
+		if got := f.Ridged2(s, r.x, r.y); !near(got, r.ridged2) {
+			t.Errorf("Ridged2(%v, %v) = %.12f, want %.12f", r.x, r.y, got, r.ridged2)
+		}
+		wx, wy := Warp2(s, f, r.x, r.y, 20)
+		if !near(wx, r.warpedX) || !near(wy, r.warpedY) {
+			t.Errorf("Warp2(%v, %v) = %.12f, %.12f, want %.12f, %.12f", r.x, r.y, wx, wy, r.warpedX, r.warpedY)
+		}
+	}
+}
+
+func TestSimplexLatticeIsZero(t *testing.T) {
+	s := NewSimplex(refSeed)
+	// Noise is zero on the corners of the simplex grid, which are the
+	// integer points of the skewed space
+	for i := -3; i <= 3; i++ {
+		for j := -3; j <= 3; j++ {
+			unskew := float64(i+j) * g2
+			x, y := float64(i)-unskew, float64(j)-unskew
+			if v := s.Noise2(x, y); math.Abs(v) > 1e-9 {
+				t.Errorf("Noise2(%v, %v) = %v, want 0", x, y, v)
+			}
+		}
+	}
+}
+
+func TestSimplexRangeAndContinuity(t *testing.T) {
+	s := NewSimplex(7)
+	rng := uint64(1)
+	for i := 0; i < 20000; i++ {
+		x := float64(SplitMix64(&rng)%100000)/100 - 500
+		y := float64(SplitMix64(&rng)%100000)/100 - 500
+		z := float64(SplitMix64(&rng)%100000)/100 - 500
+
+		n2, n3 := s.Noise2(x, y), s.Noise3(x, y, z)
+		if n2 < -1 || n2 > 1 || n3 < -1 || n3 > 1 {
+			t.Fatalf("noise out of range at %v,%v,%v: %v %v", x, y, z, n2, n3)
+		}
+
+		const eps = 1e-4
+		if d := math.Abs(s.Noise2(x+eps, y) - n2); d > 0.01 {
+			t.Fatalf("Noise2 jumps by %v at %v,%v", d, x, y)
+		}
+		if d := math.Abs(s.Noise3(x, y, z+eps) - n3); d > 0.01 {
+			t.Fatalf("Noise3 jumps by %v at %v,%v,%v", d, x, y, z)
+		}
+	}
+}
+
+func TestSeeds(t *testing.T) {
+	a, b, c := NewSimplex(1), NewSimplex(1), NewSimplex(2)
+	same, diff := 0, 0
+	for i := 0; i < 100; i++ {
+		x, y := float64(i)*0.37+0.1, float64(i)*-0.61+0.2
+		if a.Noise2(x, y) == b.Noise2(x, y) {
+			same++
+		}
+		if a.Noise2(x, y) != c.Noise2(x, y) {
+			diff++
+		}
+	}
+	if same != 100 {
+		t.Errorf("same seed gave different values")
+	}
+	if diff < 90 {
+		t.Errorf("different seeds gave the same value %d times", 100-diff)
+	}
+}
+
+func TestRidgedRange(t *testing.T) {
+	s := NewSimplex(3)
+	for i := 0; i < 5000; i++ {
+		v := refFractal.Ridged2(s, float64(i)*1.7, float64(i)*-2.3)
+		if v < 0 || v > 1 {
+			t.Fatalf("Ridged2 out of range: %v", v)
+		}
+	}
+}
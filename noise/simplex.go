@@ -0,0 +1,177 @@
+// Package noise implements seedable coherent noise for terrain generation:
+// 2D and 3D simplex noise plus fractal sums (fBm, ridged) and domain warping.
+//
+// Everything is deterministic: the same seed and coordinates always give the
+// same value, on every platform.
+package noise
+
+import "math"
+
+// Source2 is a 2D noise function returning values in about -1..1.
+type Source2 interface {
+	Noise2(x, y float64) float64
+}
+
+// Source3 is a 3D noise function returning values in about -1..1.
+type Source3 interface {
+	Noise3(x, y, z float64) float64
+}
+
+// Simplex is seeded simplex noise (after Stefan Gustavson's reference
+// implementation).
+type Simplex struct {
+	perm [512]uint8
+}
+
+// NewSimplex creates simplex noise whose permutation table is shuffled from
+// seed.
+func NewSimplex(seed int64) *Simplex {
+	s := &Simplex{}
+	var p [256]uint8
+	for i := range p {
+		p[i] = uint8(i)
+	}
+	rng := uint64(seed)
+	for i := 255; i > 0; i-- {
+		j := int(SplitMix64(&rng) % uint64(i+1))
+		p[i], p[j] = p[j], p[i]
+	}
+	for i := range s.perm {
+		s.perm[i] = p[i&255]
+	}
+	return s
+}
+
+// SplitMix64 advances state and returns the next pseudo-random number. It is
+// tiny, fast and stable across Go versions, which math/rand does not promise
+// for every generator.
+func SplitMix64(state *uint64) uint64 {
+	*state += 0x9e3779b97f4a7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+var grad3 = [12][3]float64{
+	{1, 1, 0}, {-1, 1, 0}, {1, -1, 0}, {-1, -1, 0},
+	{1, 0, 1}, {-1, 0, 1}, {1, 0, -1}, {-1, 0, -1},
+	{0, 1, 1}, {0, -1, 1}, {0, 1, -1}, {0, -1, -1},
+}
+
+var (
+	f2 = 0.5 * (math.Sqrt(3) - 1)
+	g2 = (3 - math.Sqrt(3)) / 6
+)
+
+const (
+	f3 = 1.0 / 3.0
+	g3 = 1.0 / 6.0
+)
+
+func fastFloor(v float64) int {
+	i := int(v)
+	if v < float64(i) {
+		return i - 1
+	}
+	return i
+}
+
+func (s *Simplex) gradIndex2(i, j int) int {
+	return int(s.perm[i+int(s.perm[j])]) % 12
+}
+
+func (s *Simplex) gradIndex3(i, j, k int) int {
+	return int(s.perm[i+int(s.perm[j+int(s.perm[k])])]) % 12
+}
+
+// Noise2 returns 2D simplex noise at x, y, in -1..1.
+func (s *Simplex) Noise2(x, y float64) float64 {
+	// Skew the input space to find the simplex cell
+	sk := (x + y) * f2
+	i, j := fastFloor(x+sk), fastFloor(y+sk)
+	t := float64(i+j) * g2
+	x0, y0 := x-(float64(i)-t), y-(float64(j)-t)
+
+	// Which of the two triangles of the cell we are in
+	i1, j1 := 0, 1
+	if x0 > y0 {
+		i1, j1 = 1, 0
+	}
+
+	x1, y1 := x0-float64(i1)+g2, y0-float64(j1)+g2
+	x2, y2 := x0-1+2*g2, y0-1+2*g2
+
+	ii, jj := i&255, j&255
+	corners := [3]struct {
+		x, y float64
+		g    int
+	}{
+		{x0, y0, s.gradIndex2(ii, jj)},
+		{x1, y1, s.gradIndex2(ii+i1, jj+j1)},
+		{x2, y2, s.gradIndex2(ii+1, jj+1)},
+	}
+
+	n := 0.0
+	for _, c := range corners {
+		t := 0.5 - c.x*c.x - c.y*c.y
+		if t > 0 {
+			t *= t
+			g := grad3[c.g]
+			n += t * t * (g[0]*c.x + g[1]*c.y)
+		}
+	}
+	return 70 * n
+}
+
+// Noise3 returns 3D simplex noise at x, y, z, in -1..1.
+func (s *Simplex) Noise3(x, y, z float64) float64 {
+	sk := (x + y + z) * f3
+	i, j, k := fastFloor(x+sk), fastFloor(y+sk), fastFloor(z+sk)
+	t := float64(i+j+k) * g3
+	x0, y0, z0 := x-(float64(i)-t), y-(float64(j)-t), z-(float64(k)-t)
+
+	// Which of the six tetrahedra of the cell we are in
+	var i1, j1, k1, i2, j2, k2 int
+	if x0 >= y0 {
+		switch {
+		case y0 >= z0:
+			i1, j1, k1, i2, j2, k2 = 1, 0, 0, 1, 1, 0
+		case x0 >= z0:
+			i1, j1, k1, i2, j2, k2 = 1, 0, 0, 1, 0, 1
+		default:
+			i1, j1, k1, i2, j2, k2 = 0, 0, 1, 1, 0, 1
+		}
+	} else {
+		switch {
+		case y0 < z0:
+			i1, j1, k1, i2, j2, k2 = 0, 0, 1, 0, 1, 1
+		case x0 < z0:
+			i1, j1, k1, i2, j2, k2 = 0, 1, 0, 0, 1, 1
+		default:
+			i1, j1, k1, i2, j2, k2 = 0, 1, 0, 1, 1, 0
+		}
+	}
+
+	ii, jj, kk := i&255, j&255, k&255
+	corners := [4]struct {
+		x, y, z float64
+		g       int
+	}{
+		{x0, y0, z0, s.gradIndex3(ii, jj, kk)},
+		{x0 - float64(i1) + g3, y0 - float64(j1) + g3, z0 - float64(k1) + g3, s.gradIndex3(ii+i1, jj+j1, kk+k1)},
+		{x0 - float64(i2) + 2*g3, y0 - float64(j2) + 2*g3, z0 - float64(k2) + 2*g3, s.gradIndex3(ii+i2, jj+j2, kk+k2)},
+		{x0 - 1 + 3*g3, y0 - 1 + 3*g3, z0 - 1 + 3*g3, s.gradIndex3(ii+1, jj+1, kk+1)},
+	}
+
+	n := 0.0
+	for _, c := range corners {
+		t := 0.6 - c.x*c.x - c.y*c.y - c.z*c.z
+		if t > 0 {
+			t *= t
+			g := grad3[c.g]
+			n += t * t * (g[0]*c.x + g[1]*c.y + g[2]*c.z)
+		}
+	}
+	return 32 * n
+}
@@ -0,0 +1,186 @@
+// Package physics moves boxes through the voxel world.
+//
+// Move sweeps a box along a displacement one axis at a time, Y then X then
+// Z, and cuts each part short at the first collision box in the way, so
+// the box ends up exactly against what it hit instead of inside it or
+// hovering above it, and keeps moving along the other axes: it slides
+// along walls and stops on floors. A box on the ground also climbs ledges
+// up to its step height on its own. Boxes it already overlaps do not stop
+// it, so it can always get out of a block placed on it.
+package physics
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+// World is what boxes move through. *world.World implements it.
+type World interface {
+	GetBlock(p world.BlockPos) int
+}
+
+// Body is the box of something that moves, such as the player.
+type Body struct {
+	HalfWidth  float32 // Half its width and depth
+	Height     float32
+	StepHeight float32 // Highest ledge it climbs without jumping
+}
+
+// Contacts tells which sides of a body were stopped during a move.
+type Contacts struct {
+	Ground  bool // Moving down
+	Ceiling bool // Moving up
+	WallX   bool // Moving along X
+	WallZ   bool // Moving along Z
+}
+
+// touch is how close a box must be to count as ahead of a body rather
+// than overlapping it, for rounding errors.
+const touch = 1e-4
+
+// box is an axis-aligned box in world coordinates.
+type box struct {
+	min, max [3]float32
+}
+
+// boxAt returns the box of a body standing at pos, the centre of its
+// bottom face.
+func (b Body) boxAt(pos mgl32.Vec3) box {
+	return box{
+		[3]float32{pos[0] - b.HalfWidth, pos[1], pos[2] - b.HalfWidth},
+		[3]float32{pos[0] + b.HalfWidth, pos[1] + b.Height, pos[2] + b.HalfWidth},
+	}
+}
+
+// Move moves a body at pos by delta, and returns where it stopped and what
+// stopped it. onGround says whether the body stood on something before the
+// move; if it did, or lands during the move, and a ledge up to StepHeight
+// stops it along X or Z, it climbs on the ledge.
+func Move(w World, reg *block.Registry, b Body, pos, delta mgl32.Vec3, onGround bool) (mgl32.Vec3, Contacts) {
+	boxes := collisionBoxes(w, reg, b, pos, delta)
+	moved, c := sweep(boxes, b, pos, delta)
+	if b.StepHeight <= 0 || !(c.WallX || c.WallZ) || !(onGround || c.Ground) || delta[1] > 0 {
+		return moved, c
+	}
+
+	// Try again from StepHeight higher, then go back down
+	up, _ := sweep(boxes, b, pos, mgl32.Vec3{0, b.StepHeight, 0})
+	stepped, sc := sweep(boxes, b, up, mgl32.Vec3{delta[0], 0, delta[2]})
+	down, dc := sweep(boxes, b, stepped, mgl32.Vec3{0, pos[1] + min(delta[1], 0) - up[1], 0})
+	if horizontal(down.Sub(pos)) <= horizontal(moved.Sub(pos)) {
+		return moved, c
+	}
+	return down, Contacts{Ground: c.Ground || dc.Ground, WallX: sc.WallX, WallZ: sc.WallZ}
+}
+
+func horizontal(v mgl32.Vec3) float32 {
+	return v[0]*v[0] + v[2]*v[2]
+}
+
+// sweep moves a body along Y, X and Z in turn, each time as far as the
+// boxes let it.
+func sweep(boxes []box, b Body, pos, delta mgl32.Vec3) (mgl32.Vec3, Contacts) {
+	var c Contacts
+	for _, axis := range [3]int{1, 0, 2} {
+		if delta[axis] == 0 {
+			continue
+		}
+		var stopped bool
+		pos, stopped = clip(boxes, b, pos, axis, delta[axis])
+		if stopped {
+			switch {
+			case axis == 1 && delta[axis] < 0:
+				c.Ground = true
+			case axis == 1:
+				c.Ceiling = true
+			case axis == 0:
+				c.WallX = true
+			default:
+				c.WallZ = true
+			}
+		}
+	}
+	return pos, c
+}
+
+// clip moves a body at pos by d along one axis, stopping it against the
+// first box ahead. The coordinate it stops at is the box's face, exactly.
+func clip(boxes []box, b Body, pos mgl32.Vec3, axis int, d float32) (mgl32.Vec3, bool) {
+	body := b.boxAt(pos)
+	// The body's low side moves from lo to target
+	lo := body.min[axis]
+	size := body.max[axis] - body.min[axis]
+	target := lo + d
+	stopped := false
+	for _, bx := range boxes {
+		if !overlapsOthers(body, bx, axis) {
+			continue
+		}
+		if d > 0 && bx.min[axis] >= body.max[axis]-touch && bx.min[axis]-size < target {
+			target, stopped = bx.min[axis]-size, true
+		} else if d < 0 && bx.max[axis] <= lo+touch && bx.max[axis] > target {
+			target, stopped = bx.max[axis], true
+		}
+	}
+	switch {
+	case !stopped:
+		pos[axis] += d
+	case axis == 1:
+		pos[1] = target
+	default:
+		pos[axis] = target + b.HalfWidth
+	}
+	return pos, stopped
+}
+
+// overlapsOthers reports whether two boxes overlap on the two axes other
+// than axis.
+func overlapsOthers(a, b box, axis int) bool {
+	for i := range 3 {
+		if i != axis && (a.max[i] <= b.min[i]+touch || a.min[i] >= b.max[i]-touch) {
+			return false
+		}
+	}
+	return true
+}
+
+// collisionBoxes returns the collision boxes of the blocks a body could
+// touch moving by delta from pos, or stepping up on the way.
+func collisionBoxes(w World, reg *block.Registry, b Body, pos, delta mgl32.Vec3) []box {
+	from, to := b.boxAt(pos), b.boxAt(pos.Add(delta))
+	var lo, hi [3]int
+	for i := range 3 {
+		// Blocks are centred on integer coordinates
+		lo[i] = int(math.Floor(float64(min(from.min[i], to.min[i])) + 0.5))
+		hi[i] = int(math.Floor(float64(max(from.max[i], to.max[i])) + 0.5))
+	}
+	// One more layer below for collision boxes taller than a block, such
+	// as fences, and the ledges above for stepping up
+	lo[1]--
+	hi[1] += int(math.Ceil(float64(b.StepHeight)))
+
+	var boxes []box
+	for x := lo[0]; x <= hi[0]; x++ {
+		for y := lo[1]; y <= hi[1]; y++ {
+			for z := lo[2]; z <= hi[2]; z++ {
+				shape := reg.Shape(w.GetBlock(world.BlockPos{X: x, Y: y, Z: z}))
+				if shape == nil {
+					continue
+				}
+				corner := [3]float32{float32(x) - 0.5, float32(y) - 0.5, float32(z) - 0.5}
+				for _, c := range shape.Collision {
+					var bx box
+					for i := range 3 {
+						bx.min[i], bx.max[i] = corner[i]+c.Min[i], corner[i]+c.Max[i]
+					}
+					boxes = append(boxes, bx)
+				}
+			}
+		}
+	}
+	return boxes
+}
@@ -0,0 +1,142 @@
+package physics
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+func testRegistry(t *testing.T) *block.Registry {
+	t.Helper()
+	r, err := block.Parse([]byte(`{"blocks": [
+		{"id": 1, "name": "stone", "textures": {"all": "stone"}, "solid": true},
+		{"id": 2, "name": "slab", "textures": {"all": "stone"}, "solid": true, "model": "slab"},
+		{"id": 3, "name": "fence", "textures": {"all": "planks"}, "solid": true, "model": "post"},
+		{"id": 4, "name": "flower", "textures": {"all": "flower"}, "model": "plant"}
+	], "models": {
+		"slab": {"elements": [{"from": [0, 0, 0], "to": [16, 8, 16]}]},
+		"post": {"elements": [{"from": [6, 0, 6], "to": [10, 16, 10]}], "collision": [[6, 0, 6, 10, 24, 10]]},
+		"plant": {"type": "cross"}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+const (
+	stone  = 1
+	slab   = 2
+	fence  = 3
+	flower = 4
+)
+
+// player is the size of the player, 0.8 wide and 2 high.
+var player = Body{HalfWidth: 0.4, Height: 2, StepHeight: 0.5}
+
+// testWorld returns a world with a stone floor at y=0, whose top is at 0.5,
+// and the given blocks.
+func testWorld(blocks map[world.BlockPos]int) *world.World {
+	w := world.New()
+	for x := -4; x <= 4; x++ {
+		for z := -4; z <= 4; z++ {
+			w.SetBlock(world.BlockPos{X: x, Y: 0, Z: z}, stone)
+		}
+	}
+	for p, state := range blocks {
+		w.SetBlock(p, state)
+	}
+	return w
+}
+
+func TestMove(t *testing.T) {
+	reg := testRegistry(t)
+	type at = world.BlockPos
+	cases := []struct {
+		name       string
+		blocks     map[at]int
+		pos, delta mgl32.Vec3
+		onGround   bool
+
+		want     mgl32.Vec3
+		contacts Contacts
+	}{
+		{"falls onto the floor", nil, mgl32.Vec3{0, 3, 0}, mgl32.Vec3{0, -5, 0}, false,
+			mgl32.Vec3{0, 0.5, 0}, Contacts{Ground: true}},
+		{"stays on the floor", nil, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{0, -0.01, 0}, true,
+			mgl32.Vec3{0, 0.5, 0}, Contacts{Ground: true}},
+		{"falls freely", nil, mgl32.Vec3{0, 3, 0}, mgl32.Vec3{0, -1, 0}, false,
+			mgl32.Vec3{0, 2, 0}, Contacts{}},
+		{"bumps the ceiling", map[at]int{{Y: 3}: stone}, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{0, 1, 0}, true,
+			mgl32.Vec3{0, 0.5, 0}, Contacts{Ceiling: true}},
+		{"jumps to the ceiling", map[at]int{{Y: 4}: stone}, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{0, 2, 0}, true,
+			mgl32.Vec3{0, 1.5, 0}, Contacts{Ceiling: true}},
+		{"stops at a wall", map[at]int{{X: 2, Y: 1}: stone, {X: 2, Y: 2}: stone}, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{3, 0, 0}, true,
+			mgl32.Vec3{1.1, 0.5, 0}, Contacts{WallX: true}},
+		{"does not tunnel", map[at]int{{X: 2, Y: 1}: stone, {X: 2, Y: 2}: stone}, mgl32.Vec3{-1, 0.5, 0}, mgl32.Vec3{100, 0, 0}, true,
+			mgl32.Vec3{1.1, 0.5, 0}, Contacts{WallX: true}},
+		{"slides along a wall", map[at]int{{Z: -2, Y: 1}: stone, {X: 1, Z: -2, Y: 1}: stone, {X: 2, Z: -2, Y: 1}: stone}, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{1.5, 0, -2}, true,
+			mgl32.Vec3{1.5, 0.5, -1.1}, Contacts{WallZ: true}},
+		{"steps up a slab", map[at]int{{X: 1, Y: 1}: slab}, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{0.8, -0.01, 0}, true,
+			mgl32.Vec3{0.8, 1, 0}, Contacts{Ground: true}},
+		{"steps up from a slab to a block", map[at]int{{Y: 1}: slab, {X: 1, Y: 1}: stone}, mgl32.Vec3{0, 1, 0}, mgl32.Vec3{0.8, -0.01, 0}, true,
+			mgl32.Vec3{0.8, 1.5, 0}, Contacts{Ground: true}},
+		{"does not step up a block", map[at]int{{X: 1, Y: 1}: stone}, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{0.8, -0.01, 0}, true,
+			mgl32.Vec3{0.1, 0.5, 0}, Contacts{Ground: true, WallX: true}},
+		{"does not step up in the air", map[at]int{{X: 1, Y: 1}: slab}, mgl32.Vec3{0, 0.7, 0}, mgl32.Vec3{0.8, 0.1, 0}, false,
+			mgl32.Vec3{0.1, 0.8, 0}, Contacts{WallX: true}},
+		{"does not step up without headroom", map[at]int{{X: 1, Y: 1}: slab, {Y: 3}: stone}, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{0.8, -0.01, 0}, true,
+			mgl32.Vec3{0.1, 0.5, 0}, Contacts{Ground: true, WallX: true}},
+		{"does not step over a fence", map[at]int{{X: 1, Y: 1}: fence}, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{0.8, -0.01, 0}, true,
+			mgl32.Vec3{0.475, 0.5, 0}, Contacts{Ground: true, WallX: true}},
+		{"lands on a fence", map[at]int{{Y: 1}: fence}, mgl32.Vec3{0, 3, 0}, mgl32.Vec3{0, -2, 0}, false,
+			mgl32.Vec3{0, 2, 0}, Contacts{Ground: true}},
+		{"walks through flowers", map[at]int{{X: 1, Y: 1}: flower}, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{0.8, 0, 0}, true,
+			mgl32.Vec3{0.8, 0.5, 0}, Contacts{}},
+		{"gets out of a block", map[at]int{{Y: 1}: stone}, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{1, 0, 0}, true,
+			mgl32.Vec3{1, 0.5, 0}, Contacts{}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pos, contacts := Move(testWorld(c.blocks), reg, player, c.pos, c.delta, c.onGround)
+			if !pos.ApproxEqualThreshold(c.want, 1e-5) || contacts != c.contacts {
+				t.Errorf("Move = %v, %+v; want %v, %+v", pos, contacts, c.want, c.contacts)
+			}
+		})
+	}
+}
+
+func TestSnapsExactly(t *testing.T) {
+	reg := testRegistry(t)
+	w := testWorld(nil)
+	// Falling by uneven steps ends exactly on the floor, and stays there
+	pos := mgl32.Vec3{0.3, 4.123, -0.7}
+	for range 100 {
+		pos, _ = Move(w, reg, player, pos, mgl32.Vec3{0, -0.137, 0}, false)
+	}
+	if pos[1] != 0.5 {
+		t.Errorf("feet at y %v, want exactly 0.5", pos[1])
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	reg := testRegistry(t)
+	w := testWorld(map[world.BlockPos]int{{X: 2, Y: 1}: slab, {X: 3, Y: 1}: stone, {X: 3, Y: 2}: stone, {Z: 2, Y: 1}: fence})
+	walk := func() mgl32.Vec3 {
+		pos, ground := mgl32.Vec3{-1, 3, -1}, false
+		for i := range 200 {
+			var c Contacts
+			delta := mgl32.Vec3{0.05, -0.2, 0.04 * float32(i%3)}
+			pos, c = Move(w, reg, player, pos, delta, ground)
+			ground = c.Ground
+		}
+		return pos
+	}
+	first := walk()
+	if again := walk(); again != first {
+		t.Errorf("walks end at %v and %v", first, again)
+	}
+}
@@ -0,0 +1,241 @@
+// Package prefab loads blueprints of block structures, such as trees,
+// boulders and ruins, that the world generator places on the terrain.
+//
+// A blueprint is a JSON file (see the prefabs directory at the repository
+// root): a palette of characters to block states, such as "log" or
+// "log[axis=x]", and the layers of the structure, bottom to top, drawn as
+// rows of characters. It also says where the structure may stand and how
+// often, so new decorations can be added without touching Go code.
+package prefab
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"craft3d/block"
+)
+
+// Empty marks a cell of a prefab that leaves the world as it is.
+const Empty = -1
+
+// Prefab is a loaded blueprint.
+type Prefab struct {
+	Name   string
+	Size   [3]int // Cells along X, Y and Z
+	Origin [3]int // Cell placed just above the ground
+	Rotate bool   // Turn by a random multiple of 90° when placed
+
+	on     map[int]bool       // Block IDs it can stand on
+	chance map[string]float64 // Chance per column, by biome name
+	cells  []int              // Block states, Empty or air, index (y*Size.Z+z)*Size.X+x
+	turned [4]map[int]int     // States changed by each number of quarter turns
+}
+
+type file struct {
+	On      []string           `json:"on"`     // Blocks the prefab can stand on
+	Chance  map[string]float64 `json:"chance"` // Per biome name, "*" for any other biome
+	Rotate  bool               `json:"rotate"`
+	Origin  [3]int             `json:"origin"`
+	Palette map[string]string  `json:"palette"` // One character -> block state, "air" to clear
+	Layers  [][]string         `json:"layers"`  // Bottom to top, rows along Z, characters along X
+}
+
+// Load reads the blueprint at path. The prefab is named after the file.
+func Load(path string, reg *block.Registry, biomes []string) (*Prefab, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	p, err := Parse(name, data, reg, biomes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// LoadDir reads every .json blueprint in dir, sorted by name.
+func LoadDir(dir string, reg *block.Registry, biomes []string) ([]*Prefab, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	list := make([]*Prefab, 0, len(files))
+	for _, f := range files {
+		p, err := Load(f, reg, biomes)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// Parse builds a prefab from a JSON blueprint. Its chances may only name
+// the given biomes, so a misspelt or renamed biome is an error rather than
+// a decoration that never appears.
+func Parse(name string, data []byte, reg *block.Registry, biomes []string) (*Prefab, error) {
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	p := &Prefab{
+		Name:   name,
+		Origin: f.Origin,
+		Rotate: f.Rotate,
+		on:     map[int]bool{},
+		chance: f.Chance,
+	}
+	for _, n := range f.On {
+		id := reg.ID(n)
+		if id == 0 {
+			return nil, fmt.Errorf("unknown block %q in on", n)
+		}
+		p.on[id] = true
+	}
+	for biome, c := range f.Chance {
+		if biome != "*" && !slices.Contains(biomes, biome) {
+			return nil, fmt.Errorf("unknown biome %q in chance", biome)
+		}
+		if c < 0 || c > 1 {
+			return nil, fmt.Errorf("chance in %s must be 0 to 1, got %g", biome, c)
+		}
+	}
+
+	palette := map[rune]int{'.': Empty, ' ': Empty}
+	for key, n := range f.Palette {
+		r := []rune(key)
+		if len(r) != 1 {
+			return nil, fmt.Errorf("palette key %q must be one character", key)
+		}
+		state, err := reg.ParseState(n)
+		if err != nil {
+			return nil, fmt.Errorf("palette: %w", err)
+		}
+		palette[r[0]] = state
+		if b := reg.Get(state); b != nil {
+			for turns := 1; turns < 4; turns++ {
+				if t := b.Rotate(state, turns); t != state {
+					if p.turned[turns] == nil {
+						p.turned[turns] = map[int]int{}
+					}
+					p.turned[turns][state] = t
+				}
+			}
+		}
+	}
+
+	if len(f.Layers) == 0 || len(f.Layers[0]) == 0 {
+		return nil, fmt.Errorf("no layers")
+	}
+	p.Size = [3]int{len([]rune(f.Layers[0][0])), len(f.Layers), len(f.Layers[0])}
+	for y, layer := range f.Layers {
+		if len(layer) != p.Size[2] {
+			return nil, fmt.Errorf("layer %d has %d rows, want %d", y, len(layer), p.Size[2])
+		}
+		for z, row := range layer {
+			cells := []rune(row)
+			if len(cells) != p.Size[0] {
+				return nil, fmt.Errorf("layer %d row %d has %d cells, want %d", y, z, len(cells), p.Size[0])
+			}
+			for _, c := range cells {
+				id, ok := palette[c]
+				if !ok {
+					return nil, fmt.Errorf("layer %d row %d: %q is not in the palette", y, z, c)
+				}
+				p.cells = append(p.cells, id)
+			}
+		}
+	}
+	for i, o := range p.Origin {
+		if o < 0 || o >= p.Size[i] {
+			return nil, fmt.Errorf("origin %v is outside the prefab (size %v)", p.Origin, p.Size)
+		}
+	}
+	return p, nil
+}
+
+// CanStandOn reports whether the prefab may be placed on top of a block
+// state.
+func (p *Prefab) CanStandOn(state int) bool {
+	return p.on[block.TypeOf(state)]
+}
+
+// Chance returns the chance that the prefab is placed on a column of the
+// named biome.
+func (p *Prefab) Chance(biome string) float64 {
+	if c, ok := p.chance[biome]; ok {
+		return c
+	}
+	return p.chance["*"]
+}
+
+// MaxChance returns the highest chance over all biomes.
+func (p *Prefab) MaxChance() float64 {
+	m := 0.0
+	for _, c := range p.chance {
+		m = max(m, c)
+	}
+	return m
+}
+
+// Reach returns how far the prefab extends from its origin on the X and Z
+// axes, in any rotation.
+func (p *Prefab) Reach() int {
+	return max(p.Origin[0], p.Size[0]-1-p.Origin[0], p.Origin[2], p.Size[2]-1-p.Origin[2])
+}
+
+// Below returns how many cells the prefab extends under its origin.
+func (p *Prefab) Below() int {
+	return p.Origin[1]
+}
+
+// Above returns how many cells the prefab extends over its origin.
+func (p *Prefab) Above() int {
+	return p.Size[1] - 1 - p.Origin[1]
+}
+
+// Each calls fn for every non-empty cell with its offset from the origin,
+// after turning the prefab by turns quarter turns around the Y axis. Block
+// states turn with the prefab, so a log lying along X lies along Z after an
+// odd number of turns.
+func (p *Prefab) Each(turns int, fn func(dx, dy, dz, id int)) {
+	turned := p.turned[turns&3]
+	i := 0
+	for y := 0; y < p.Size[1]; y++ {
+		for z := 0; z < p.Size[2]; z++ {
+			for x := 0; x < p.Size[0]; x++ {
+				id := p.cells[i]
+				i++
+				if id == Empty {
+					continue
+				}
+				if t, ok := turned[id]; ok {
+					id = t
+				}
+				dx, dz := rotate(x-p.Origin[0], z-p.Origin[2], turns)
+				fn(dx, y-p.Origin[1], dz, id)
+			}
+		}
+	}
+}
+
+// rotate turns an offset by a multiple of 90° around the Y axis.
+func rotate(dx, dz, turns int) (int, int) {
+	switch turns & 3 {
+	case 1:
+		return -dz, dx
+	case 2:
+		return -dx, -dz
+	case 3:
+		return dz, -dx
+	}
+	return dx, dz
+}
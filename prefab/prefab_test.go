@@ -0,0 +1,149 @@
+package prefab
+
+import (
+	"testing"
+
+	"craft3d/block"
+)
+
+func testRegistry(t *testing.T) *block.Registry {
+	t.Helper()
+	reg, err := block.Parse([]byte(`{"blocks": [
+		{"id": 1, "name": "grass", "textures": {"all": "grass"}},
+		{"id": 2, "name": "log", "textures": {"all": "log"},
+		 "properties": [{"name": "axis", "values": ["y", "x", "z"], "kind": "axis"}]},
+		{"id": 3, "name": "leaves", "textures": {"all": "leaves"}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+// biomes are the biome names the tests' prefabs may use.
+var biomes = []string{"plains", "desert", "forest", "tundra", "ocean", "mountains"}
+
+const tree = `{
+	"on": ["grass"],
+	"chance": {"forest": 0.5, "*": 0.1},
+	"rotate": true,
+	"origin": [1, 0, 0],
+	"palette": {"L": "log", "#": "leaves", "_": "air"},
+	"layers": [
+		["_L.", "..."],
+		["###", "#.."]
+	]
+}`
+
+func TestParse(t *testing.T) {
+	p, err := Parse("tree", []byte(tree), testRegistry(t), biomes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Size != [3]int{3, 2, 2} {
+		t.Errorf("Size = %v", p.Size)
+	}
+	if !p.CanStandOn(1) || p.CanStandOn(2) {
+		t.Errorf("CanStandOn mismatch")
+	}
+	if p.Chance("forest") != 0.5 || p.Chance("desert") != 0.1 || p.MaxChance() != 0.5 {
+		t.Errorf("chances = %v %v %v", p.Chance("forest"), p.Chance("desert"), p.MaxChance())
+	}
+	if p.Reach() != 1 || p.Below() != 0 || p.Above() != 1 {
+		t.Errorf("Reach, Below, Above = %d, %d, %d", p.Reach(), p.Below(), p.Above())
+	}
+
+	cells := map[[3]int]int{}
+	p.Each(0, func(dx, dy, dz, id int) { cells[[3]int{dx, dy, dz}] = id })
+	want := map[[3]int]int{
+		{-1, 0, 0}: 0, {0, 0, 0}: 2,
+		{-1, 1, 0}: 3, {0, 1, 0}: 3, {1, 1, 0}: 3, {-1, 1, 1}: 3,
+	}
+	if len(cells) != len(want) {
+		t.Fatalf("cells = %v, want %v", cells, want)
+	}
+	for k, id := range want {
+		if cells[k] != id {
+			t.Errorf("cell %v = %d, want %d", k, cells[k], id)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	p, err := Parse("tree", []byte(tree), testRegistry(t), biomes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A quarter turn maps +X to +Z; four turns are the identity
+	for turns, want := range [][3]int{{1, 1, 0}, {0, 1, 1}, {-1, 1, 0}, {0, 1, -1}, {1, 1, 0}} {
+		found := false
+		p.Each(turns, func(dx, dy, dz, id int) {
+			if [3]int{dx, dy, dz} == want && id == 3 {
+				found = true
+			}
+		})
+		if !found {
+			t.Errorf("%d turns: no leaves at %v", turns, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"bad json":        `{"layers": [`,
+		"unknown on":      `{"on": ["stone"], "palette": {}, "layers": [["."]]}`,
+		"unknown block":   `{"palette": {"S": "stone"}, "layers": [["S"]]}`,
+		"long key":        `{"palette": {"LL": "log"}, "layers": [["."]]}`,
+		"no layers":       `{"palette": {}, "layers": []}`,
+		"ragged rows":     `{"palette": {}, "layers": [["..", "."]]}`,
+		"ragged layers":   `{"palette": {}, "layers": [["..", ".."], [".."]]}`,
+		"not in palette":  `{"palette": {}, "layers": [["x"]]}`,
+		"origin outside":  `{"origin": [0, 3, 0], "palette": {}, "layers": [["."]]}`,
+		"chance too high": `{"chance": {"*": 2}, "palette": {}, "layers": [["."]]}`,
+		"unknown biome":   `{"chance": {"forrest": 0.1}, "palette": {}, "layers": [["."]]}`,
+	}
+	reg := testRegistry(t)
+	for name, data := range cases {
+		if _, err := Parse(name, []byte(data), reg, biomes); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadRepositoryPrefabs(t *testing.T) {
+	reg, err := block.Load("../blocks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefabs, err := LoadDir("../prefabs", reg, biomes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prefabs) == 0 {
+		t.Fatalf("no prefabs in ../prefabs")
+	}
+	for i := 1; i < len(prefabs); i++ {
+		if prefabs[i-1].Name >= prefabs[i].Name {
+			t.Errorf("prefabs not sorted: %s before %s", prefabs[i-1].Name, prefabs[i].Name)
+		}
+	}
+}
+
+func TestStatesTurn(t *testing.T) {
+	reg := testRegistry(t)
+	p, err := Parse("fallen", []byte(`{"palette": {"L": "log[axis=x]"}, "layers": [["LL"]]}`), reg, biomes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := reg.ByName("log")
+	for turns, axis := range []string{"x", "z", "x", "z"} {
+		p.Each(turns, func(dx, dy, dz, id int) {
+			if got := log.Value(id, "axis"); got != axis {
+				t.Errorf("%d turns: axis %s, want %s", turns, got, axis)
+			}
+		})
+	}
+	if _, err := Parse("bad", []byte(`{"palette": {"L": "log[axis=w]"}, "layers": [["L"]]}`), reg, biomes); err == nil {
+		t.Errorf("bad state in the palette accepted")
+	}
+}
@@ -0,0 +1,147 @@
+// Package raycast finds the block a ray points at.
+//
+// Cast walks the grid cell by cell with the traversal of Amanatides and
+// Woo ("A Fast Voxel Traversal Algorithm for Ray Tracing", 1987): from the
+// cell holding the origin, it steps to whichever neighbour the ray reaches
+// first, so no cell along the ray is skipped, however thin the slice of it
+// the ray crosses. In each cell the ray is tested against the selection
+// boxes of the block there, so slabs and plants are only hit where they
+// are drawn.
+package raycast
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+// World is what rays are cast through. *world.World implements it.
+type World interface {
+	GetBlock(p world.BlockPos) int
+}
+
+// Hit is where a ray meets a block.
+type Hit struct {
+	Block    world.BlockPos
+	State    int
+	Normal   [3]int         // Outward normal of the face hit, zero if the ray starts inside the box
+	Distance float32        // From the ray's origin
+	Point    mgl32.Vec3     // Where the ray hits
+	Adjacent world.BlockPos // Across the face hit, where a block placed against it goes
+}
+
+// Cast follows a ray from origin along dir, which need not be a unit
+// vector, for up to reach blocks, and returns the first selection box it
+// hits. skip, if not nil, is called with every cell the ray goes through,
+// in order, and makes the ray go through the cells it returns true for.
+//
+// A ray starting on the boundary between cells starts in the cell on the
+// positive side, and a ray through an edge or corner steps along X before
+// Y before Z. Rays that graze a box hit it.
+func Cast(w World, reg *block.Registry, origin, dir mgl32.Vec3, reach float32, skip func(p world.BlockPos, state int) bool) (Hit, bool) {
+	if dir.Len() == 0 {
+		return Hit{}, false
+	}
+	dir = dir.Normalize()
+
+	// Cell boundaries are at half coordinates, see world.BlockPos
+	var (
+		cell         [3]int
+		step         [3]int
+		tMax, tDelta [3]float64
+		o, d         [3]float64
+	)
+	for i := range 3 {
+		o[i], d[i] = float64(origin[i]), float64(dir[i])
+		cell[i] = int(math.Floor(o[i] + 0.5))
+		switch {
+		case d[i] > 0:
+			step[i], tDelta[i] = 1, 1/d[i]
+			tMax[i] = (float64(cell[i]) + 0.5 - o[i]) / d[i]
+		case d[i] < 0:
+			step[i], tDelta[i] = -1, -1/d[i]
+			tMax[i] = (float64(cell[i]) - 0.5 - o[i]) / d[i]
+		default:
+			tMax[i], tDelta[i] = math.Inf(1), math.Inf(1)
+		}
+	}
+
+	for t := 0.0; t <= float64(reach); {
+		p := world.BlockPos{X: cell[0], Y: cell[1], Z: cell[2]}
+		state := w.GetBlock(p)
+		if skip == nil || !skip(p, state) {
+			if h, ok := hitBoxes(reg.Shape(state), p, o, d); ok && h.Distance <= reach {
+				h.State = state
+				h.Point = origin.Add(dir.Mul(h.Distance))
+				return h, true
+			}
+		}
+		axis := 0
+		if tMax[1] < tMax[axis] {
+			axis = 1
+		}
+		if tMax[2] < tMax[axis] {
+			axis = 2
+		}
+		t = tMax[axis]
+		cell[axis] += step[axis]
+		tMax[axis] += tDelta[axis]
+	}
+	return Hit{}, false
+}
+
+// hitBoxes intersects a ray with the selection boxes of a shape at p, and
+// returns the nearest hit in front of the origin.
+func hitBoxes(shape *block.Shape, p world.BlockPos, o, d [3]float64) (Hit, bool) {
+	if shape == nil {
+		return Hit{}, false
+	}
+	corner := [3]float64{float64(p.X) - 0.5, float64(p.Y) - 0.5, float64(p.Z) - 0.5}
+	var best Hit
+	found := false
+	for _, b := range shape.Selection {
+		// Slab method: the ray is inside the box between the last of the
+		// entries and the first of the exits of the three pairs of planes
+		near, far := math.Inf(-1), math.Inf(1)
+		axis := -1
+		inside := true
+		for i := range 3 {
+			lo, hi := corner[i]+float64(b.Min[i]), corner[i]+float64(b.Max[i])
+			if d[i] == 0 {
+				if o[i] < lo || o[i] > hi {
+					inside = false
+					break
+				}
+				continue
+			}
+			t1, t2 := (lo-o[i])/d[i], (hi-o[i])/d[i]
+			if t1 > t2 {
+				t1, t2 = t2, t1
+			}
+			if t1 > near {
+				near, axis = t1, i
+			}
+			far = min(far, t2)
+		}
+		if !inside || near > far || far < 0 {
+			continue
+		}
+		h := Hit{Block: p, Adjacent: p}
+		if near > 0 && axis >= 0 {
+			h.Distance = float32(near)
+			if d[axis] > 0 {
+				h.Normal[axis] = -1
+			} else {
+				h.Normal[axis] = 1
+			}
+			h.Adjacent = world.BlockPos{X: p.X + h.Normal[0], Y: p.Y + h.Normal[1], Z: p.Z + h.Normal[2]}
+		}
+		if !found || h.Distance < best.Distance {
+			best, found = h, true
+		}
+	}
+	return best, found
+}
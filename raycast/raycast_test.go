@@ -0,0 +1,150 @@
+package raycast
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+func testRegistry(t *testing.T) *block.Registry {
+	t.Helper()
+	r, err := block.Parse([]byte(`{"blocks": [
+		{"id": 1, "name": "stone", "textures": {"all": "stone"}, "solid": true},
+		{"id": 2, "name": "slab", "textures": {"all": "stone"}, "solid": true, "model": "slab"},
+		{"id": 3, "name": "water", "textures": {"all": "water"}, "transparent": true, "model": "water"}
+	], "models": {
+		"slab": {"elements": [{"from": [0, 0, 0], "to": [16, 8, 16]}]},
+		"water": {"type": "liquid", "height": 14}
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+const (
+	stone = 1
+	slab  = 2
+	water = 3
+)
+
+func TestCast(t *testing.T) {
+	reg := testRegistry(t)
+	type at = world.BlockPos
+	diagonal := float32(math.Sqrt(0.5))
+	cases := []struct {
+		name        string
+		blocks      map[at]int
+		origin, dir mgl32.Vec3
+		reach       float32
+		skipLiquids bool
+
+		hit      bool
+		block    at
+		normal   [3]int
+		distance float32
+	}{
+		{"along +x", map[at]int{{X: 3}: stone}, mgl32.Vec3{}, mgl32.Vec3{1, 0, 0}, 8, false,
+			true, at{X: 3}, [3]int{-1, 0, 0}, 2.5},
+		{"down", map[at]int{{Y: -2}: stone}, mgl32.Vec3{0, 0.3, 0}, mgl32.Vec3{0, -1, 0}, 8, false,
+			true, at{Y: -2}, [3]int{0, 1, 0}, 1.8},
+		{"along -z", map[at]int{{Z: -2}: stone}, mgl32.Vec3{}, mgl32.Vec3{0, 0, -5}, 8, false,
+			true, at{Z: -2}, [3]int{0, 0, 1}, 1.5},
+		{"out of reach", map[at]int{{X: 10}: stone}, mgl32.Vec3{}, mgl32.Vec3{1, 0, 0}, 5, false,
+			false, at{}, [3]int{}, 0},
+		{"just in reach", map[at]int{{X: 3}: stone}, mgl32.Vec3{}, mgl32.Vec3{1, 0, 0}, 2.5, false,
+			true, at{X: 3}, [3]int{-1, 0, 0}, 2.5},
+		{"no direction", map[at]int{{}: stone}, mgl32.Vec3{}, mgl32.Vec3{}, 8, false,
+			false, at{}, [3]int{}, 0},
+		{"inside a block", map[at]int{{}: stone}, mgl32.Vec3{0.2, 0, 0}, mgl32.Vec3{1, 0, 0}, 8, false,
+			true, at{}, [3]int{}, 0},
+
+		// Through the edge between four cells, X goes first
+		{"edge, block along x", map[at]int{{X: 1}: stone}, mgl32.Vec3{}, mgl32.Vec3{1, 1, 0}, 8, false,
+			true, at{X: 1}, [3]int{-1, 0, 0}, diagonal},
+		{"edge, block along y", map[at]int{{Y: 1}: stone}, mgl32.Vec3{}, mgl32.Vec3{1, 1, 0}, 8, false,
+			false, at{}, [3]int{}, 0},
+		{"edge, blocks along x and y", map[at]int{{X: 1}: stone, {Y: 1}: stone}, mgl32.Vec3{}, mgl32.Vec3{1, 1, 0}, 8, false,
+			true, at{X: 1}, [3]int{-1, 0, 0}, diagonal},
+		{"edge, block across", map[at]int{{X: 1, Y: 1}: stone}, mgl32.Vec3{}, mgl32.Vec3{1, 1, 0}, 8, false,
+			true, at{X: 1, Y: 1}, [3]int{-1, 0, 0}, diagonal},
+		{"corner, block across", map[at]int{{X: -1, Y: -1, Z: -1}: stone}, mgl32.Vec3{}, mgl32.Vec3{-1, -1, -1}, 8, false,
+			true, at{X: -1, Y: -1, Z: -1}, [3]int{1, 0, 0}, float32(math.Sqrt(0.75))},
+		{"clips a corner", map[at]int{{X: 1}: stone}, mgl32.Vec3{0.4, 0.4, 0}, mgl32.Vec3{1, 0.98, 0}, 8, false,
+			true, at{X: 1}, [3]int{-1, 0, 0}, 0.1 * float32(math.Sqrt(1+0.98*0.98))},
+		{"misses a corner", map[at]int{{X: 1}: stone}, mgl32.Vec3{0.4, 0.4, 0}, mgl32.Vec3{1, 1.02, 0}, 8, false,
+			false, at{}, [3]int{}, 0},
+		{"on a cell boundary", map[at]int{{X: 2}: stone, {X: 3, Y: 1}: stone}, mgl32.Vec3{0, 0.5, 0}, mgl32.Vec3{1, 0, 0}, 8, false,
+			true, at{X: 3, Y: 1}, [3]int{-1, 0, 0}, 2.5},
+
+		// Selection boxes
+		{"over a slab", map[at]int{{X: 2}: slab, {X: 4}: stone}, mgl32.Vec3{0, 0.25, 0}, mgl32.Vec3{1, 0, 0}, 8, false,
+			true, at{X: 4}, [3]int{-1, 0, 0}, 3.5},
+		{"onto a slab", map[at]int{{X: 2}: slab}, mgl32.Vec3{2, 2, 0}, mgl32.Vec3{0, -1, 0}, 8, false,
+			true, at{X: 2}, [3]int{0, 1, 0}, 2},
+		{"water", map[at]int{{X: 1}: water, {X: 3}: stone}, mgl32.Vec3{}, mgl32.Vec3{1, 0, 0}, 8, false,
+			true, at{X: 1}, [3]int{-1, 0, 0}, 0.5},
+		{"through water", map[at]int{{X: 1}: water, {X: 3}: stone}, mgl32.Vec3{}, mgl32.Vec3{1, 0, 0}, 8, true,
+			true, at{X: 3}, [3]int{-1, 0, 0}, 2.5},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := world.New()
+			for p, state := range c.blocks {
+				w.SetBlock(p, state)
+			}
+			var skip func(world.BlockPos, int) bool
+			if c.skipLiquids {
+				skip = func(_ world.BlockPos, state int) bool { return reg.IsLiquid(state) }
+			}
+			h, ok := Cast(w, reg, c.origin, c.dir, c.reach, skip)
+			if ok != c.hit {
+				t.Fatalf("hit = %v (%+v), want %v", ok, h, c.hit)
+			}
+			if !ok {
+				return
+			}
+			adjacent := at{X: c.block.X + c.normal[0], Y: c.block.Y + c.normal[1], Z: c.block.Z + c.normal[2]}
+			if h.Block != c.block || h.Normal != c.normal || h.Adjacent != adjacent || h.State != c.blocks[c.block] {
+				t.Errorf("hit %+v, want block %v, normal %v", h, c.block, c.normal)
+			}
+			if math.Abs(float64(h.Distance-c.distance)) > 1e-5 {
+				t.Errorf("distance = %v, want %v", h.Distance, c.distance)
+			}
+			want := c.origin.Add(c.dir.Normalize().Mul(c.distance))
+			if !h.Point.ApproxEqualThreshold(want, 1e-5) {
+				t.Errorf("point = %v, want %v", h.Point, want)
+			}
+		})
+	}
+}
+
+func TestCastVisitsEveryCell(t *testing.T) {
+	reg := testRegistry(t)
+	w := world.New()
+	// Consecutive cells share a face, whatever the direction
+	for _, dir := range []mgl32.Vec3{{1, 0.3, -0.7}, {-0.2, 1, 0.9}, {0.01, -0.02, -1}, {1, 1, 1}} {
+		var last *world.BlockPos
+		Cast(w, reg, mgl32.Vec3{0.3, -0.2, 0.1}, dir, 20, func(p world.BlockPos, _ int) bool {
+			if last != nil {
+				d := abs(p.X-last.X) + abs(p.Y-last.Y) + abs(p.Z-last.Z)
+				if d != 1 {
+					t.Errorf("direction %v: step from %v to %v", dir, *last, p)
+				}
+			}
+			last = &p
+			return true
+		})
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,331 @@
+// Package region reads and writes region files: 32x32 chunk columns stored
+// in one file, in the spirit of Minecraft's Anvil format.
+//
+// A region file starts with two 4KiB header tables of 1024 big-endian
+// entries, one per column at index x+z*32:
+//
+//	locations   sector offset (3 bytes) and sector count (1 byte), 0 if absent
+//	timestamps  seconds since the Unix epoch of the last write
+//
+// Column data is stored in 4KiB sectors after the header. Each entry starts
+// with its length in bytes (4 bytes, counting the compression byte), the
+// compression type (1 byte) and then the compressed data, padded to a whole
+// number of sectors.
+//
+// When a column is rewritten it stays in place if it still fits, and
+// otherwise moves to the first run of free sectors large enough, so space
+// freed by moved or shrunk columns is reused. Damaged files are reported
+// with errors wrapping ErrCorrupt rather than panics.
+package region
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Layout constants.
+const (
+	Size       = 32   // Columns along each side of a region
+	SectorSize = 4096 // Bytes per sector
+	headerSize = 2 * SectorSize
+	maxSectors = 255 // Largest entry, limited by the 1-byte sector count
+)
+
+// Compression is the compression type of a stored column.
+type Compression byte
+
+// Compression types, numbered as in Anvil.
+const (
+	Gzip Compression = 1
+	Zlib Compression = 2
+	None Compression = 3
+)
+
+// ErrCorrupt is wrapped by the errors about damaged region files.
+var ErrCorrupt = errors.New("region: corrupt file")
+
+// ErrTooLarge is returned when a column does not fit in maxSectors sectors.
+var ErrTooLarge = errors.New("region: column too large")
+
+// Storage is where a region file lives, usually an *os.File or a *Buffer.
+type Storage interface {
+	io.ReaderAt
+	io.WriterAt
+	Truncate(size int64) error
+}
+
+// File is an open region file.
+type File struct {
+	// Compression used by Write, Zlib by default
+	Compression Compression
+	// Now gives the timestamp of writes, time.Now by default
+	Now func() time.Time
+
+	s         Storage
+	locations [Size * Size]uint32
+	stamps    [Size * Size]uint32
+	used      []bool // Per sector, including the header
+}
+
+// New opens the region stored in s, whose current length is size. An empty
+// storage is a new, empty region.
+func New(s Storage, size int64) (*File, error) {
+	f := &File{Compression: Zlib, Now: time.Now, s: s}
+	if size == 0 {
+		if err := s.Truncate(headerSize); err != nil {
+			return nil, err
+		}
+		f.used = []bool{true, true}
+		return f, nil
+	}
+	if size < headerSize {
+		return nil, fmt.Errorf("%w: %d bytes is shorter than the header", ErrCorrupt, size)
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := s.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	for i := range f.locations {
+		f.locations[i] = binary.BigEndian.Uint32(header[4*i:])
+		f.stamps[i] = binary.BigEndian.Uint32(header[SectorSize+4*i:])
+	}
+
+	// Entries must lie after the header, inside the file, without overlaps
+	sectors := int((size + SectorSize - 1) / SectorSize)
+	f.used = make([]bool, sectors)
+	f.used[0], f.used[1] = true, true
+	for i, loc := range f.locations {
+		if loc == 0 {
+			continue
+		}
+		offset, count := int(loc>>8), int(loc&0xff)
+		if offset < 2 || count == 0 || offset+count > sectors {
+			return nil, fmt.Errorf("%w: column %d at sectors %d+%d, file has %d", ErrCorrupt, i, offset, count, sectors)
+		}
+		for j := offset; j < offset+count; j++ {
+			if f.used[j] {
+				return nil, fmt.Errorf("%w: column %d overlaps sector %d", ErrCorrupt, i, j)
+			}
+			f.used[j] = true
+		}
+	}
+	return f, nil
+}
+
+// index returns the header index of column x, z, both in 0..Size-1.
+func index(x, z int) (int, error) {
+	if x < 0 || x >= Size || z < 0 || z >= Size {
+		return 0, fmt.Errorf("region: column %d,%d outside the region", x, z)
+	}
+	return x + z*Size, nil
+}
+
+// Has reports whether column x, z is stored.
+func (f *File) Has(x, z int) bool {
+	i, err := index(x, z)
+	return err == nil && f.locations[i] != 0
+}
+
+// Timestamp returns when column x, z was last written, or the zero time if
+// it is absent.
+func (f *File) Timestamp(x, z int) time.Time {
+	i, err := index(x, z)
+	if err != nil || f.locations[i] == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(f.stamps[i]), 0)
+}
+
+// Read returns the uncompressed data of column x, z, or nil if it is absent.
+func (f *File) Read(x, z int) ([]byte, error) {
+	i, err := index(x, z)
+	if err != nil {
+		return nil, err
+	}
+	loc := f.locations[i]
+	if loc == 0 {
+		return nil, nil
+	}
+	offset, count := int64(loc>>8), int64(loc&0xff)
+
+	buf := make([]byte, count*SectorSize)
+	if n, err := f.s.ReadAt(buf, offset*SectorSize); n < len(buf) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("%w: column %d,%d: %v", ErrCorrupt, x, z, err)
+	}
+	length := int64(binary.BigEndian.Uint32(buf))
+	if length < 1 || length > int64(len(buf))-4 {
+		return nil, fmt.Errorf("%w: column %d,%d has length %d in %d sectors", ErrCorrupt, x, z, length, count)
+	}
+	data, err := decompress(Compression(buf[4]), buf[5:4+length])
+	if err != nil {
+		return nil, fmt.Errorf("%w: column %d,%d: %v", ErrCorrupt, x, z, err)
+	}
+	return data, nil
+}
+
+// Write stores data as column x, z, replacing any previous data.
+func (f *File) Write(x, z int, data []byte) error {
+	i, err := index(x, z)
+	if err != nil {
+		return err
+	}
+	packed, err := compress(f.Compression, data)
+	if err != nil {
+		return err
+	}
+
+	entry := make([]byte, 5, 5+len(packed))
+	binary.BigEndian.PutUint32(entry, uint32(len(packed)+1))
+	entry[4] = byte(f.Compression)
+	entry = append(entry, packed...)
+	count := (len(entry) + SectorSize - 1) / SectorSize
+	if count > maxSectors {
+		return fmt.Errorf("%w: %d sectors", ErrTooLarge, count)
+	}
+	entry = append(entry, make([]byte, count*SectorSize-len(entry))...)
+
+	// Free the old sectors first so the column can stay where it is
+	f.free(f.locations[i])
+	offset := f.allocate(count)
+	if _, err := f.s.WriteAt(entry, int64(offset)*SectorSize); err != nil {
+		return err
+	}
+	f.locations[i] = uint32(offset)<<8 | uint32(count)
+	f.stamps[i] = uint32(f.Now().Unix())
+	return f.writeHeader(i)
+}
+
+// Delete removes column x, z and frees its sectors.
+func (f *File) Delete(x, z int) error {
+	i, err := index(x, z)
+	if err != nil {
+		return err
+	}
+	f.free(f.locations[i])
+	f.locations[i], f.stamps[i] = 0, 0
+	return f.writeHeader(i)
+}
+
+// Sectors returns the number of sectors in the file, header included.
+func (f *File) Sectors() int {
+	return len(f.used)
+}
+
+// Compact truncates free sectors at the end of the file.
+func (f *File) Compact() error {
+	n := len(f.used)
+	for n > 2 && !f.used[n-1] {
+		n--
+	}
+	if n == len(f.used) {
+		return nil
+	}
+	if err := f.s.Truncate(int64(n) * SectorSize); err != nil {
+		return err
+	}
+	f.used = f.used[:n]
+	return nil
+}
+
+func (f *File) free(loc uint32) {
+	offset, count := int(loc>>8), int(loc&0xff)
+	for j := offset; j < offset+count && j < len(f.used); j++ {
+		f.used[j] = false
+	}
+}
+
+// allocate marks count sectors as used and returns the first one: the first
+// free run that is large enough, or the end of the file.
+func (f *File) allocate(count int) int {
+	run := 0
+	for j := 2; j < len(f.used); j++ {
+		if f.used[j] {
+			run = 0
+			continue
+		}
+		run++
+		if run == count {
+			start := j - count + 1
+			for k := start; k <= j; k++ {
+				f.used[k] = true
+			}
+			return start
+		}
+	}
+	// Extend the file, reusing a free run at its end
+	start := len(f.used) - run
+	for len(f.used) < start+count {
+		f.used = append(f.used, false)
+	}
+	for k := start; k < start+count; k++ {
+		f.used[k] = true
+	}
+	return start
+}
+
+// writeHeader writes the location and timestamp of column i.
+func (f *File) writeHeader(i int) error {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], f.locations[i])
+	if _, err := f.s.WriteAt(b[:], int64(4*i)); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(b[:], f.stamps[i])
+	_, err := f.s.WriteAt(b[:], int64(SectorSize+4*i))
+	return err
+}
+
+func compress(c Compression, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch c {
+	case Gzip:
+		w = gzip.NewWriter(&buf)
+	case Zlib:
+		w = zlib.NewWriter(&buf)
+	case None:
+		return append([]byte(nil), data...), nil
+	default:
+		return nil, fmt.Errorf("region: unknown compression %d", c)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(c Compression, data []byte) ([]byte, error) {
+	var r io.Reader
+	switch c {
+	case Gzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case Zlib:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case None:
+		return append([]byte(nil), data...), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %d", c)
+	}
+	return io.ReadAll(r)
+}
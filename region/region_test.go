@@ -0,0 +1,284 @@
+package region
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newFile(t testing.TB) (*File, *Buffer) {
+	t.Helper()
+	b := NewBuffer(nil)
+	f, err := New(b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, b
+}
+
+// reopen parses the contents of b again, as if the file was read from disk.
+func reopen(t testing.TB, b *Buffer) *File {
+	t.Helper()
+	f, err := New(NewBuffer(bytes.Clone(b.Bytes())), b.Len())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// noise returns n bytes that do not compress.
+func noise(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestReadWrite(t *testing.T) {
+	for _, c := range []Compression{Gzip, Zlib, None} {
+		f, b := newFile(t)
+		f.Compression = c
+		f.Now = func() time.Time { return time.Unix(1700000000, 0) }
+		if err := f.Write(3, 31, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Write(0, 0, noise(1, 10000)); err != nil {
+			t.Fatal(err)
+		}
+
+		g := reopen(t, b)
+		if got, err := g.Read(3, 31); err != nil || string(got) != "hello" {
+			t.Errorf("compression %d: Read = %q, %v", c, got, err)
+		}
+		if got, err := g.Read(0, 0); err != nil || !bytes.Equal(got, noise(1, 10000)) {
+			t.Errorf("compression %d: large column not restored: %v", c, err)
+		}
+		if got, err := g.Read(1, 1); got != nil || err != nil {
+			t.Errorf("Read of an absent column = %v, %v", got, err)
+		}
+		if !g.Has(3, 31) || g.Has(1, 1) {
+			t.Errorf("Has is wrong")
+		}
+		if ts := g.Timestamp(3, 31); ts.Unix() != 1700000000 {
+			t.Errorf("Timestamp = %v", ts)
+		}
+		if !g.Timestamp(1, 1).IsZero() {
+			t.Errorf("Timestamp of an absent column is not zero")
+		}
+		if b.Len()%SectorSize != 0 {
+			t.Errorf("file length %d is not sector aligned", b.Len())
+		}
+	}
+}
+
+func TestOutsideRegion(t *testing.T) {
+	f, _ := newFile(t)
+	for _, xz := range [][2]int{{-1, 0}, {0, Size}, {Size, 0}} {
+		if err := f.Write(xz[0], xz[1], nil); err == nil {
+			t.Errorf("Write(%v) succeeded", xz)
+		}
+		if _, err := f.Read(xz[0], xz[1]); err == nil {
+			t.Errorf("Read(%v) succeeded", xz)
+		}
+	}
+}
+
+func TestSpaceReuse(t *testing.T) {
+	f, b := newFile(t)
+	f.Compression = None
+	f.Write(0, 0, noise(1, 5000)) // Sectors 2-3
+	f.Write(1, 0, noise(2, 100))  // Sector 4
+	if f.Sectors() != 5 {
+		t.Fatalf("Sectors = %d, want 5", f.Sectors())
+	}
+
+	// Shrinking stays in place and frees sector 3
+	f.Write(0, 0, noise(3, 100))
+	if f.locations[0]>>8 != 2 || f.Sectors() != 5 {
+		t.Errorf("shrunk column at sector %d, %d sectors", f.locations[0]>>8, f.Sectors())
+	}
+	// The freed sector is reused
+	f.Write(2, 0, noise(4, 100))
+	if f.locations[2]>>8 != 3 {
+		t.Errorf("new column at sector %d, want 3", f.locations[2]>>8)
+	}
+	// Growing moves the column to the end, and its old sector is reused
+	f.Write(0, 0, noise(5, 9000))
+	if f.locations[0]>>8 != 5 || f.Sectors() != 8 {
+		t.Errorf("grown column at sector %d, %d sectors", f.locations[0]>>8, f.Sectors())
+	}
+	f.Write(3, 0, noise(6, 100))
+	if f.locations[3]>>8 != 2 {
+		t.Errorf("new column at sector %d, want 2", f.locations[3]>>8)
+	}
+
+	// Deleting the last column lets Compact shrink the file
+	f.Delete(0, 0)
+	if err := f.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if f.Sectors() != 5 || b.Len() != 5*SectorSize {
+		t.Errorf("after Compact: %d sectors, %d bytes", f.Sectors(), b.Len())
+	}
+
+	g := reopen(t, b)
+	for x, seed := range map[int]int64{1: 2, 2: 4, 3: 6} {
+		if got, err := g.Read(x, 0); err != nil || !bytes.Equal(got, noise(seed, 100)) {
+			t.Errorf("column %d not restored: %v", x, err)
+		}
+	}
+	if g.Has(0, 0) {
+		t.Errorf("deleted column is still there")
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	f, _ := newFile(t)
+	f.Compression = None
+	if err := f.Write(0, 0, noise(1, maxSectors*SectorSize)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Write error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	f, b := newFile(t)
+	f.Write(0, 0, []byte("first"))
+	f.Write(1, 0, []byte("second"))
+	good := b.Bytes()
+
+	corrupt := func(edit func(data []byte) []byte) []byte {
+		return edit(bytes.Clone(good))
+	}
+	setLocation := func(i int, loc uint32) func([]byte) []byte {
+		return func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[4*i:], loc)
+			return data
+		}
+	}
+	for name, data := range map[string][]byte{
+		"short header":    good[:100],
+		"in header":       corrupt(setLocation(0, 1<<8|1)),
+		"past the end":    corrupt(setLocation(0, 9<<8|1)),
+		"zero sectors":    corrupt(setLocation(0, 2<<8)),
+		"overlapping":     corrupt(setLocation(1, 2<<8|1)),
+		"truncated entry": good[:len(good)-SectorSize],
+	} {
+		if _, err := New(NewBuffer(data), int64(len(data))); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: New error = %v, want ErrCorrupt", name, err)
+		}
+	}
+
+	for name, data := range map[string][]byte{
+		"zero length": corrupt(func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[2*SectorSize:], 0)
+			return data
+		}),
+		"long length": corrupt(func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[2*SectorSize:], SectorSize)
+			return data
+		}),
+		"bad compression": corrupt(func(data []byte) []byte {
+			data[2*SectorSize+4] = 9
+			return data
+		}),
+		"bad data": corrupt(func(data []byte) []byte {
+			data[2*SectorSize+5] ^= 0xff
+			return data
+		}),
+	} {
+		g, err := New(NewBuffer(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := g.Read(0, 0); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: Read error = %v, want ErrCorrupt", name, err)
+		}
+		if got, err := g.Read(1, 0); err != nil || string(got) != "second" {
+			t.Errorf("%s: other column = %q, %v", name, got, err)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "r.0.0.c3r")
+	f, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(5, 6, []byte("on disk"))
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, err := f.Read(5, 6); err != nil || string(got) != "on disk" {
+		t.Errorf("Read = %q, %v", got, err)
+	}
+}
+
+// FuzzNew checks that damaged files give errors rather than panics, and
+// that whatever opens can still be read and written.
+func FuzzNew(f *testing.F) {
+	file, b := newFile(f)
+	file.Write(0, 0, []byte("column"))
+	file.Write(31, 31, noise(1, 5000))
+	f.Add(bytes.Clone(b.Bytes()))
+	f.Add(b.Bytes()[:headerSize+10])
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		file, err := New(NewBuffer(data), int64(len(data)))
+		if err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("error %v does not wrap ErrCorrupt", err)
+			}
+			return
+		}
+		for x := 0; x < Size; x++ {
+			for z := 0; z < Size; z++ {
+				if _, err := file.Read(x, z); err != nil && !errors.Is(err, ErrCorrupt) {
+					t.Fatalf("Read error %v does not wrap ErrCorrupt", err)
+				}
+			}
+		}
+		if err := file.Write(7, 7, []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := file.Read(7, 7); err != nil || string(got) != "new" {
+			t.Fatalf("Read after Write = %q, %v", got, err)
+		}
+	})
+}
+
+// FuzzWrite writes columns of the sizes given by data and checks that they
+// all read back, before and after reopening.
+func FuzzWrite(f *testing.F) {
+	f.Add([]byte{0, 10, 1, 200, 0, 3, 2, 90, 1, 1})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		file, b := newFile(t)
+		file.Compression = None
+		want := make(map[int][]byte)
+		for i := 0; i+1 < len(ops); i += 2 {
+			x := int(ops[i]) % 4
+			data := noise(int64(i), int(ops[i+1])*100)
+			if err := file.Write(x, 0, data); err != nil {
+				t.Fatal(err)
+			}
+			want[x] = data
+		}
+		for _, g := range []*File{file, reopen(t, b)} {
+			for x, data := range want {
+				if got, err := g.Read(x, 0); err != nil || !bytes.Equal(got, data) {
+					t.Fatalf("column %d: %v", x, err)
+				}
+			}
+		}
+	})
+}
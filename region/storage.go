@@ -0,0 +1,105 @@
+package region
+
+import (
+	"io"
+	"os"
+)
+
+// Open opens the region file at path, creating it if it does not exist. The
+// file is closed by Close.
+func Open(path string) (*File, error) {
+	osf, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := osf.Stat()
+	if err != nil {
+		osf.Close()
+		return nil, err
+	}
+	f, err := New(osf, info.Size())
+	if err != nil {
+		osf.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close closes the underlying storage if it is an io.Closer.
+func (f *File) Close() error {
+	if c, ok := f.s.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Buffer is an in-memory Storage.
+type Buffer struct {
+	data []byte
+}
+
+// NewBuffer returns a buffer holding data, which it takes ownership of.
+func NewBuffer(data []byte) *Buffer {
+	return &Buffer{data: data}
+}
+
+// Bytes returns the contents of the buffer.
+func (b *Buffer) Bytes() []byte {
+	return b.data
+}
+
+// Len returns the length of the buffer.
+func (b *Buffer) Len() int64 {
+	return int64(len(b.data))
+}
+
+// ReadAt implements io.ReaderAt.
+func (b *Buffer) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	if off >= int64(len(b.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt implements io.WriterAt, growing the buffer as needed.
+func (b *Buffer) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	if end := off + int64(len(p)); end > int64(len(b.data)) {
+		b.grow(end)
+	}
+	return copy(b.data[off:], p), nil
+}
+
+// Truncate changes the length of the buffer, zero filling when it grows.
+func (b *Buffer) Truncate(size int64) error {
+	if size < 0 {
+		return os.ErrInvalid
+	}
+	if size <= int64(len(b.data)) {
+		b.data = b.data[:size]
+		return nil
+	}
+	b.grow(size)
+	return nil
+}
+
+func (b *Buffer) grow(size int64) {
+	if size <= int64(cap(b.data)) {
+		old := len(b.data)
+		b.data = b.data[:size]
+		clear(b.data[old:])
+		return
+	}
+	data := make([]byte, size, max(size, 2*int64(cap(b.data))))
+	copy(data, b.data)
+	b.data = data
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+
+	"craft3d/atlas"
+	"craft3d/mesh"
+	"craft3d/world"
+)
+
+// Vertex attribute locations of the block shader, set up in main().
+var (
+	vertAttrib     uint32
+	texCoordAttrib uint32
+	tileAttrib     uint32
+	colorAttrib    uint32
+)
+
+// chunkMesh is the GPU copy of a chunk mesh: one VBO and one EBO per chunk.
+type chunkMesh struct {
+	vao, vbo, ebo uint32
+	ranges        []tintRange
+	tints         map[string]mgl32.Vec4 // Biome colour per tint kind
+
+	// Faces of translucent blocks, drawn after every opaque face through
+	// their own VAO and EBO, which sortTranslucent refills back to front
+	// when the camera has moved
+	translucent []mesh.TranslucentFace
+	tvao, tebo  uint32
+	tranges     []tintRange
+	sortedFrom  mgl32.Vec3
+	sorted      bool
+}
+
+// tintRange is a run of indices drawn with the same colorTint.
+type tintRange struct {
+	tint          string // Biome tint kind, "" for none
+	offset, count int32
+}
+
+// Alpha below which the fragment shader discards texels: holes in leaves
+// and plants in the opaque pass, only fully clear texels in the
+// translucent pass so that glass and water blend.
+const (
+	opaqueCutoff      = 0.5
+	translucentCutoff = 0.01
+)
+
+// resortDistance is how far the camera moves, in blocks, before the
+// translucent faces of a chunk are sorted again.
+const resortDistance = 1.0
+
+var (
+	// Meshes of every chunk with something to draw.
+	chunkMeshes = make(map[world.ChunkPos]*chunkMesh)
+
+	// Mesher used to build chunk meshes, see -mesher and the G key
+	chunkMesherName = "naive"
+	chunkMesher     = mesh.Build
+
+	// Chunks whose mesh must be rebuilt, and how many are rebuilt and
+	// uploaded per frame, see -mesh-budget
+	pendingMeshes = make(map[world.ChunkPos]bool)
+	meshBudget    = 8
+)
+
+// setChunkMesher switches to a mesher from mesh.Meshers and rebuilds every
+// chunk mesh.
+func setChunkMesher(name string) {
+	chunkMesherName = name
+	chunkMesher = mesh.Meshers[name]
+	for _, c := range gameWorld.Chunks() {
+		updateChunkMesh(c.Pos)
+	}
+}
+
+// toggleChunkMesher alternates between the naive and greedy meshers.
+func toggleChunkMesher() {
+	next := "greedy"
+	if chunkMesherName == "greedy" {
+		next = "naive"
+	}
+	setChunkMesher(next)
+	fmt.Printf("Mesher: %s\n", next)
+}
+
+// updateChunkMeshes rebuilds the meshes of chunks that changed, nearest to
+// centre first and at most meshBudget per frame, so streaming in many chunks
+// at once does not stall rendering. The rest wait for the next frames.
+func updateChunkMeshes(centre world.ChunkPos) {
+	for _, cp := range gameWorld.TakeDirty() {
+		pendingMeshes[cp] = true
+	}
+	if len(pendingMeshes) == 0 {
+		return
+	}
+
+	list := make([]world.ChunkPos, 0, len(pendingMeshes))
+	for cp := range pendingMeshes {
+		list = append(list, cp)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return chunkDistance2(list[i], centre) < chunkDistance2(list[j], centre)
+	})
+	built := 0
+	for _, cp := range list {
+		// Dropping the mesh of an unloaded chunk is cheap, do not count it
+		loaded := gameWorld.ChunkAt(cp) != nil
+		if loaded && built >= meshBudget {
+			continue
+		}
+		updateChunkMesh(cp)
+		delete(pendingMeshes, cp)
+		if loaded {
+			built++
+		}
+	}
+}
+
+func chunkDistance2(a, b world.ChunkPos) int {
+	dx, dy, dz := a.X-b.X, a.Y-b.Y, a.Z-b.Z
+	return dx*dx + dy*dy + dz*dz
+}
+
+// updateChunkMesh rebuilds the mesh of a chunk and replaces its GPU buffers.
+func updateChunkMesh(cp world.ChunkPos) {
+	m := chunkMesher(gameWorld, blockRegistry, blockAtlas, cp)
+
+	if cm := chunkMeshes[cp]; cm != nil {
+		cm.delete()
+		delete(chunkMeshes, cp)
+	}
+	if m.Empty() {
+		return
+	}
+	chunkMeshes[cp] = newChunkMesh(m, chunkTints(cp))
+}
+
+// chunkTints returns the biome colours at the centre of a chunk. Biomes
+// blend smoothly, so neighbouring chunks get close colours.
+func chunkTints(cp world.ChunkPos) map[string]mgl32.Vec4 {
+	if biomes == nil {
+		return nil
+	}
+	o := cp.Origin()
+	grass, water := biomes.TintAt(worldSeed, o.X+world.ChunkSize/2, o.Z+world.ChunkSize/2)
+	return map[string]mgl32.Vec4{
+		"grass": grass,
+		"water": water,
+	}
+}
+
+func newChunkMesh(m *mesh.Mesh, tints map[string]mgl32.Vec4) *chunkMesh {
+	cm := &chunkMesh{tints: tints, translucent: m.Translucent}
+	for _, b := range m.Batches {
+		if n := len(cm.ranges); n > 0 && cm.ranges[n-1].tint == b.Tint {
+			cm.ranges[n-1].count += int32(b.Count)
+			continue
+		}
+		cm.ranges = append(cm.ranges, tintRange{b.Tint, int32(b.Offset), int32(b.Count)})
+	}
+
+	gl.GenVertexArrays(1, &cm.vao)
+	gl.BindVertexArray(cm.vao)
+	gl.GenBuffers(1, &cm.vbo)
+	gl.BindBuffer(gl.ARRAY_BUFFER, cm.vbo)
+	gl.BufferData(gl.ARRAY_BUFFER, len(m.Vertices)*4, gl.Ptr(m.Vertices), gl.STATIC_DRAW)
+	gl.GenBuffers(1, &cm.ebo)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, cm.ebo)
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(m.Indices)*4, gl.Ptr(m.Indices), gl.STATIC_DRAW)
+	setVertexAttribs()
+
+	if len(cm.translucent) > 0 {
+		// Same vertices, indices filled by sortTranslucent
+		gl.GenVertexArrays(1, &cm.tvao)
+		gl.BindVertexArray(cm.tvao)
+		gl.BindBuffer(gl.ARRAY_BUFFER, cm.vbo)
+		gl.GenBuffers(1, &cm.tebo)
+		gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, cm.tebo)
+		gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(cm.translucent)*6*4, nil, gl.DYNAMIC_DRAW)
+		setVertexAttribs()
+	}
+
+	gl.BindVertexArray(0)
+	return cm
+}
+
+// setVertexAttribs describes the layout of mesh.VertexSize vertices in the
+// bound buffer to the bound VAO.
+func setVertexAttribs() {
+	stride := int32(mesh.VertexSize * 4)
+	gl.EnableVertexAttribArray(vertAttrib)
+	gl.VertexAttribPointer(vertAttrib, 3, gl.FLOAT, false, stride, gl.PtrOffset(0))
+	gl.EnableVertexAttribArray(texCoordAttrib)
+	gl.VertexAttribPointer(texCoordAttrib, 2, gl.FLOAT, false, stride, gl.PtrOffset(3*4))
+	gl.EnableVertexAttribArray(tileAttrib)
+	gl.VertexAttribPointer(tileAttrib, 4, gl.FLOAT, false, stride, gl.PtrOffset(5*4))
+	gl.EnableVertexAttribArray(colorAttrib)
+	gl.VertexAttribPointer(colorAttrib, 4, gl.FLOAT, false, stride, gl.PtrOffset(9*4))
+}
+
+func (cm *chunkMesh) delete() {
+	gl.DeleteVertexArrays(1, &cm.vao)
+	gl.DeleteBuffers(1, &cm.vbo)
+	gl.DeleteBuffers(1, &cm.ebo)
+	if cm.tvao != 0 {
+		gl.DeleteVertexArrays(1, &cm.tvao)
+		gl.DeleteBuffers(1, &cm.tebo)
+	}
+}
+
+// sortTranslucent orders the translucent faces back to front as seen from
+// eye and uploads their indices, unless they were sorted from less than
+// resortDistance away. origin is the chunk's origin block.
+func (cm *chunkMesh) sortTranslucent(eye mgl32.Vec3, origin world.BlockPos) {
+	if len(cm.translucent) == 0 || cm.sorted && eye.Sub(cm.sortedFrom).Len() < resortDistance {
+		return
+	}
+	cm.sorted, cm.sortedFrom = true, eye
+
+	local := eye.Sub(mgl32.Vec3{float32(origin.X), float32(origin.Y), float32(origin.Z)})
+	mesh.SortTranslucent(cm.translucent, local)
+
+	indices := make([]uint32, 0, len(cm.translucent)*6)
+	cm.tranges = cm.tranges[:0]
+	for _, f := range cm.translucent {
+		if n := len(cm.tranges); n > 0 && cm.tranges[n-1].tint == f.Tint {
+			cm.tranges[n-1].count += 6
+		} else {
+			cm.tranges = append(cm.tranges, tintRange{f.Tint, int32(len(indices)), 6})
+		}
+		indices = append(indices, f.Indices[:]...)
+	}
+	gl.BindVertexArray(cm.tvao)
+	gl.BufferSubData(gl.ELEMENT_ARRAY_BUFFER, 0, len(indices)*4, gl.Ptr(indices))
+	gl.BindVertexArray(0)
+}
+
+// draw renders the opaque faces of the chunk with one call per tint kind
+// (at most three). The atlas must be bound.
+func (cm *chunkMesh) draw(tintUniform int32) {
+	gl.BindVertexArray(cm.vao)
+	cm.drawRanges(cm.ranges, tintUniform)
+}
+
+// drawTranslucent renders the translucent faces of the chunk in their
+// sorted order, one call per run of faces with the same tint kind.
+func (cm *chunkMesh) drawTranslucent(tintUniform int32) {
+	gl.BindVertexArray(cm.tvao)
+	cm.drawRanges(cm.tranges, tintUniform)
+}
+
+func (cm *chunkMesh) drawRanges(ranges []tintRange, tintUniform int32) {
+	for _, r := range ranges {
+		tint, ok := cm.tints[r.tint]
+		if !ok {
+			tint = mgl32.Vec4{1, 1, 1, 1}
+		}
+		gl.Uniform4fv(tintUniform, 1, &tint[0])
+		gl.DrawElements(gl.TRIANGLES, r.count, gl.UNSIGNED_INT, gl.PtrOffset(int(r.offset)*4))
+	}
+}
+
+// drawChunks draws every chunk mesh with the atlas bound: the opaque faces
+// first, then the translucent ones blended from the farthest chunk to the
+// nearest, each chunk's faces sorted back to front from eye. Translucent
+// faces are depth tested but do not write depth, so they do not hide each
+// other.
+func drawChunks(vp mgl32.Mat4, eye mgl32.Vec3, mvpUniform, tintUniform, cutoffUniform int32) {
+	setModel := func(cp world.ChunkPos) {
+		o := cp.Origin()
+		mvp := vp.Mul4(mgl32.Translate3D(float32(o.X), float32(o.Y), float32(o.Z)))
+		gl.UniformMatrix4fv(mvpUniform, 1, false, &mvp[0])
+	}
+
+	var translucent []world.ChunkPos
+	for cp, cm := range chunkMeshes {
+		setModel(cp)
+		cm.draw(tintUniform)
+		if len(cm.translucent) > 0 {
+			translucent = append(translucent, cp)
+		}
+	}
+
+	// Chunk centres, as seen from the eye
+	distance := func(cp world.ChunkPos) float32 {
+		o := cp.Origin()
+		half := float32(world.ChunkSize-1) / 2
+		return eye.Sub(mgl32.Vec3{float32(o.X) + half, float32(o.Y) + half, float32(o.Z) + half}).Len()
+	}
+	sort.Slice(translucent, func(i, j int) bool {
+		return distance(translucent[i]) > distance(translucent[j])
+	})
+
+	gl.DepthMask(false)
+	gl.Uniform1f(cutoffUniform, translucentCutoff)
+	for _, cp := range translucent {
+		cm := chunkMeshes[cp]
+		cm.sortTranslucent(eye, cp.Origin())
+		setModel(cp)
+		cm.drawTranslucent(tintUniform)
+	}
+	gl.Uniform1f(cutoffUniform, opaqueCutoff)
+	gl.DepthMask(true)
+}
+
+// newAtlasTexture uploads the atlas image. Filtering is NEAREST so tiles do
+// not bleed into their neighbours.
+func newAtlasTexture(a *atlas.Atlas) uint32 {
+	size := a.Image.Rect.Size()
+
+	var texture uint32
+	gl.GenTextures(1, &texture)
+	gl.BindTexture(gl.TEXTURE_2D, texture)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, int32(size.X), int32(size.Y), 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(a.Image.Pix))
+	return texture
+}
+
+// setQuadTile selects the texture area used by the UI quad.
+func setQuadTile(r atlas.Rect) {
+	gl.VertexAttrib4f(tileAttrib, r.U0, r.V0, r.DU, r.DV)
+}
+
+// setAtlasQuadTile makes the UI quad show one texture of the atlas.
+func setAtlasQuadTile(name string) {
+	r, _ := blockAtlas.Rect(name)
+	setQuadTile(r)
+}
@@ -0,0 +1,195 @@
+package save
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"craft3d/region"
+	"craft3d/world"
+)
+
+// RegionSize is the number of chunk columns along each side of a region.
+const RegionSize = region.Size
+
+// regionPos identifies a region by the X and Z of its columns divided by
+// RegionSize.
+type regionPos struct {
+	X, Z int
+}
+
+func regionOf(cp world.ChunkPos) regionPos {
+	return regionPos{floorDiv(cp.X, RegionSize), floorDiv(cp.Z, RegionSize)}
+}
+
+// regionFile is a region file held in memory between flushes.
+type regionFile struct {
+	buf   *region.Buffer
+	file  *region.File
+	dirty bool // Changed since it was read or written
+}
+
+// Each column of a region file holds the saved chunks of that column:
+//
+//	version  uint16
+//	states   uint16 count, then per state: value as uint16, name length as
+//	         uvarint and name
+//	chunks   uint16 count, then per chunk: Y as int32, length as uint32 and
+//	         the chunk
+//
+// All numbers are little-endian; the region file compresses the column.
+// Chunks are palette-compressed sections (see world.Section) of block
+// states, and the state table names the states they use, as in "log" or
+// "log[axis=x]", so a column loads right even if blocks were renumbered or
+// gained properties since it was saved; states that no longer exist load
+// as air.
+const columnVersion = 1
+
+// errCorrupt is wrapped by the errors about damaged region files, whether
+// the region file itself or a column in it is damaged.
+var errCorrupt = region.ErrCorrupt
+
+// column is a column read from a region file.
+type column struct {
+	chunks map[int][]byte // Encoded chunks, by Y
+	remap  map[int]int    // Saved state -> current state
+}
+
+// readColumn reads the column holding cp. A missing column has no chunks.
+func (r *regionFile) readColumn(cp world.ChunkPos, states States) (*column, error) {
+	x, z := columnIn(cp)
+	data, err := r.file.Read(x, z)
+	if err != nil {
+		return nil, err
+	}
+	col := &column{chunks: make(map[int][]byte)}
+	if data == nil {
+		return col, nil
+	}
+	corrupt := func(what string) error {
+		return fmt.Errorf("%w: column %d,%d: %s", errCorrupt, cp.X, cp.Z, what)
+	}
+	if len(data) < 2 {
+		return nil, corrupt("no version")
+	}
+	if version := binary.LittleEndian.Uint16(data); version != columnVersion {
+		return nil, fmt.Errorf("unsupported column version %d", version)
+	}
+	data = data[2:]
+
+	if len(data) < 2 {
+		return nil, corrupt("no state table")
+	}
+	count := int(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	col.remap = make(map[int]int, count)
+	for i := 0; i < count; i++ {
+		if len(data) < 2 {
+			return nil, corrupt("state table ends early")
+		}
+		value := int(binary.LittleEndian.Uint16(data))
+		n, m := binary.Uvarint(data[2:])
+		if m <= 0 || uint64(len(data)-2-m) < n {
+			return nil, corrupt("state table ends early")
+		}
+		name := string(data[2+m : 2+m+int(n)])
+		data = data[2+m+int(n):]
+		// Unknown states become air
+		col.remap[value], _ = states.ParseState(name)
+	}
+
+	if len(data) < 2 {
+		return nil, corrupt("no chunk count")
+	}
+	count = int(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	for i := 0; i < count; i++ {
+		var y, size int
+		if len(data) >= 8 {
+			y, size = int(int32(binary.LittleEndian.Uint32(data))), int(binary.LittleEndian.Uint32(data[4:]))
+		}
+		if len(data) < 8 || len(data)-8 < size {
+			return nil, corrupt(fmt.Sprintf("ends in chunk %d of %d", i, count))
+		}
+		col.chunks[y] = data[8 : 8+size]
+		data = data[8+size:]
+	}
+	if len(data) != 0 {
+		return nil, corrupt(fmt.Sprintf("%d trailing bytes", len(data)))
+	}
+	return col, nil
+}
+
+// chunk decodes the chunk at pos, or returns nil if the column does not
+// have it.
+func (col *column) chunk(pos world.ChunkPos) (*world.Chunk, error) {
+	data := col.chunks[pos.Y]
+	if data == nil {
+		return nil, nil
+	}
+	c := world.NewChunk(pos)
+	if err := c.Blocks().UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%w: chunk %v: %v", errCorrupt, pos, err)
+	}
+	c.Blocks().Remap(func(state int) int {
+		return col.remap[state]
+	})
+	return c, nil
+}
+
+// writeColumn replaces the column holding the chunks, which must all be in
+// one column.
+func (r *regionFile) writeColumn(chunks []*world.Chunk, states States) error {
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Pos.Y < chunks[j].Pos.Y })
+
+	used := map[int]bool{}
+	var body []byte
+	body = binary.LittleEndian.AppendUint16(body, uint16(len(chunks)))
+	for _, c := range chunks {
+		section, err := c.Blocks().MarshalBinary()
+		if err != nil {
+			return err
+		}
+		body = binary.LittleEndian.AppendUint32(body, uint32(int32(c.Pos.Y)))
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(section)))
+		body = append(body, section...)
+		for _, v := range c.Blocks().Values() {
+			used[v] = true
+		}
+	}
+	values := make([]int, 0, len(used))
+	for v := range used {
+		values = append(values, v)
+	}
+	sort.Ints(values)
+
+	data := binary.LittleEndian.AppendUint16(nil, columnVersion)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(values)))
+	for _, v := range values {
+		name := states.StateName(v)
+		data = binary.LittleEndian.AppendUint16(data, uint16(v))
+		data = binary.AppendUvarint(data, uint64(len(name)))
+		data = append(data, name...)
+	}
+	data = append(data, body...)
+
+	x, z := columnIn(chunks[0].Pos)
+	if err := r.file.Write(x, z, data); err != nil {
+		return err
+	}
+	r.dirty = true
+	return nil
+}
+
+// columnIn returns the position of the column of cp inside its region.
+func columnIn(cp world.ChunkPos) (x, z int) {
+	return cp.X - floorDiv(cp.X, RegionSize)*RegionSize, cp.Z - floorDiv(cp.Z, RegionSize)*RegionSize
+}
+
+func floorDiv(v, d int) int {
+	q := v / d
+	if v%d != 0 && v < 0 {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,241 @@
+// Package save stores worlds in a directory:
+//
+//	level.json          seed, generator, game time and spawn point
+//	player.json         position, view and selected hotbar slot
+//	region/r.X.Z.c3r    edited chunks of 32x32 columns, see package region
+//
+// Every file is written to a temporary file first and then renamed over the
+// old one, so a crash while saving leaves either the old or the new file,
+// never half of one. Region files are updated in memory and written whole
+// by Flush for the same reason.
+package save
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"craft3d/region"
+	"craft3d/world"
+)
+
+// Level is the metadata of a world.
+type Level struct {
+	Seed      int64      `json:"seed"`
+	Generator string     `json:"generator"`
+	Time      float64    `json:"time"` // Game time, in seconds
+	Spawn     [3]float32 `json:"spawn"`
+}
+
+// Player is the saved state of the player.
+type Player struct {
+	Position [3]float32 `json:"position"`
+	Velocity [3]float32 `json:"velocity"`
+	Flying   bool       `json:"flying"`
+	Yaw      float64    `json:"yaw"`
+	Pitch    float64    `json:"pitch"`
+	Slot     int        `json:"slot"` // Selected hotbar slot
+}
+
+const (
+	levelFile  = "level.json"
+	playerFile = "player.json"
+	regionDir  = "region"
+)
+
+// Dir is a world saved in a directory. It implements stream.Store; chunks
+// passed to Save are kept in memory until Flush writes them out.
+type Dir struct {
+	path   string
+	states States
+
+	mu      sync.Mutex
+	regions map[regionPos]*regionFile
+}
+
+// States names block states in region files, usually a *block.Registry.
+type States interface {
+	StateName(state int) string
+	ParseState(name string) (int, error)
+}
+
+// Open opens the world in path, creating the directory if needed. Block
+// states are named by states in the region files.
+func Open(path string, states States) (*Dir, error) {
+	if err := os.MkdirAll(filepath.Join(path, regionDir), 0o755); err != nil {
+		return nil, err
+	}
+	return &Dir{path: path, states: states, regions: make(map[regionPos]*regionFile)}, nil
+}
+
+// Path returns the directory of the world.
+func (d *Dir) Path() string {
+	return d.path
+}
+
+// LoadLevel reads the level metadata, or returns nil if the world is new.
+func (d *Dir) LoadLevel() (*Level, error) {
+	var l Level
+	if err := d.readJSON(levelFile, &l); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+// SaveLevel writes the level metadata.
+func (d *Dir) SaveLevel(l *Level) error {
+	return d.writeJSON(levelFile, l)
+}
+
+// LoadPlayer reads the player, or returns nil if it was never saved.
+func (d *Dir) LoadPlayer() (*Player, error) {
+	var p Player
+	if err := d.readJSON(playerFile, &p); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SavePlayer writes the player.
+func (d *Dir) SavePlayer(p *Player) error {
+	return d.writeJSON(playerFile, p)
+}
+
+// Load implements stream.Store.
+func (d *Dir) Load(pos world.ChunkPos) (*world.Chunk, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r, err := d.region(regionOf(pos))
+	if err != nil {
+		return nil, err
+	}
+	col, err := r.readColumn(pos, d.states)
+	if err == nil {
+		var c *world.Chunk
+		if c, err = col.chunk(pos); err == nil {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", d.regionPath(regionOf(pos)), err)
+}
+
+// Save implements stream.Store. The chunk is copied, so it may keep changing
+// after Save returns.
+func (d *Dir) Save(c *world.Chunk) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r, err := d.region(regionOf(c.Pos))
+	if err != nil {
+		return err
+	}
+	// Rewrite the whole column, so its state table covers every chunk
+	chunks := []*world.Chunk{c}
+	col, err := r.readColumn(c.Pos, d.states)
+	if err != nil {
+		// Replace a damaged column rather than failing every save
+		col = &column{}
+	}
+	for y := range col.chunks {
+		if y == c.Pos.Y {
+			continue
+		}
+		if old, err := col.chunk(world.ChunkPos{X: c.Pos.X, Y: y, Z: c.Pos.Z}); err == nil {
+			chunks = append(chunks, old)
+		}
+	}
+	return r.writeColumn(chunks, d.states)
+}
+
+// Flush writes the regions that have chunks saved since the last Flush.
+func (d *Dir) Flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for rp, r := range d.regions {
+		if !r.dirty {
+			continue
+		}
+		if err := r.file.Compact(); err != nil {
+			return err
+		}
+		if err := writeFile(d.regionPath(rp), r.buf.Bytes()); err != nil {
+			return err
+		}
+		r.dirty = false
+	}
+	return nil
+}
+
+// region returns a region, reading it from disk on first use. d.mu must be
+// held.
+func (d *Dir) region(rp regionPos) (*regionFile, error) {
+	if r := d.regions[rp]; r != nil {
+		return r, nil
+	}
+	data, err := os.ReadFile(d.regionPath(rp))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	r := &regionFile{buf: region.NewBuffer(data)}
+	if r.file, err = region.New(r.buf, r.buf.Len()); err != nil {
+		return nil, fmt.Errorf("%s: %w", d.regionPath(rp), err)
+	}
+	d.regions[rp] = r
+	return r, nil
+}
+
+func (d *Dir) regionPath(rp regionPos) string {
+	return filepath.Join(d.path, regionDir, fmt.Sprintf("r.%d.%d.c3r", rp.X, rp.Z))
+}
+
+func (d *Dir) readJSON(name string, v any) error {
+	data, err := os.ReadFile(filepath.Join(d.path, name))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func (d *Dir) writeJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(d.path, name), append(data, '\n'))
+}
+
+// writeFile replaces path with data through a temporary file in the same
+// directory, synced before the rename.
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,200 @@
+package save
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"craft3d/block"
+	"craft3d/region"
+	"craft3d/world"
+)
+
+func testRegistry(t *testing.T, defs string) *block.Registry {
+	t.Helper()
+	r, err := block.Parse([]byte(`{"blocks": [` + defs + `]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// blocks defines the blocks used by the tests, by ID.
+const blocks = `
+	{"id": 1, "name": "stone", "textures": {"all": "stone"}},
+	{"id": 2, "name": "log", "textures": {"all": "log"}, "properties": [{"name": "axis", "values": ["y", "x", "z"]}]},
+	{"id": 3, "name": "dirt", "textures": {"all": "dirt"}},
+	{"id": 4, "name": "sand", "textures": {"all": "sand"}},
+	{"id": 7, "name": "ore", "textures": {"all": "ore"}},
+	{"id": 9, "name": "glass", "textures": {"all": "glass"}}`
+
+func TestLevelAndPlayer(t *testing.T) {
+	d, err := Open(t.TempDir(), testRegistry(t, blocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, err := d.LoadLevel(); l != nil || err != nil {
+		t.Fatalf("LoadLevel of a new world = %v, %v", l, err)
+	}
+	if p, err := d.LoadPlayer(); p != nil || err != nil {
+		t.Fatalf("LoadPlayer of a new world = %v, %v", p, err)
+	}
+
+	level := &Level{Seed: -42, Generator: "noise", Time: 123.5, Spawn: [3]float32{0.5, 12, -3}}
+	player := &Player{Position: [3]float32{1.25, 30, -7.5}, Velocity: [3]float32{0, -2, 0}, Flying: true, Yaw: -91.5, Pitch: 12, Slot: 3}
+	if err := d.SaveLevel(level); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SavePlayer(player); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := Open(d.Path(), d.states)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, err := again.LoadLevel(); err != nil || *l != *level {
+		t.Errorf("LoadLevel = %+v, %v; want %+v", l, err, level)
+	}
+	if p, err := again.LoadPlayer(); err != nil || *p != *player {
+		t.Errorf("LoadPlayer = %+v, %v; want %+v", p, err, player)
+	}
+}
+
+func TestChunksRoundTrip(t *testing.T) {
+	d, err := Open(t.TempDir(), testRegistry(t, blocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Chunks in two regions, one of them at negative coordinates
+	a := world.NewChunk(world.ChunkPos{X: 3, Y: -2, Z: 31})
+	a.Set(0, 0, 0, 1)
+	logX := block.Pack(2, 1)
+	a.Set(15, 15, 15, logX)
+	b := world.NewChunk(world.ChunkPos{X: -1, Y: 0, Z: -33})
+	b.Set(4, 5, 6, 7)
+	for _, c := range []*world.Chunk{a, b} {
+		if err := d.Save(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Edits after Save are not saved
+	a.Set(1, 1, 1, 9)
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(d.Path(), regionDir, "*"))
+	if len(files) != 2 {
+		t.Errorf("region files = %v, want 2 without temporary files", files)
+	}
+
+	again, err := Open(d.Path(), d.states)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := again.Load(a.Pos)
+	if err != nil || got == nil {
+		t.Fatalf("Load = %v, %v", got, err)
+	}
+	if got.Get(0, 0, 0) != 1 || got.Get(15, 15, 15) != logX || got.Get(1, 1, 1) != world.Air || got.Count() != 2 {
+		t.Errorf("chunk a not restored")
+	}
+	if got, _ := again.Load(b.Pos); got == nil || got.Get(4, 5, 6) != 7 {
+		t.Errorf("chunk b not restored")
+	}
+	if got, err := again.Load(world.ChunkPos{X: 3, Y: -1, Z: 31}); got != nil || err != nil {
+		t.Errorf("Load of an unsaved chunk = %v, %v", got, err)
+	}
+}
+
+func TestCorruptRegion(t *testing.T) {
+	d, err := Open(t.TempDir(), testRegistry(t, blocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := world.NewChunk(world.ChunkPos{})
+	c.Set(1, 2, 3, 4)
+	d.Save(c)
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	path := d.regionPath(regionOf(c.Pos))
+	data, _ := os.ReadFile(path)
+
+	// A column whose compressed data is damaged
+	damaged := bytes.Clone(data)
+	damaged[2*region.SectorSize+6] ^= 0xff
+
+	for name, bad := range map[string][]byte{
+		"truncated": data[:len(data)/2],
+		"garbage":   []byte("definitely not a region"),
+		"damaged":   damaged,
+	} {
+		os.WriteFile(path, bad, 0o644)
+		again, _ := Open(d.Path(), d.states)
+		if _, err := again.Load(c.Pos); !errors.Is(err, errCorrupt) {
+			t.Errorf("%s: Load error = %v, want corrupt region", name, err)
+		}
+	}
+}
+
+func TestWriteFileReplaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	for _, content := range []string{"first", "second"} {
+		if err := writeFile(path, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != content {
+			t.Errorf("file = %q, want %q", got, content)
+		}
+	}
+	if files, _ := filepath.Glob(path + "*"); len(files) != 1 {
+		t.Errorf("files = %v, want only the target", files)
+	}
+}
+
+func TestRenumberedStates(t *testing.T) {
+	old := testRegistry(t, blocks)
+	d, err := Open(t.TempDir(), old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := world.NewChunk(world.ChunkPos{X: -3, Y: 1, Z: 40})
+	logZ, _ := old.ParseState("log[axis=z]")
+	c.Set(0, 0, 0, logZ)
+	c.Set(1, 0, 0, 1) // Stone
+	c.Set(2, 0, 0, 9) // Glass, removed below
+	if err := d.Save(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later version: log moved to ID 20 and gained a property, stone moved
+	// to ID 5 and glass is gone
+	renumbered := testRegistry(t, `
+		{"id": 5, "name": "stone", "textures": {"all": "stone"}},
+		{"id": 20, "name": "log", "textures": {"all": "log"}, "properties": [
+			{"name": "mossy", "values": ["false", "true"]},
+			{"name": "axis", "values": ["y", "x", "z"]}
+		]}`)
+	again, err := Open(d.Path(), renumbered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := again.Load(c.Pos)
+	if err != nil || got == nil {
+		t.Fatalf("Load = %v, %v", got, err)
+	}
+	log := renumbered.ByName("log")
+	if s := got.Get(0, 0, 0); renumbered.Get(s) != log || log.Value(s, "axis") != "z" || log.Value(s, "mossy") != "false" {
+		t.Errorf("log loaded as %q", renumbered.StateName(s))
+	}
+	if got.Get(1, 0, 0) != 5 || got.Get(2, 0, 0) != world.Air || got.Count() != 2 {
+		t.Errorf("stone and glass loaded as %d and %d", got.Get(1, 0, 0), got.Get(2, 0, 0))
+	}
+}
@@ -0,0 +1,305 @@
+// Package stream loads and unloads the chunks around the player, so the
+// world can be as large as the generator allows.
+//
+// Chunks are loaded in whole columns, from MinChunkY to MaxChunkY. Columns
+// come from a Store if they were saved, and from the generator otherwise;
+// either way the work happens on a pool of background goroutines, nearest
+// column first, and finished columns are installed in the world by Update
+// on the caller's goroutine. The world itself is never touched by the
+// workers.
+package stream
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"craft3d/world"
+	"craft3d/worldgen"
+)
+
+// Column identifies a column of chunks by its chunk X and Z.
+type Column struct {
+	X, Z int
+}
+
+// ColumnOf returns the column holding chunk cp.
+func ColumnOf(cp world.ChunkPos) Column {
+	return Column{cp.X, cp.Z}
+}
+
+// Store keeps chunks that were unloaded after being edited.
+type Store interface {
+	// Load returns the saved chunk at pos, or nil if it was never saved.
+	Load(pos world.ChunkPos) (*world.Chunk, error)
+	Save(c *world.Chunk) error
+}
+
+// MemoryStore is a Store that keeps chunks in memory, for worlds that are
+// not saved to disk.
+type MemoryStore struct {
+	mu     sync.Mutex
+	chunks map[world.ChunkPos]*world.Chunk
+}
+
+// NewMemoryStore returns an empty store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{chunks: make(map[world.ChunkPos]*world.Chunk)}
+}
+
+// Load implements Store.
+func (m *MemoryStore) Load(pos world.ChunkPos) (*world.Chunk, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.chunks[pos], nil
+}
+
+// Save implements Store.
+func (m *MemoryStore) Save(c *world.Chunk) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chunks[c.Pos] = c
+	return nil
+}
+
+// Streamer keeps the columns within Radius of a centre loaded in a world.
+type Streamer struct {
+	Radius int // In chunks, on the X and Z axes
+
+	world *world.World
+	gen   worldgen.Generator
+	seed  int64
+	store Store
+
+	loaded  map[Column]bool // Installed in the world
+	results chan result
+
+	mu      sync.Mutex
+	wake    *sync.Cond
+	queue   []Column        // Waiting columns, farthest first
+	working map[Column]bool // Queued or being loaded
+	closed  bool
+	done    sync.WaitGroup
+}
+
+// result is a loaded column. err is the first store error, if any; the
+// chunks that failed to load were generated instead.
+type result struct {
+	col    Column
+	chunks []*world.Chunk
+	err    error
+}
+
+// New creates a streamer with the given number of worker goroutines.
+func New(w *world.World, gen worldgen.Generator, seed int64, store Store, radius, workers int) *Streamer {
+	s := &Streamer{
+		Radius:  radius,
+		world:   w,
+		gen:     gen,
+		seed:    seed,
+		store:   store,
+		loaded:  make(map[Column]bool),
+		results: make(chan result, 2*workers),
+		working: make(map[Column]bool),
+	}
+	s.wake = sync.NewCond(&s.mu)
+	for i := 0; i < workers; i++ {
+		s.done.Add(1)
+		go s.work()
+	}
+	return s
+}
+
+// Loaded reports whether the column holding chunk cp is installed.
+func (s *Streamer) Loaded(cp world.ChunkPos) bool {
+	return s.loaded[ColumnOf(cp)]
+}
+
+// Preload loads the columns within radius of centre right away, on the
+// caller's goroutine, for example so the player has ground to spawn on.
+func (s *Streamer) Preload(centre world.ChunkPos, radius int) error {
+	var first error
+	for _, col := range columnsAround(ColumnOf(centre), radius) {
+		if s.loaded[col] {
+			continue
+		}
+		r := s.load(col)
+		if r.err != nil && first == nil {
+			first = r.err
+		}
+		s.install(r)
+	}
+	return first
+}
+
+// Update installs the columns loaded since the last call, unloads the ones
+// more than one column beyond Radius of centre (saving the edited chunks)
+// and queues the missing ones, nearest first. It never waits for the
+// workers. The returned error is the first load or save failure; streaming
+// goes on regardless.
+func (s *Streamer) Update(centre world.ChunkPos) error {
+	var first error
+	fail := func(err error) {
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+
+	c := ColumnOf(centre)
+	for more := true; more; {
+		select {
+		case r := <-s.results:
+			fail(r.err)
+			s.mu.Lock()
+			delete(s.working, r.col)
+			s.mu.Unlock()
+			if !s.loaded[r.col] && distance2(r.col, c) <= (s.Radius+1)*(s.Radius+1) {
+				s.install(r)
+			}
+		default:
+			more = false
+		}
+	}
+
+	for col := range s.loaded {
+		if distance2(col, c) > (s.Radius+1)*(s.Radius+1) {
+			fail(s.unload(col))
+		}
+	}
+
+	// Rebuild the queue around the new centre
+	s.mu.Lock()
+	for _, col := range s.queue {
+		delete(s.working, col)
+	}
+	s.queue = s.queue[:0]
+	for _, col := range columnsAround(c, s.Radius) {
+		if !s.loaded[col] && !s.working[col] {
+			s.queue = append(s.queue, col)
+			s.working[col] = true
+		}
+	}
+	// Farthest first, so workers pop the nearest from the end
+	for i, j := 0, len(s.queue)-1; i < j; i, j = i+1, j-1 {
+		s.queue[i], s.queue[j] = s.queue[j], s.queue[i]
+	}
+	s.mu.Unlock()
+	s.wake.Broadcast()
+	return first
+}
+
+// Pending returns the number of columns waiting to be loaded.
+func (s *Streamer) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.working)
+}
+
+// Close stops the workers and unloads every column, saving the edited
+// chunks. It returns the first save error.
+func (s *Streamer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.wake.Broadcast()
+
+	// Drain results so workers blocked on sending can exit
+	go func() {
+		s.done.Wait()
+		close(s.results)
+	}()
+	for range s.results {
+	}
+
+	var first error
+	for col := range s.loaded {
+		if err := s.unload(col); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (s *Streamer) work() {
+	defer s.done.Done()
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.wake.Wait()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		col := s.queue[len(s.queue)-1]
+		s.queue = s.queue[:len(s.queue)-1]
+		s.mu.Unlock()
+
+		s.results <- s.load(col)
+	}
+}
+
+// load reads a column from the store, generating the chunks that were never
+// saved.
+func (s *Streamer) load(col Column) result {
+	r := result{col: col}
+	for cy := worldgen.MinChunkY; cy <= worldgen.MaxChunkY; cy++ {
+		cp := world.ChunkPos{X: col.X, Y: cy, Z: col.Z}
+		c, err := s.store.Load(cp)
+		if err != nil && r.err == nil {
+			r.err = fmt.Errorf("load chunk %v: %w", cp, err)
+		}
+		if c == nil {
+			c = s.gen.GenerateChunk(s.seed, cp)
+			// Drop palette entries of blocks the generator overwrote
+			c.Blocks().Compact()
+		}
+		r.chunks = append(r.chunks, c)
+	}
+	return r
+}
+
+func (s *Streamer) install(r result) {
+	for _, c := range r.chunks {
+		if !c.Empty() {
+			s.world.SetChunk(c)
+		}
+	}
+	s.loaded[r.col] = true
+}
+
+func (s *Streamer) unload(col Column) error {
+	var first error
+	for cy := worldgen.MinChunkY; cy <= worldgen.MaxChunkY; cy++ {
+		c, changed := s.world.RemoveChunk(world.ChunkPos{X: col.X, Y: cy, Z: col.Z})
+		if !changed {
+			continue
+		}
+		if err := s.store.Save(c); err != nil && first == nil {
+			first = fmt.Errorf("save chunk %v: %w", c.Pos, err)
+		}
+	}
+	delete(s.loaded, col)
+	return first
+}
+
+// columnsAround returns the columns within radius of c, nearest first.
+func columnsAround(c Column, radius int) []Column {
+	var list []Column
+	for dx := -radius; dx <= radius; dx++ {
+		for dz := -radius; dz <= radius; dz++ {
+			if dx*dx+dz*dz <= radius*radius {
+				list = append(list, Column{c.X + dx, c.Z + dz})
+			}
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return distance2(list[i], c) < distance2(list[j], c)
+	})
+	return list
+}
+
+func distance2(a, b Column) int {
+	dx, dz := a.X-b.X, a.Z-b.Z
+	return dx*dx + dz*dz
+}
@@ -0,0 +1,146 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"craft3d/world"
+	"craft3d/worldgen"
+)
+
+// flatGen fills every chunk below y=0 with block 1 and records the columns
+// it generates, in order.
+type flatGen struct {
+	mu      sync.Mutex
+	columns []Column
+}
+
+func (g *flatGen) GenerateChunk(seed int64, pos world.ChunkPos) *world.Chunk {
+	c := world.NewChunk(pos)
+	if pos.Y < 0 {
+		for i := 0; i < world.ChunkSize; i++ {
+			c.Set(i, i, i, 1)
+		}
+	}
+	if pos.Y == worldgen.MinChunkY {
+		g.mu.Lock()
+		g.columns = append(g.columns, ColumnOf(pos))
+		g.mu.Unlock()
+	}
+	return c
+}
+
+// settle calls Update until nothing is pending.
+func settle(t *testing.T, s *Streamer, centre world.ChunkPos) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := s.Update(centre); err != nil {
+			t.Fatal(err)
+		}
+		if s.Pending() == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d columns still pending", s.Pending())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func loadedColumns(w *world.World) map[Column]bool {
+	cols := map[Column]bool{}
+	for _, c := range w.Chunks() {
+		cols[ColumnOf(c.Pos)] = true
+	}
+	return cols
+}
+
+func TestStreamLoadsAroundCentre(t *testing.T) {
+	w := world.New()
+	s := New(w, &flatGen{}, 0, NewMemoryStore(), 2, 3)
+	defer s.Close()
+
+	settle(t, s, world.ChunkPos{})
+	cols := loadedColumns(w)
+	if want := len(columnsAround(Column{}, 2)); len(cols) != want {
+		t.Errorf("%d columns loaded, want %d", len(cols), want)
+	}
+	if !cols[Column{2, 0}] || cols[Column{2, 2}] {
+		t.Errorf("loaded columns are not a circle: %v", cols)
+	}
+
+	// Moving far away unloads everything and loads the new area
+	far := world.ChunkPos{X: 10}
+	settle(t, s, far)
+	for col := range loadedColumns(w) {
+		if distance2(col, ColumnOf(far)) > 9 {
+			t.Errorf("column %v still loaded", col)
+		}
+	}
+	if s.Loaded(world.ChunkPos{}) || !s.Loaded(far) {
+		t.Errorf("Loaded does not follow the centre")
+	}
+}
+
+func TestStreamNearestFirst(t *testing.T) {
+	g := &flatGen{}
+	s := New(world.New(), g, 0, NewMemoryStore(), 4, 1)
+	defer s.Close()
+	settle(t, s, world.ChunkPos{})
+
+	// A single worker takes the whole queue in order
+	for i := 1; i < len(g.columns); i++ {
+		if distance2(g.columns[i], Column{}) < distance2(g.columns[i-1], Column{}) {
+			t.Fatalf("column %v generated after farther column %v", g.columns[i], g.columns[i-1])
+		}
+	}
+}
+
+func TestStreamKeepsEdits(t *testing.T) {
+	w := world.New()
+	store := NewMemoryStore()
+	s := New(w, &flatGen{}, 0, store, 1, 2)
+	defer s.Close()
+	settle(t, s, world.ChunkPos{})
+
+	p := world.BlockPos{X: 3, Y: -5, Z: 4}
+	w.SetBlock(p, 7)
+
+	settle(t, s, world.ChunkPos{X: 20})
+	if w.HasBlock(p) {
+		t.Fatalf("block still loaded")
+	}
+	if c, _ := store.Load(world.ChunkPosOf(p)); c == nil {
+		t.Fatalf("edited chunk was not saved")
+	}
+
+	settle(t, s, world.ChunkPos{})
+	if got := w.GetBlock(p); got != 7 {
+		t.Errorf("block after reload = %d, want 7", got)
+	}
+}
+
+// failStore fails every operation.
+type failStore struct{}
+
+func (failStore) Load(pos world.ChunkPos) (*world.Chunk, error) { return nil, errors.New("broken") }
+func (failStore) Save(c *world.Chunk) error                     { return errors.New("broken") }
+
+func TestStreamStoreErrors(t *testing.T) {
+	w := world.New()
+	s := New(w, &flatGen{}, 0, failStore{}, 1, 1)
+	if err := s.Preload(world.ChunkPos{}, 0); err == nil {
+		t.Errorf("expected load error")
+	}
+	// Chunks that failed to load are generated instead
+	if !s.Loaded(world.ChunkPos{}) || w.ChunkAt(world.ChunkPos{Y: -1}) == nil {
+		t.Errorf("column not generated after a load error")
+	}
+	w.SetBlock(world.BlockPos{Y: -3}, 2)
+	if err := s.Close(); err == nil {
+		t.Errorf("expected save error")
+	}
+}
@@ -0,0 +1,386 @@
+package world
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+)
+
+// Section is the palette-compressed storage of the blocks of a chunk.
+//
+// Cells hold indices into a palette of block IDs, bit-packed into uint64
+// words. The width of an index starts at 1 bit and doubles (2, 4, 8) as
+// distinct blocks are added; past 256 of them the section stores block IDs
+// directly in 16 bits, like the plain array it replaces. A section of one
+// block type, including the all-air zero value, stores no cells at all.
+// Indices never straddle words, so a lookup is a shift and a mask.
+//
+// Palette entries are never dropped by Set; Compact rebuilds the palette
+// from the blocks actually present.
+type Section struct {
+	palette []uint16 // Block ID of each index; nil in direct mode
+	data    []uint64 // Packed cells; nil when the section is uniform
+	shift   uint8    // log2 of the bits per cell
+	count   int      // Non-air blocks
+}
+
+const (
+	maxPaletteShift = 3 // 8-bit indices, 256 palette entries
+	directShift     = 4 // 16-bit block IDs
+)
+
+// Get returns the block at cell i, in index order.
+func (s *Section) Get(i int) int {
+	if s.data == nil {
+		if len(s.palette) == 0 {
+			return Air
+		}
+		return int(s.palette[0])
+	}
+	v := s.cell(i)
+	if s.palette == nil {
+		return int(v)
+	}
+	return int(s.palette[v])
+}
+
+// cell returns the raw value stored for cell i.
+func (s *Section) cell(i int) uint64 {
+	perWord := 6 - s.shift // log2 of the cells per word
+	word := s.data[i>>perWord]
+	off := uint(i&(1<<perWord-1)) << s.shift
+	return word >> off & (1<<(1<<s.shift) - 1)
+}
+
+func (s *Section) setCell(i int, v uint64) {
+	perWord := 6 - s.shift
+	off := uint(i&(1<<perWord-1)) << s.shift
+	mask := uint64(1<<(1<<s.shift)-1) << off
+	w := &s.data[i>>perWord]
+	*w = *w&^mask | v<<off
+}
+
+// Set stores block id at cell i.
+func (s *Section) Set(i, id int) {
+	old := s.Get(i)
+	if old == id {
+		return
+	}
+	if old == Air {
+		s.count++
+	} else if id == Air {
+		s.count--
+	}
+
+	if s.data == nil {
+		// A uniform section becomes a 1-bit one with the old block at 0
+		s.palette = []uint16{uint16(old), uint16(id)}
+		s.shift = 0
+		s.data = make([]uint64, chunkVolume>>6)
+		s.setCell(i, 1)
+		return
+	}
+	if s.palette == nil {
+		s.setCell(i, uint64(id))
+		return
+	}
+	v := -1
+	for j, p := range s.palette {
+		if int(p) == id {
+			v = j
+			break
+		}
+	}
+	if v < 0 {
+		v = len(s.palette)
+		s.palette = append(s.palette, uint16(id))
+		if v >= 1<<(1<<s.shift) {
+			s.grow()
+		}
+		if s.palette == nil {
+			v = id
+		}
+	}
+	s.setCell(i, uint64(v))
+}
+
+// grow doubles the bits per cell, switching to direct mode past 8 bits.
+func (s *Section) grow() {
+	old := *s
+	s.shift++
+	if s.shift > maxPaletteShift {
+		s.shift = directShift
+	}
+	s.data = make([]uint64, chunkVolume>>(6-s.shift))
+	for i := 0; i < chunkVolume; i++ {
+		v := old.cell(i)
+		if s.shift == directShift {
+			v = uint64(old.palette[v])
+		}
+		s.setCell(i, v)
+	}
+	if s.shift == directShift {
+		s.palette = nil
+	}
+}
+
+// Count returns the number of non-air blocks.
+func (s *Section) Count() int {
+	return s.count
+}
+
+// Uniform returns the block filling the section, if there is only one.
+// Sections that lost blocks since the last Compact may not be detected.
+func (s *Section) Uniform() (id int, ok bool) {
+	if s.data != nil {
+		return 0, false
+	}
+	return s.Get(0), true
+}
+
+// Bits returns the bits stored per cell: 0 for a uniform section, 1 to 8
+// with a palette and 16 for block IDs.
+func (s *Section) Bits() int {
+	if s.data == nil {
+		return 0
+	}
+	return 1 << s.shift
+}
+
+// Compact rebuilds the palette from the blocks present, using the narrowest
+// cells that fit them.
+func (s *Section) Compact() {
+	if s.data == nil {
+		return
+	}
+	// Blocks present, in order of first appearance, and the new value of
+	// each old palette entry
+	var ids []uint16
+	var remap []uint64
+	if s.palette != nil {
+		remap = make([]uint64, len(s.palette))
+		used := make([]bool, len(s.palette))
+		for i := 0; i < chunkVolume; i++ {
+			v := s.cell(i)
+			if !used[v] {
+				used[v] = true
+				remap[v] = uint64(len(ids))
+				ids = append(ids, s.palette[v])
+			}
+		}
+	} else {
+		seen := make(map[uint16]bool)
+		for i := 0; i < chunkVolume; i++ {
+			if id := uint16(s.cell(i)); !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	c := Section{count: s.count}
+	if len(ids) == 1 {
+		if ids[0] != Air {
+			c.palette = ids
+		}
+		*s = c
+		return
+	}
+	c.shift = uint8(bits.Len(uint(bits.Len(uint(len(ids)-1)) - 1)))
+	if c.shift > maxPaletteShift {
+		c.shift = directShift
+	} else {
+		c.palette = ids
+	}
+	c.data = make([]uint64, chunkVolume>>(6-c.shift))
+	for i := 0; i < chunkVolume; i++ {
+		switch {
+		case c.palette == nil:
+			c.setCell(i, uint64(s.Get(i)))
+		case s.palette == nil:
+			c.setCell(i, uint64(slices.Index(ids, uint16(s.cell(i)))))
+		default:
+			c.setCell(i, remap[s.cell(i)])
+		}
+	}
+	*s = c
+}
+
+// Values returns the distinct blocks of the section, in no particular
+// order. Like Uniform, it may list blocks that were overwritten since the
+// last Compact.
+func (s *Section) Values() []int {
+	switch {
+	case s.data == nil:
+		return []int{s.Get(0)}
+	case s.palette != nil:
+		list := make([]int, len(s.palette))
+		for i, id := range s.palette {
+			list[i] = int(id)
+		}
+		return list
+	}
+	seen := make(map[uint64]bool)
+	var list []int
+	for i := 0; i < chunkVolume; i++ {
+		if v := s.cell(i); !seen[v] {
+			seen[v] = true
+			list = append(list, int(v))
+		}
+	}
+	return list
+}
+
+// Remap replaces every block id with fn(id), for example to renumber blocks
+// saved by another version. fn is called once per palette entry, or per
+// cell in direct mode.
+func (s *Section) Remap(fn func(id int) int) {
+	switch {
+	case s.data == nil:
+		id := fn(s.Get(0))
+		*s = Section{}
+		if id != Air {
+			s.palette = []uint16{uint16(id)}
+			s.count = chunkVolume
+		}
+		return
+	case s.palette != nil:
+		for i, id := range s.palette {
+			s.palette[i] = uint16(fn(int(id)))
+		}
+	default:
+		for i := 0; i < chunkVolume; i++ {
+			s.setCell(i, uint64(fn(int(s.cell(i)))))
+		}
+	}
+	s.count = 0
+	for i := 0; i < chunkVolume; i++ {
+		if s.Get(i) != Air {
+			s.count++
+		}
+	}
+}
+
+// Clone returns a copy of the section that shares no memory with it.
+func (s *Section) Clone() Section {
+	c := *s
+	c.palette = append([]uint16(nil), s.palette...)
+	c.data = append([]uint64(nil), s.data...)
+	return c
+}
+
+// Size returns the approximate memory used by the section's cells and
+// palette, in bytes.
+func (s *Section) Size() int {
+	return 8*len(s.data) + 2*len(s.palette)
+}
+
+// Sections are encoded for saving and network transfer as:
+//
+//	bits     byte, as returned by Bits
+//	palette  uvarint count, then uvarint block IDs (absent for 16 bits)
+//	cells    little-endian uint64 words (absent for 0 bits)
+//
+// A uniform section has a palette of one block. Encoding compacts a copy of
+// the section first, so the palette only lists blocks that are present.
+
+// ErrBadSection is wrapped by the errors of UnmarshalBinary.
+var ErrBadSection = errors.New("world: bad section encoding")
+
+// AppendBinary appends the encoding of the section to b.
+func (s *Section) AppendBinary(b []byte) ([]byte, error) {
+	c := s.Clone()
+	c.Compact()
+	b = append(b, byte(c.Bits()))
+	if c.data == nil {
+		b = binary.AppendUvarint(b, 1)
+		return binary.AppendUvarint(b, uint64(c.Get(0))), nil
+	}
+	if c.palette != nil {
+		b = binary.AppendUvarint(b, uint64(len(c.palette)))
+		for _, id := range c.palette {
+			b = binary.AppendUvarint(b, uint64(id))
+		}
+	}
+	for _, w := range c.data {
+		b = binary.LittleEndian.AppendUint64(b, w)
+	}
+	return b, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (s *Section) MarshalBinary() ([]byte, error) {
+	return s.AppendBinary(nil)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. Damaged data gives
+// an error wrapping ErrBadSection.
+func (s *Section) UnmarshalBinary(data []byte) error {
+	n, err := s.decode(data)
+	if err == nil && n != len(data) {
+		err = fmt.Errorf("%w: %d trailing bytes", ErrBadSection, len(data)-n)
+	}
+	return err
+}
+
+// decode reads a section from the start of data and returns the number of
+// bytes used.
+func (s *Section) decode(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("%w: empty", ErrBadSection)
+	}
+	var c Section
+	cellBits, n := int(data[0]), 1
+	switch cellBits {
+	case 0, 1, 2, 4, 8:
+		count, m := binary.Uvarint(data[n:])
+		if m <= 0 || count == 0 || count > uint64(1)<<cellBits && cellBits > 0 || count != 1 && cellBits == 0 {
+			return 0, fmt.Errorf("%w: palette of %d for %d bits", ErrBadSection, count, cellBits)
+		}
+		n += m
+		c.palette = make([]uint16, count)
+		for i := range c.palette {
+			id, m := binary.Uvarint(data[n:])
+			if m <= 0 || id > 0xffff {
+				return 0, fmt.Errorf("%w: palette entry %d", ErrBadSection, i)
+			}
+			c.palette[i] = uint16(id)
+			n += m
+		}
+	case 16:
+	default:
+		return 0, fmt.Errorf("%w: %d bits per cell", ErrBadSection, cellBits)
+	}
+
+	if cellBits == 0 {
+		if c.palette[0] == Air {
+			c.palette = nil
+		} else {
+			c.count = chunkVolume
+		}
+		*s = c
+		return n, nil
+	}
+	c.shift = uint8(bits.TrailingZeros(uint(cellBits)))
+	c.data = make([]uint64, chunkVolume>>(6-c.shift))
+	if len(data)-n < 8*len(c.data) {
+		return 0, fmt.Errorf("%w: %d bytes of cells, want %d", ErrBadSection, len(data)-n, 8*len(c.data))
+	}
+	for i := range c.data {
+		c.data[i] = binary.LittleEndian.Uint64(data[n:])
+		n += 8
+	}
+	for i := 0; i < chunkVolume; i++ {
+		v := c.cell(i)
+		if c.palette != nil && v >= uint64(len(c.palette)) {
+			return 0, fmt.Errorf("%w: cell %d uses palette entry %d of %d", ErrBadSection, i, v, len(c.palette))
+		}
+		if c.Get(i) != Air {
+			c.count++
+		}
+	}
+	*s = c
+	return n, nil
+}
@@ -0,0 +1,330 @@
+package world
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// fill sets every cell of s from ids, and returns the expected contents.
+func fill(s *Section, seed int64, ids []int) []int {
+	r := rand.New(rand.NewSource(seed))
+	want := make([]int, chunkVolume)
+	for i := range want {
+		want[i] = ids[r.Intn(len(ids))]
+		s.Set(i, want[i])
+	}
+	return want
+}
+
+func checkSection(t *testing.T, name string, s *Section, want []int) {
+	t.Helper()
+	count := 0
+	for i, id := range want {
+		if got := s.Get(i); got != id {
+			t.Fatalf("%s: Get(%d) = %d, want %d", name, i, got, id)
+		}
+		if id != Air {
+			count++
+		}
+	}
+	if s.Count() != count {
+		t.Errorf("%s: Count = %d, want %d", name, s.Count(), count)
+	}
+}
+
+// bitsFor returns the bits per cell expected for a palette of n blocks.
+func bitsFor(n int) int {
+	for _, b := range []int{0, 1, 2, 4, 8} {
+		if n <= 1<<b {
+			return b
+		}
+	}
+	return 16
+}
+
+func TestSectionGrows(t *testing.T) {
+	for _, types := range []int{1, 2, 3, 4, 5, 15, 16, 17, 255, 256, 257, 1000} {
+		ids := make([]int, types)
+		for i := range ids {
+			ids[i] = 1 + i*61 // Spread over the whole ID range
+		}
+		var s Section
+		want := fill(&s, int64(types), ids)
+		checkSection(t, "fill", &s, want)
+		// The palette also holds the air the section started with
+		if got := s.Bits(); got != bitsFor(types+1) {
+			t.Errorf("%d types: Bits = %d, want %d", types, got, bitsFor(types+1))
+		}
+
+		s.Compact()
+		checkSection(t, "compact", &s, want)
+		if got := s.Bits(); got != bitsFor(types) {
+			t.Errorf("%d types after Compact: Bits = %d, want %d", types, got, bitsFor(types))
+		}
+	}
+}
+
+func TestSectionUniform(t *testing.T) {
+	var s Section
+	if id, ok := s.Uniform(); !ok || id != Air || s.Size() != 0 {
+		t.Errorf("zero section: Uniform = %d, %v, Size = %d", id, ok, s.Size())
+	}
+	for i := 0; i < chunkVolume; i++ {
+		s.Set(i, 7)
+	}
+	if s.Count() != chunkVolume {
+		t.Errorf("Count = %d", s.Count())
+	}
+	s.Compact()
+	if id, ok := s.Uniform(); !ok || id != 7 || s.Bits() != 0 {
+		t.Errorf("filled section: Uniform = %d, %v, Bits = %d", id, ok, s.Bits())
+	}
+	s.Set(100, Air)
+	if _, ok := s.Uniform(); ok || s.Get(100) != Air || s.Get(99) != 7 || s.Count() != chunkVolume-1 {
+		t.Errorf("section not split after Set")
+	}
+	s.Set(100, 7)
+	s.Compact()
+	if _, ok := s.Uniform(); !ok {
+		t.Errorf("section not uniform after Compact")
+	}
+}
+
+func TestSectionEncoding(t *testing.T) {
+	sections := map[string]func(s *Section){
+		"air":    func(s *Section) {},
+		"stone":  func(s *Section) { fill(s, 1, []int{2}) },
+		"mixed":  func(s *Section) { fill(s, 2, []int{Air, 1, 2, 3, 4, 5}) },
+		"direct": func(s *Section) { fill(s, 3, []int{Air, 1, 300, 40000, 65535}); grow(s) },
+		// Palette entries of blocks that were overwritten are dropped
+		"overwritten": func(s *Section) {
+			fill(s, 4, []int{1, 2, 3, 4, 5, 6})
+			for i := 0; i < chunkVolume; i++ {
+				s.Set(i, i%2)
+			}
+		},
+	}
+	for name, build := range sections {
+		var s Section
+		build(&s)
+		want := make([]int, chunkVolume)
+		for i := range want {
+			want[i] = s.Get(i)
+		}
+		data, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Section
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkSection(t, name, &got, want)
+		if name == "overwritten" && got.Bits() != 1 {
+			t.Errorf("overwritten: Bits = %d, want 1", got.Bits())
+		}
+	}
+}
+
+// grow forces direct mode by adding palette entries.
+func grow(s *Section) {
+	for id := 1000; s.Bits() < 16; id++ {
+		old := s.Get(0)
+		s.Set(0, id)
+		s.Set(0, old)
+	}
+}
+
+func TestSectionBadEncoding(t *testing.T) {
+	var s Section
+	fill(&s, 1, []int{1, 2, 3})
+	good, _ := s.MarshalBinary()
+
+	bad := map[string][]byte{
+		"empty":         nil,
+		"bits":          {3},
+		"no palette":    {4},
+		"empty palette": {4, 0},
+		"big palette":   {1, 3, 1, 2, 3},
+		"uniform pair":  {0, 2, 1, 2},
+		"big id":        {0, 1, 0xff, 0xff, 0x7f},
+		"short cells":   good[:len(good)-1],
+		"trailing":      append(append([]byte(nil), good...), 0),
+	}
+	// A cell pointing past the palette of 3
+	outside := append([]byte(nil), good...)
+	outside[len(outside)-1] = 0xff
+	bad["outside"] = outside
+
+	for name, data := range bad {
+		var got Section
+		if err := got.UnmarshalBinary(data); !errors.Is(err, ErrBadSection) {
+			t.Errorf("%s: error = %v, want ErrBadSection", name, err)
+		}
+	}
+}
+
+func FuzzSection(f *testing.F) {
+	var s Section
+	fill(&s, 1, []int{1, 2, 3})
+	data, _ := s.MarshalBinary()
+	f.Add(data)
+	f.Add([]byte{0, 1, 5})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var s Section
+		if err := s.UnmarshalBinary(data); err != nil {
+			return
+		}
+		// Whatever decodes must encode and decode to the same blocks
+		again, _ := s.MarshalBinary()
+		var t2 Section
+		if err := t2.UnmarshalBinary(again); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < chunkVolume; i++ {
+			if s.Get(i) != t2.Get(i) {
+				t.Fatalf("cell %d changed", i)
+			}
+		}
+	})
+}
+
+// naiveSection is the plain array sections replaced, for the benchmarks.
+type naiveSection []uint16
+
+func (n naiveSection) Get(i int) int     { return int(n[i]) }
+func (n naiveSection) Set(i int, id int) { n[i] = uint16(id) }
+
+// terrain returns the blocks of a typical underground section: mostly
+// rock, some dirt and air, and a few ores.
+func terrain() []int {
+	r := rand.New(rand.NewSource(1))
+	ids := make([]int, chunkVolume)
+	for i := range ids {
+		switch v := r.Intn(100); {
+		case v < 70:
+			ids[i] = 2
+		case v < 85:
+			ids[i] = 4
+		case v < 97:
+			ids[i] = Air
+		default:
+			ids[i] = 7 + v%4
+		}
+	}
+	return ids
+}
+
+func BenchmarkSectionGet(b *testing.B) {
+	var s Section
+	for i, id := range terrain() {
+		s.Set(i, id)
+	}
+	b.ReportMetric(float64(s.Size()), "bytes/section")
+	b.ResetTimer()
+	sum := 0
+	for n := 0; n < b.N; n++ {
+		sum += s.Get(n & (chunkVolume - 1))
+	}
+	_ = sum
+}
+
+func BenchmarkNaiveGet(b *testing.B) {
+	s := make(naiveSection, chunkVolume)
+	for i, id := range terrain() {
+		s.Set(i, id)
+	}
+	b.ReportMetric(float64(2*len(s)), "bytes/section")
+	b.ResetTimer()
+	sum := 0
+	for n := 0; n < b.N; n++ {
+		sum += s.Get(n & (chunkVolume - 1))
+	}
+	_ = sum
+}
+
+func BenchmarkSectionFill(b *testing.B) {
+	ids := terrain()
+	for n := 0; n < b.N; n++ {
+		var s Section
+		for i, id := range ids {
+			s.Set(i, id)
+		}
+	}
+}
+
+func BenchmarkNaiveFill(b *testing.B) {
+	ids := terrain()
+	for n := 0; n < b.N; n++ {
+		s := make(naiveSection, chunkVolume)
+		for i, id := range ids {
+			s.Set(i, id)
+		}
+	}
+}
+
+func BenchmarkSectionEncode(b *testing.B) {
+	var s Section
+	for i, id := range terrain() {
+		s.Set(i, id)
+	}
+	data, _ := s.MarshalBinary()
+	b.ReportMetric(float64(len(data)), "bytes/encoded")
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		s.MarshalBinary()
+	}
+}
+
+func BenchmarkSectionDecode(b *testing.B) {
+	var s Section
+	for i, id := range terrain() {
+		s.Set(i, id)
+	}
+	data, _ := s.MarshalBinary()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		var d Section
+		d.UnmarshalBinary(data)
+	}
+}
+
+func TestSectionRemap(t *testing.T) {
+	double := func(id int) int { return 2 * id }
+	for name, ids := range map[string][]int{
+		"uniform":    {3},
+		"air":        {Air},
+		"palette":    {Air, 1, 2, 3},
+		"direct":     {Air, 1, 300, 40000 / 2},
+		"to nothing": {Air, 7},
+	} {
+		var s Section
+		want := fill(&s, 1, ids)
+		if name == "direct" {
+			grow(&s)
+		}
+		if name == "uniform" {
+			s.Compact()
+		}
+		fn := double
+		if name == "to nothing" {
+			fn = func(int) int { return Air }
+		}
+		s.Remap(fn)
+		for i := range want {
+			want[i] = fn(want[i])
+		}
+		checkSection(t, name, &s, want)
+
+		values := map[int]bool{}
+		for _, v := range s.Values() {
+			values[v] = true
+		}
+		for _, id := range want {
+			if !values[id] {
+				t.Errorf("%s: Values misses %d", name, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Package world stores the voxel terrain.
+//
+// Blocks are kept in fixed-size cubic chunks backed by palette-compressed
+// sections, so a lookup is a map access per chunk plus a few bit operations
+// instead of hashing every single voxel.
+package world
+
+// ChunkSize is the edge length of a chunk in blocks.
+const ChunkSize = 16
+
+const chunkVolume = ChunkSize * ChunkSize * ChunkSize
+
+// Air is the block type ID of an empty cell.
+const Air = 0
+
+// BlockPos is the integer position of a block. Block (0,0,0) covers
+// -0.5..0.5 on every axis.
+type BlockPos struct {
+	X, Y, Z int
+}
+
+// ChunkPos identifies a chunk. Chunk (0,0,0) holds blocks 0..15 on every axis.
+type ChunkPos struct {
+	X, Y, Z int
+}
+
+// ChunkPosOf returns the chunk that contains p.
+func ChunkPosOf(p BlockPos) ChunkPos {
+	return ChunkPos{floorDiv(p.X), floorDiv(p.Y), floorDiv(p.Z)}
+}
+
+// Origin returns the position of the chunk's lowest corner block.
+func (c ChunkPos) Origin() BlockPos {
+	return BlockPos{c.X * ChunkSize, c.Y * ChunkSize, c.Z * ChunkSize}
+}
+
+// Add returns the chunk position offset by the given amount.
+func (c ChunkPos) Add(dx, dy, dz int) ChunkPos {
+	return ChunkPos{c.X + dx, c.Y + dy, c.Z + dz}
+}
+
+// Local returns the coordinates of p inside its chunk, each in 0..ChunkSize-1.
+func Local(p BlockPos) (x, y, z int) {
+	return floorMod(p.X), floorMod(p.Y), floorMod(p.Z)
+}
+
+func floorDiv(v int) int {
+	if v < 0 {
+		return (v+1)/ChunkSize - 1
+	}
+	return v / ChunkSize
+}
+
+func floorMod(v int) int {
+	m := v % ChunkSize
+	if m < 0 {
+		m += ChunkSize
+	}
+	return m
+}
+
+// Chunk is a ChunkSize³ section of the world.
+type Chunk struct {
+	Pos ChunkPos
+
+	blocks Section
+}
+
+// NewChunk returns an empty (all air) chunk.
+func NewChunk(pos ChunkPos) *Chunk {
+	return &Chunk{Pos: pos}
+}
+
+func index(x, y, z int) int {
+	return (y*ChunkSize+z)*ChunkSize + x
+}
+
+// Get returns the block type at local coordinates x, y, z.
+func (c *Chunk) Get(x, y, z int) int {
+	return c.blocks.Get(index(x, y, z))
+}
+
+// Set stores the block type at local coordinates x, y, z.
+func (c *Chunk) Set(x, y, z, id int) {
+	c.blocks.Set(index(x, y, z), id)
+}
+
+// Empty reports whether the chunk only contains air.
+func (c *Chunk) Empty() bool {
+	return c.blocks.Count() == 0
+}
+
+// Count returns the number of non-air blocks in the chunk.
+func (c *Chunk) Count() int {
+	return c.blocks.Count()
+}
+
+// Each calls fn for every non-air block in the chunk, with world positions.
+func (c *Chunk) Each(fn func(pos BlockPos, id int)) {
+	if c.blocks.Count() == 0 {
+		return
+	}
+	o := c.Pos.Origin()
+	for y := 0; y < ChunkSize; y++ {
+		for z := 0; z < ChunkSize; z++ {
+			for x := 0; x < ChunkSize; x++ {
+				id := c.blocks.Get(index(x, y, z))
+				if id != Air {
+					fn(BlockPos{o.X + x, o.Y + y, o.Z + z}, id)
+				}
+			}
+		}
+	}
+}
+
+// Blocks returns the storage of the chunk's blocks, indexed by
+// (y*ChunkSize+z)*ChunkSize+x.
+func (c *Chunk) Blocks() *Section {
+	return &c.blocks
+}
+
+// World is a sparse set of chunks. Chunks are created on first write.
+//
+// The world also tracks which chunks changed since the last call to
+// TakeDirty, so their meshes can be rebuilt, and which chunks were edited
+// with SetBlock since they were installed, so they can be saved.
+type World struct {
+	chunks  map[ChunkPos]*Chunk
+	dirty   map[ChunkPos]bool
+	changed map[ChunkPos]bool
+}
+
+// New returns an empty world.
+func New() *World {
+	return &World{
+		chunks:  make(map[ChunkPos]*Chunk),
+		dirty:   make(map[ChunkPos]bool),
+		changed: make(map[ChunkPos]bool),
+	}
+}
+
+// GetBlock returns the block type at p, or Air if nothing is there.
+func (w *World) GetBlock(p BlockPos) int {
+	c := w.chunks[ChunkPosOf(p)]
+	if c == nil {
+		return Air
+	}
+	x, y, z := Local(p)
+	return c.Get(x, y, z)
+}
+
+// HasBlock reports whether there is a non-air block at p.
+func (w *World) HasBlock(p BlockPos) bool {
+	return w.GetBlock(p) != Air
+}
+
+// SetBlock stores a block type at p. Setting Air removes the block.
+func (w *World) SetBlock(p BlockPos, id int) {
+	cp := ChunkPosOf(p)
+	c := w.chunks[cp]
+	if c == nil {
+		if id == Air {
+			return
+		}
+		c = NewChunk(cp)
+		w.chunks[cp] = c
+	}
+	x, y, z := Local(p)
+	if c.Get(x, y, z) == id {
+		return
+	}
+	c.Set(x, y, z, id)
+	w.changed[cp] = true
+	w.markDirty(cp, x, y, z)
+}
+
+// markDirty flags the chunk and, for blocks on its border, the neighbour
+// whose faces may now be hidden or exposed.
+func (w *World) markDirty(cp ChunkPos, x, y, z int) {
+	w.dirty[cp] = true
+	for _, n := range []struct {
+		local, dx, dy, dz int
+	}{
+		{x, -1, 0, 0}, {y, 0, -1, 0}, {z, 0, 0, -1},
+	} {
+		if n.local == 0 {
+			w.dirty[cp.Add(n.dx, n.dy, n.dz)] = true
+		} else if n.local == ChunkSize-1 {
+			w.dirty[cp.Add(-n.dx, -n.dy, -n.dz)] = true
+		}
+	}
+}
+
+// TakeDirty returns the chunks modified since the previous call and clears
+// the list. Positions of chunks that do not exist may be included, meaning
+// their mesh (if any) should be dropped.
+func (w *World) TakeDirty() []ChunkPos {
+	list := make([]ChunkPos, 0, len(w.dirty))
+	for cp := range w.dirty {
+		list = append(list, cp)
+	}
+	clear(w.dirty)
+	return list
+}
+
+// SetChunk installs a whole chunk, replacing any chunk at the same position.
+// The chunk and its six neighbours are marked dirty.
+func (w *World) SetChunk(c *Chunk) {
+	w.chunks[c.Pos] = c
+	delete(w.changed, c.Pos)
+	w.dirty[c.Pos] = true
+	for _, d := range [][3]int{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}} {
+		w.dirty[c.Pos.Add(d[0], d[1], d[2])] = true
+	}
+}
+
+// TakeChanged returns the chunks edited with SetBlock since they were
+// installed or since the previous call, and clears the list.
+func (w *World) TakeChanged() []*Chunk {
+	list := make([]*Chunk, 0, len(w.changed))
+	for cp := range w.changed {
+		if c := w.chunks[cp]; c != nil {
+			list = append(list, c)
+		}
+	}
+	clear(w.changed)
+	return list
+}
+
+// RemoveChunk unloads the chunk at cp and returns it, or nil if there was
+// none. changed reports whether it was edited since it was installed, in
+// which case the caller should save it. The position is marked dirty so its
+// mesh is dropped.
+func (w *World) RemoveChunk(cp ChunkPos) (c *Chunk, changed bool) {
+	c = w.chunks[cp]
+	if c == nil {
+		return nil, false
+	}
+	changed = w.changed[cp]
+	delete(w.chunks, cp)
+	delete(w.changed, cp)
+	w.dirty[cp] = true
+	return c, changed
+}
+
+// ChunkAt returns the chunk at cp, or nil if it does not exist.
+func (w *World) ChunkAt(cp ChunkPos) *Chunk {
+	return w.chunks[cp]
+}
+
+// Chunks returns every loaded chunk, in no particular order.
+func (w *World) Chunks() []*Chunk {
+	list := make([]*Chunk, 0, len(w.chunks))
+	for _, c := range w.chunks {
+		list = append(list, c)
+	}
+	return list
+}
+
+// ForEachBlock calls fn for every non-air block in the world.
+func (w *World) ForEachBlock(fn func(pos BlockPos, id int)) {
+	for _, c := range w.chunks {
+		c.Each(fn)
+	}
+}
@@ -0,0 +1,214 @@
+package world
+
+import "testing"
+
+func TestChunkPosOf(t *testing.T) {
+	cases := []struct {
+		pos  BlockPos
+		want ChunkPos
+	}{
+		{BlockPos{0, 0, 0}, ChunkPos{0, 0, 0}},
+		{BlockPos{15, 15, 15}, ChunkPos{0, 0, 0}},
+		{BlockPos{16, 0, 0}, ChunkPos{1, 0, 0}},
+		{BlockPos{-1, -1, -1}, ChunkPos{-1, -1, -1}},
+		{BlockPos{-16, 0, -17}, ChunkPos{-1, 0, -2}},
+		{BlockPos{-50, -5, 50}, ChunkPos{-4, -1, 3}},
+	}
+	for _, c := range cases {
+		if got := ChunkPosOf(c.pos); got != c.want {
+			t.Errorf("ChunkPosOf(%v) = %v, want %v", c.pos, got, c.want)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	x, y, z := Local(BlockPos{-1, 17, -16})
+	if x != 15 || y != 1 || z != 0 {
+		t.Errorf("Local = %d,%d,%d, want 15,1,0", x, y, z)
+	}
+}
+
+func TestGetSetBlock(t *testing.T) {
+	w := New()
+
+	positions := []BlockPos{
+		{0, 0, 0}, {-1, 0, 0}, {15, 15, 15}, {16, 16, 16}, {-50, -5, 50},
+	}
+	for i, p := range positions {
+		w.SetBlock(p, i+1)
+	}
+	for i, p := range positions {
+		if got := w.GetBlock(p); got != i+1 {
+			t.Errorf("GetBlock(%v) = %d, want %d", p, got, i+1)
+		}
+	}
+
+	if got := w.GetBlock(BlockPos{1, 0, 0}); got != Air {
+		t.Errorf("GetBlock on empty cell = %d, want Air", got)
+	}
+	if got := w.GetBlock(BlockPos{1000, 0, 0}); got != Air {
+		t.Errorf("GetBlock on missing chunk = %d, want Air", got)
+	}
+
+	w.SetBlock(BlockPos{-1, 0, 0}, Air)
+	if w.HasBlock(BlockPos{-1, 0, 0}) {
+		t.Errorf("block still present after setting Air")
+	}
+}
+
+func TestChunkAt(t *testing.T) {
+	w := New()
+	if w.ChunkAt(ChunkPos{0, 0, 0}) != nil {
+		t.Fatalf("expected no chunk in empty world")
+	}
+
+	w.SetBlock(BlockPos{-1, 0, 0}, Air)
+	if w.ChunkAt(ChunkPos{-1, 0, 0}) != nil {
+		t.Errorf("setting Air must not create a chunk")
+	}
+
+	w.SetBlock(BlockPos{17, 2, 3}, 4)
+	c := w.ChunkAt(ChunkPos{1, 0, 0})
+	if c == nil {
+		t.Fatalf("expected chunk to be created")
+	}
+	if got := c.Get(1, 2, 3); got != 4 {
+		t.Errorf("chunk.Get = %d, want 4", got)
+	}
+	if c.Count() != 1 {
+		t.Errorf("chunk.Count = %d, want 1", c.Count())
+	}
+
+	w.SetBlock(BlockPos{17, 2, 3}, 2)
+	if c.Count() != 1 {
+		t.Errorf("overwriting must not change count, got %d", c.Count())
+	}
+	w.SetBlock(BlockPos{17, 2, 3}, Air)
+	if !c.Empty() {
+		t.Errorf("chunk should be empty")
+	}
+}
+
+func TestForEachBlock(t *testing.T) {
+	w := New()
+	want := map[BlockPos]int{
+		{0, 0, 0}:    1,
+		{-20, 3, 9}:  2,
+		{31, -1, 16}: 3,
+	}
+	for p, id := range want {
+		w.SetBlock(p, id)
+	}
+
+	got := map[BlockPos]int{}
+	w.ForEachBlock(func(p BlockPos, id int) {
+		got[p] = id
+	})
+	if len(got) != len(want) {
+		t.Fatalf("visited %d blocks, want %d", len(got), len(want))
+	}
+	for p, id := range want {
+		if got[p] != id {
+			t.Errorf("block %v = %d, want %d", p, got[p], id)
+		}
+	}
+}
+
+func TestTakeDirty(t *testing.T) {
+	w := New()
+	w.SetBlock(BlockPos{5, 5, 5}, 1)
+	assertDirty(t, w.TakeDirty(), ChunkPos{0, 0, 0})
+	assertDirty(t, w.TakeDirty())
+
+	// Same value again is not a change
+	w.SetBlock(BlockPos{5, 5, 5}, 1)
+	assertDirty(t, w.TakeDirty())
+
+	// Border blocks also dirty the neighbour sharing that face
+	w.SetBlock(BlockPos{0, 5, 15}, 2)
+	assertDirty(t, w.TakeDirty(), ChunkPos{0, 0, 0}, ChunkPos{-1, 0, 0}, ChunkPos{0, 0, 1})
+
+	w.SetBlock(BlockPos{-1, -16, 3}, 2)
+	assertDirty(t, w.TakeDirty(), ChunkPos{-1, -1, 0}, ChunkPos{0, -1, 0}, ChunkPos{-1, -2, 0})
+}
+
+func assertDirty(t *testing.T, got []ChunkPos, want ...ChunkPos) {
+	t.Helper()
+	set := map[ChunkPos]bool{}
+	for _, cp := range got {
+		set[cp] = true
+	}
+	if len(set) != len(want) || len(got) != len(want) {
+		t.Fatalf("dirty = %v, want %v", got, want)
+	}
+	for _, cp := range want {
+		if !set[cp] {
+			t.Fatalf("dirty = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSetChunk(t *testing.T) {
+	w := New()
+	c := NewChunk(ChunkPos{1, -1, 0})
+	c.Set(0, 15, 0, 3)
+	w.SetChunk(c)
+
+	if got := w.GetBlock(BlockPos{16, -1, 0}); got != 3 {
+		t.Errorf("GetBlock = %d, want 3", got)
+	}
+	if len(w.TakeDirty()) != 7 {
+		t.Errorf("SetChunk must dirty the chunk and its six neighbours")
+	}
+}
+
+func TestRemoveChunk(t *testing.T) {
+	w := New()
+	w.SetChunk(NewChunk(ChunkPos{0, 0, 0}))
+	w.SetChunk(NewChunk(ChunkPos{1, 0, 0}))
+	w.SetBlock(BlockPos{17, 2, 3}, 4)
+	w.TakeDirty()
+
+	if c, changed := w.RemoveChunk(ChunkPos{0, 0, 0}); c == nil || changed {
+		t.Errorf("RemoveChunk of an untouched chunk = %v, %v", c, changed)
+	}
+	if c, changed := w.RemoveChunk(ChunkPos{1, 0, 0}); c == nil || !changed || c.Get(1, 2, 3) != 4 {
+		t.Errorf("RemoveChunk of an edited chunk = %v, %v", c, changed)
+	}
+	if c, _ := w.RemoveChunk(ChunkPos{5, 0, 0}); c != nil {
+		t.Errorf("RemoveChunk of a missing chunk = %v", c)
+	}
+	if w.ChunkAt(ChunkPos{1, 0, 0}) != nil || w.HasBlock(BlockPos{17, 2, 3}) {
+		t.Errorf("chunk still loaded after RemoveChunk")
+	}
+	assertDirty(t, w.TakeDirty(), ChunkPos{0, 0, 0}, ChunkPos{1, 0, 0})
+
+	// Installing a chunk again starts with no edits
+	w.SetBlock(BlockPos{17, 2, 3}, 4)
+	w.SetChunk(NewChunk(ChunkPos{1, 0, 0}))
+	if _, changed := w.RemoveChunk(ChunkPos{1, 0, 0}); changed {
+		t.Errorf("SetChunk must clear the edited flag")
+	}
+}
+
+func TestTakeChanged(t *testing.T) {
+	w := New()
+	w.SetChunk(NewChunk(ChunkPos{0, 0, 0}))
+	if len(w.TakeChanged()) != 0 {
+		t.Errorf("installed chunks must not count as changed")
+	}
+
+	w.SetBlock(BlockPos{1, 1, 1}, 2)
+	w.SetBlock(BlockPos{2, 1, 1}, 2)
+	w.SetBlock(BlockPos{-5, 1, 1}, 3)
+	changed := w.TakeChanged()
+	if len(changed) != 2 {
+		t.Fatalf("TakeChanged returned %d chunks, want 2", len(changed))
+	}
+	if len(w.TakeChanged()) != 0 {
+		t.Errorf("TakeChanged must clear the list")
+	}
+	if _, edited := w.RemoveChunk(ChunkPos{0, 0, 0}); edited {
+		t.Errorf("chunk still edited after TakeChanged")
+	}
+}
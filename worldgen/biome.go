@@ -0,0 +1,177 @@
+package worldgen
+
+import (
+	"math"
+
+	"craft3d/noise"
+)
+
+// Biome describes one kind of landscape: which blocks cover it, how its
+// terrain is shaped and how grass and water are coloured.
+type Biome struct {
+	Name string
+
+	Surface  string // Block on top of the ground
+	Filler   string // Block under the surface, dirtDepth deep
+	SnowLine int    // Surface turns to snow from this height up, 0 for never
+
+	HeightOffset float64 // Added to the base height
+	Roughness    float64 // Amplitude of the small hills
+
+	Decoration float64 // Scales the chance of every prefab, 1 as blueprints say
+
+	GrassTint [4]float32
+	WaterTint [4]float32
+
+	// Climate the biome prefers, for land biomes picked by temperature and
+	// humidity (both -1..1)
+	temperature, humidity float64
+}
+
+// The biomes, in a fixed order used as index in Sample.Weights.
+var (
+	Plains = &Biome{
+		Name: "plains", Surface: "grass", Filler: "dirt",
+		HeightOffset: 0, Roughness: 1, Decoration: 1,
+		GrassTint:   [4]float32{1, 1, 1, 1},
+		WaterTint:   [4]float32{1, 1, 1, 1},
+		temperature: 0.1, humidity: -0.1,
+	}
+	Desert = &Biome{
+		Name: "desert", Surface: "sand", Filler: "sand",
+		HeightOffset: 1, Roughness: 2.5, Decoration: 0.5,
+		GrassTint:   [4]float32{1, 0.95, 0.7, 1},
+		WaterTint:   [4]float32{0.9, 1, 0.95, 1},
+		temperature: 0.75, humidity: -0.6,
+	}
+	Forest = &Biome{
+		Name: "forest", Surface: "grass", Filler: "dirt",
+		HeightOffset: 2, Roughness: 3, Decoration: 1.5,
+		GrassTint:   [4]float32{0.75, 0.95, 0.75, 1},
+		WaterTint:   [4]float32{0.85, 1, 0.9, 1},
+		temperature: 0.25, humidity: 0.6,
+	}
+	Tundra = &Biome{
+		Name: "tundra", Surface: "snow", Filler: "dirt",
+		HeightOffset: 1, Roughness: 1.5, Decoration: 0.75,
+		GrassTint:   [4]float32{0.85, 0.95, 1, 1},
+		WaterTint:   [4]float32{0.8, 0.9, 1, 1},
+		temperature: -0.7, humidity: 0,
+	}
+	Ocean = &Biome{
+		Name: "ocean", Surface: "sand", Filler: "sand",
+		HeightOffset: -5, Roughness: 1, Decoration: 0.5,
+		GrassTint: [4]float32{1, 1, 1, 1},
+		WaterTint: [4]float32{0.8, 0.9, 1, 1},
+	}
+	Mountains = &Biome{
+		Name: "mountains", Surface: "rock", Filler: "rock", SnowLine: 34,
+		HeightOffset: 4, Roughness: 3, Decoration: 0.75,
+		GrassTint: [4]float32{0.85, 0.95, 0.85, 1},
+		WaterTint: [4]float32{0.85, 0.95, 1, 1},
+	}
+
+	Biomes = []*Biome{Plains, Desert, Forest, Tundra, Ocean, Mountains}
+
+	landBiomes = []*Biome{Plains, Desert, Forest, Tundra}
+)
+
+// BiomeNames returns the names of Biomes, for checking the biomes prefabs
+// name.
+func BiomeNames() []string {
+	names := make([]string, len(Biomes))
+	for i, b := range Biomes {
+		names[i] = b.Name
+	}
+	return names
+}
+
+// BiomeSource is implemented by generators that have biomes.
+type BiomeSource interface {
+	// BiomeAt returns the main biome of column x, z.
+	BiomeAt(seed int64, x, z int) *Biome
+	// TintAt returns the grass and water colours at x, z, blended between
+	// neighbouring biomes.
+	TintAt(seed int64, x, z int) (grass, water [4]float32)
+}
+
+// Climate noise, much lower frequency than the terrain itself.
+var climateFractal = noise.Fractal{Octaves: 3, Frequency: 1.0 / 1024, Lacunarity: 2, Gain: 0.5}
+
+// Sample is everything the terrain needs to know about one column.
+type Sample struct {
+	Height  int
+	Biome   *Biome    // Biome with the highest weight
+	Weights []float64 // Influence of each biome, same order as Biomes, sum 1
+}
+
+// biomeWeights spreads a column between biomes. Oceans follow low
+// continentalness, mountains the mountain mask, and the land left goes to
+// the land biomes closest to the local temperature and humidity. Every
+// input is smooth noise, so weights (and the height and colours blended
+// from them) change gradually across borders.
+func biomeWeights(continent, mountain, temperature, humidity float64) []float64 {
+	weights := make([]float64, len(Biomes))
+
+	ocean := smoothstep(-0.05, -0.35, continent)
+	mountain *= 1 - ocean
+	land := 1 - ocean - mountain
+
+	const spread = 0.08 // Width of the transition in climate space
+	total := 0.0
+	climate := make([]float64, len(landBiomes))
+	for i, b := range landBiomes {
+		dt, dh := temperature-b.temperature, humidity-b.humidity
+		climate[i] = math.Exp(-(dt*dt + dh*dh) / spread)
+		total += climate[i]
+	}
+	for i, b := range landBiomes {
+		weights[biomeIndex(b)] = land * climate[i] / total
+	}
+	weights[biomeIndex(Ocean)] = ocean
+	weights[biomeIndex(Mountains)] = mountain
+	return weights
+}
+
+func biomeIndex(b *Biome) int {
+	for i, o := range Biomes {
+		if o == b {
+			return i
+		}
+	}
+	panic("worldgen: unknown biome " + b.Name)
+}
+
+// dominant returns the biome with the highest weight.
+func dominant(weights []float64) *Biome {
+	best := 0
+	for i, w := range weights {
+		if w > weights[best] {
+			best = i
+		}
+	}
+	return Biomes[best]
+}
+
+// blend mixes a per-biome value by weight.
+func blend(weights []float64, value func(b *Biome) float64) float64 {
+	v := 0.0
+	for i, w := range weights {
+		if w > 0 {
+			v += w * value(Biomes[i])
+		}
+	}
+	return v
+}
+
+// blendTint mixes a per-biome colour by weight.
+func blendTint(weights []float64, tint func(b *Biome) [4]float32) [4]float32 {
+	var c [4]float32
+	for i, w := range weights {
+		t := tint(Biomes[i])
+		for k := range c {
+			c[k] += float32(w) * t[k]
+		}
+	}
+	return c
+}
@@ -0,0 +1,96 @@
+package worldgen
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBiomeWeights(t *testing.T) {
+	cases := []struct {
+		continent, mountain, temperature, humidity float64
+		want                                       *Biome
+	}{
+		{-0.6, 0, 0, 0, Ocean},
+		{0.3, 1, 0, 0, Mountains},
+		{0.3, 0, 0.8, -0.7, Desert},
+		{0.3, 0, 0.2, 0.7, Forest},
+		{0.3, 0, -0.8, 0, Tundra},
+		{0.3, 0, 0.1, -0.1, Plains},
+	}
+	for _, c := range cases {
+		w := biomeWeights(c.continent, c.mountain, c.temperature, c.humidity)
+		sum := 0.0
+		for _, v := range w {
+			if v < 0 {
+				t.Errorf("negative weight %v", w)
+			}
+			sum += v
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("weights %v sum to %v", w, sum)
+		}
+		if got := dominant(w); got != c.want {
+			t.Errorf("%+v: biome %s, want %s", c, got.Name, c.want.Name)
+		}
+	}
+}
+
+func TestEveryBiomeAppears(t *testing.T) {
+	hm := NewHeightMap(5)
+	seen := map[*Biome]int{}
+	for x := -4096; x < 4096; x += 32 {
+		for z := -4096; z < 4096; z += 32 {
+			seen[hm.Sample(x, z).Biome]++
+		}
+	}
+	for _, b := range Biomes {
+		if seen[b] == 0 {
+			t.Errorf("biome %s never appears", b.Name)
+		}
+	}
+	t.Logf("biome columns: %v", func() map[string]int {
+		m := map[string]int{}
+		for b, n := range seen {
+			m[b.Name] = n
+		}
+		return m
+	}())
+}
+
+func TestBiomeBlending(t *testing.T) {
+	// Neighbouring columns never jump from one biome's parameters to
+	// another's: weights change a little at a time, so a border is always
+	// several blocks wide
+	hm := NewHeightMap(5)
+	z := 0
+	prev := hm.Sample(-2048, z)
+	for x := -2047; x < 2048; x++ {
+		s := hm.Sample(x, z)
+		for i := range s.Weights {
+			if d := math.Abs(s.Weights[i] - prev.Weights[i]); d > 0.15 {
+				t.Fatalf("weight of %s jumps by %.2f between x=%d and x=%d", Biomes[i].Name, d, x-1, x)
+			}
+		}
+		prev = s
+	}
+}
+
+func TestBiomeSource(t *testing.T) {
+	g, err := New("noise", testRegistry(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, ok := g.(BiomeSource)
+	if !ok {
+		t.Fatalf("noise generator does not report biomes")
+	}
+	if src.BiomeAt(3, 100, -200) != NewHeightMap(3).Sample(100, -200).Biome {
+		t.Errorf("BiomeAt does not match the terrain")
+	}
+	grass, water := src.TintAt(3, 100, -200)
+	for k := 0; k < 4; k++ {
+		if grass[k] <= 0 || grass[k] > 1 || water[k] <= 0 || water[k] > 1 {
+			t.Fatalf("tint out of range: %v %v", grass, water)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package worldgen
+
+import (
+	"math"
+
+	"craft3d/noise"
+	"craft3d/world"
+)
+
+// Cave layout.
+const (
+	floorDepth    = 3    // Layers at the bottom of the world that are never carved
+	caveRoof      = 6    // Noise caves stay this many blocks below the surface, see Overhangs
+	caveThreshold = 0.38 // Noise above this is carved
+	wormCell      = 64   // Worms start in square cells of this many blocks
+	wormsPerCell  = 3    // At most
+	wormSteps     = 96   // Longest worm, in one block steps
+	wormRadius    = 3.5  // Largest tunnel radius
+)
+
+// Noise cave chambers, squashed vertically so they are wider than tall.
+var (
+	caveFractal = noise.Fractal{Octaves: 3, Frequency: 1.0 / 48, Lacunarity: 2, Gain: 0.5}
+	caveSquash  = 1.6
+)
+
+// Near the surface, 3D noise reshapes the ground where a low frequency mask
+// allows it. overhangBand is how far above and below the surface.
+const overhangBand = 10
+
+var (
+	overhangFractal = noise.Fractal{Octaves: 2, Frequency: 1.0 / 12, Lacunarity: 2, Gain: 0.5}
+	overhangMask    = noise.Fractal{Octaves: 2, Frequency: 1.0 / 200, Lacunarity: 2, Gain: 0.5}
+	overhangSquash  = 1.5 // Faster changes up and down make more overhangs
+)
+
+// Caves carves underground space out of solid terrain, and shapes arches
+// and overhangs near the surface.
+//
+// Chambers come from 3D fBm: blocks where the noise is above a threshold
+// are hollow. Near the surface, 3D noise is thresholded against the height
+// above the surface instead, see Solid. Worms are tunnels that follow a
+// random walk. Each worm starts in a cell of the world and its path only
+// depends on the seed and the cell, so a chunk finds every worm that can
+// reach it by walking the nearby cells, and tunnels line up across chunk
+// borders in any generation order.
+//
+// A Caves keeps the worms it walked, and is not safe for concurrent use.
+type Caves struct {
+	seed        int64
+	density     *noise.Simplex
+	shape, mask *noise.Simplex // Of the ground near the surface
+
+	cells map[[2]int][][]wormPoint // Worms by cell, see worms
+}
+
+// NewCaves creates the cave noise for seed.
+func NewCaves(seed int64) *Caves {
+	return &Caves{
+		seed:    subSeed(seed, 8),
+		density: noise.NewSimplex(subSeed(seed, 9)),
+		shape:   noise.NewSimplex(subSeed(seed, 12)),
+		mask:    noise.NewSimplex(subSeed(seed, 13)),
+	}
+}
+
+// Overhangs returns how strongly the ground of column x, z is reshaped
+// near the surface, from 0 for not at all to 1.
+func (cv *Caves) Overhangs(x, z int) float64 {
+	return smoothstep(0.1, 0.35, overhangMask.FBM2(cv.mask, float64(x), float64(z)))
+}
+
+// Solid reports whether block x, y, z is ground, in a column whose surface
+// is at height and reshaped with strength (see Overhangs). The ground gets
+// less likely the higher above the surface a block is, and the noise moves
+// that boundary up and down by up to strength times overhangBand, so where
+// it grows faster than the height the ground leans out over air: arches and
+// overhangs, and hollows under them.
+func (cv *Caves) Solid(x, y, z, height int, strength float64) bool {
+	if strength == 0 || y <= height-overhangBand || y >= height+overhangBand {
+		return y <= height
+	}
+	d := (float64(height-y) + 0.5) / overhangBand
+	n := overhangFractal.FBM3(cv.shape, float64(x), float64(y)*overhangSquash, float64(z))
+	return d+strength*n > 0
+}
+
+// Chamber reports whether noise caves hollow out block x, y, z.
+func (cv *Caves) Chamber(x, y, z int) bool {
+	n := caveFractal.FBM3(cv.density, float64(x), float64(y)*caveSquash, float64(z))
+	return n > caveThreshold
+}
+
+// wormPoint is one step of a worm: the centre and radius of a sphere.
+type wormPoint struct {
+	x, y, z, r float64
+}
+
+// worms returns the tunnels that start in worm cell cx, cz.
+func (cv *Caves) worms(cx, cz int) [][]wormPoint {
+	if w, ok := cv.cells[[2]int{cx, cz}]; ok {
+		return w
+	}
+	if cv.cells == nil {
+		cv.cells = make(map[[2]int][][]wormPoint)
+	}
+	w := cv.walk(cx, cz)
+	cv.cells[[2]int{cx, cz}] = w
+	return w
+}
+
+// walk follows the tunnels that start in worm cell cx, cz.
+func (cv *Caves) walk(cx, cz int) [][]wormPoint {
+	r := newRNG(cv.seed, cx, cz)
+	count := int(r.float() * (wormsPerCell + 1))
+	worms := make([][]wormPoint, 0, count)
+	for i := 0; i < count; i++ {
+		x := float64(cx*wormCell) + r.float()*wormCell
+		z := float64(cz*wormCell) + r.float()*wormCell
+		y := float64(bottomY+floorDepth+8) + r.float()*float64(24-bottomY-floorDepth-8)
+		yaw := r.float() * 2 * math.Pi
+		pitch := (r.float() - 0.5) * 0.5
+		turn := 0.0
+		base := 1.2 + r.float()*1.5 // Middle radius is 1.2x this
+		steps := wormSteps/2 + int(r.float()*wormSteps/2)
+
+		points := make([]wormPoint, 0, steps)
+		for s := 0; s < steps; s++ {
+			// Thin at both ends, widest in the middle
+			t := float64(s) / float64(steps)
+			points = append(points, wormPoint{x, y, z, base * (0.6 + 0.6*math.Sin(t*math.Pi))})
+
+			x += math.Cos(pitch) * math.Cos(yaw)
+			y += math.Sin(pitch)
+			z += math.Cos(pitch) * math.Sin(yaw)
+			turn = turn*0.8 + (r.float()-0.5)*0.3
+			yaw += turn
+			pitch = pitch*0.8 + (r.float()-0.5)*0.3
+		}
+		worms = append(worms, points)
+	}
+	return worms
+}
+
+// EachWormBlock calls fn with the local position of every block of chunk cp
+// that is inside a worm tunnel. Blocks may be reported more than once.
+func (cv *Caves) EachWormBlock(cp world.ChunkPos, fn func(x, y, z int)) {
+	o := cp.Origin()
+	const reach = wormSteps + wormRadius + 1
+	minCX := floorDiv(int(float64(o.X)-reach), wormCell)
+	maxCX := floorDiv(int(float64(o.X+world.ChunkSize)+reach), wormCell)
+	minCZ := floorDiv(int(float64(o.Z)-reach), wormCell)
+	maxCZ := floorDiv(int(float64(o.Z+world.ChunkSize)+reach), wormCell)
+
+	for cx := minCX; cx <= maxCX; cx++ {
+		for cz := minCZ; cz <= maxCZ; cz++ {
+			for _, worm := range cv.worms(cx, cz) {
+				for _, p := range worm {
+					carveSphere(o, p, fn)
+				}
+			}
+		}
+	}
+}
+
+// InWorm reports whether block x, y, z is inside a worm tunnel.
+func (cv *Caves) InWorm(x, y, z int) bool {
+	const reach = wormSteps + wormRadius + 1
+	for cx := floorDiv(int(float64(x)-reach), wormCell); cx <= floorDiv(int(float64(x)+reach), wormCell); cx++ {
+		for cz := floorDiv(int(float64(z)-reach), wormCell); cz <= floorDiv(int(float64(z)+reach), wormCell); cz++ {
+			for _, worm := range cv.worms(cx, cz) {
+				for _, p := range worm {
+					dx, dy, dz := float64(x)-p.x, float64(y)-p.y, float64(z)-p.z
+					if dx*dx+dy*dy+dz*dz <= p.r*p.r {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// carveSphere reports the blocks of the chunk at origin o within the sphere.
+func carveSphere(o world.BlockPos, p wormPoint, fn func(x, y, z int)) {
+	x0 := max(int(math.Ceil(p.x-p.r))-o.X, 0)
+	x1 := min(int(math.Floor(p.x+p.r))-o.X, world.ChunkSize-1)
+	y0 := max(int(math.Ceil(p.y-p.r))-o.Y, 0)
+	y1 := min(int(math.Floor(p.y+p.r))-o.Y, world.ChunkSize-1)
+	z0 := max(int(math.Ceil(p.z-p.r))-o.Z, 0)
+	z1 := min(int(math.Floor(p.z+p.r))-o.Z, world.ChunkSize-1)
+	r2 := p.r * p.r
+	for y := y0; y <= y1; y++ {
+		for z := z0; z <= z1; z++ {
+			for x := x0; x <= x1; x++ {
+				dx := float64(o.X+x) - p.x
+				dy := float64(o.Y+y) - p.y
+				dz := float64(o.Z+z) - p.z
+				if dx*dx+dy*dy+dz*dz <= r2 {
+					fn(x, y, z)
+				}
+			}
+		}
+	}
+}
+
+// rng is a small deterministic random number generator for one cell of the
+// world, or any other list of integers.
+type rng uint64
+
+func newRNG(seed int64, coords ...int) *rng {
+	state := uint64(seed)
+	for _, v := range coords {
+		state ^= uint64(v)
+		state = noise.SplitMix64(&state)
+	}
+	r := rng(state)
+	return &r
+}
+
+// float returns a number in [0, 1).
+func (r *rng) float() float64 {
+	return float64(noise.SplitMix64((*uint64)(r))>>11) / (1 << 53)
+}
+
+func floorDiv(v, d int) int {
+	q := v / d
+	if v%d != 0 && v < 0 {
+		q--
+	}
+	return q
+}
@@ -0,0 +1,167 @@
+package worldgen
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"craft3d/world"
+)
+
+func TestCaveFloorAndWater(t *testing.T) {
+	reg := testRegistry(t)
+	g, err := New("noise", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	water := reg.ID("water")
+
+	hollow := 0
+	for cx := -2; cx < 2; cx++ {
+		for cz := -2; cz < 2; cz++ {
+			for cy := MinChunkY; cy < 0; cy++ {
+				c := g.GenerateChunk(7, world.ChunkPos{X: cx, Y: cy, Z: cz})
+				o := c.Pos.Origin()
+				for y := 0; y < world.ChunkSize; y++ {
+					for z := 0; z < world.ChunkSize; z++ {
+						for x := 0; x < world.ChunkSize; x++ {
+							id := c.Get(x, y, z)
+							switch {
+							case o.Y+y < bottomY+floorDepth && (id == world.Air || id == water):
+								t.Fatalf("floor block %v is not solid", world.BlockPos{X: o.X + x, Y: o.Y + y, Z: o.Z + z})
+							case o.Y+y <= WaterLevel && id == world.Air:
+								t.Fatalf("dry cave at %v below the water level", world.BlockPos{X: o.X + x, Y: o.Y + y, Z: o.Z + z})
+							case o.Y+y < bottomY+40 && id == water:
+								hollow++ // Deep underground, so this is a cave
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	if hollow == 0 {
+		t.Errorf("no caves were carved")
+	}
+}
+
+func TestWormsCrossChunks(t *testing.T) {
+	reg := testRegistry(t)
+	g, err := New("noise", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	water := reg.ID("water")
+	const seed = 3
+	cv := NewCaves(seed)
+
+	// Find worm spheres that straddle a chunk border on the X axis, deep
+	// enough to be underground, and check the blocks on both sides
+	checked := 0
+	for cx := -2; cx <= 2 && checked < 20; cx++ {
+		for cz := -2; cz <= 2 && checked < 20; cz++ {
+			for _, worm := range cv.worms(cx, cz) {
+				for _, p := range worm {
+					x := int(math.Floor(p.x))
+					if p.r < 1.5 || p.y > -20 || p.y < float64(bottomY+floorDepth+2) || floorMod(x, world.ChunkSize) != world.ChunkSize-1 {
+						continue
+					}
+					y, z := int(math.Round(p.y)), int(math.Round(p.z))
+					for _, bx := range []int{x, x + 1} {
+						pos := world.BlockPos{X: bx, Y: y, Z: z}
+						cp := world.ChunkPosOf(pos)
+						lx, ly, lz := world.Local(pos)
+						if id := g.GenerateChunk(seed, cp).Get(lx, ly, lz); id != water {
+							t.Errorf("block %v inside a worm is %d, want water", pos, id)
+						}
+					}
+					checked++
+				}
+			}
+		}
+	}
+	if checked == 0 {
+		t.Fatalf("no worm crosses a chunk border")
+	}
+}
+
+func TestSlice(t *testing.T) {
+	g, err := New("noise", testRegistry(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	red := color.RGBA{255, 0, 0, 255}
+	img := Slice(g, 0, 5, -20, 20, func(int) color.RGBA { return red })
+
+	size := img.Bounds().Size()
+	if want := (MaxChunkY - MinChunkY + 1) * world.ChunkSize; size.X != 40 || size.Y != want {
+		t.Fatalf("slice size = %v, want 40x%d", size, want)
+	}
+	for x := 0; x < size.X; x++ {
+		if img.RGBAAt(x, size.Y-1) != red {
+			t.Errorf("bottom pixel %d is empty", x)
+		}
+		if img.RGBAAt(x, 0) != (color.RGBA{}) {
+			t.Errorf("top pixel %d is not air", x)
+		}
+	}
+}
+
+func TestOverhangs(t *testing.T) {
+	g, err := New("noise", testRegistry(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const seed = 42
+	hm, cv := NewHeightMap(seed), NewCaves(seed)
+	z := 0
+	for cv.Overhangs(0, z) < 0.9 {
+		if z++; z > 1000 {
+			t.Fatal("no reshaped ground near the origin")
+		}
+	}
+
+	// In some columns ground rises above the height map surface over air,
+	// which is over ground again
+	ground := color.RGBA{255, 0, 0, 255}
+	img := Slice(g, seed, z, -64, 64, func(int) color.RGBA { return ground })
+	top := img.Bounds().Dy() + bottomY - 1 // y of the first row
+	overhangs := 0
+	for x := -64; x < 64; x++ {
+		h := hm.Height(x, z)
+		floor, air := false, false
+		for y := h - overhangBand; y < h+overhangBand; y++ {
+			solid := img.RGBAAt(x+64, top-y) == ground
+			if solid && air && y > h {
+				overhangs++
+				break
+			}
+			floor = floor || solid
+			air = air || floor && !solid
+		}
+	}
+	if overhangs == 0 {
+		t.Errorf("no ground over air above the surface along z=%d", z)
+	}
+	t.Logf("%d columns with overhangs along z=%d", overhangs, z)
+}
+
+func TestNoOverhangsUnmasked(t *testing.T) {
+	cv := NewCaves(1)
+	for x := -200; x < 200; x += 7 {
+		for z := -200; z < 200; z += 7 {
+			if cv.Overhangs(x, z) > 0 {
+				continue
+			}
+			for y := -20; y < 40; y++ {
+				if cv.Solid(x, y, z, 10, 0) != (y <= 10) {
+					t.Fatalf("block %d,%d,%d reshaped outside the mask", x, y, z)
+				}
+			}
+		}
+	}
+}
+
+func floorMod(v, d int) int {
+	return v - floorDiv(v, d)*d
+}
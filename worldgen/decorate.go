@@ -0,0 +1,141 @@
+package worldgen
+
+import (
+	"craft3d/prefab"
+	"craft3d/world"
+)
+
+// Column is the top of a column of terrain.
+type Column struct {
+	Height int // y of the surface block
+	Block  int // ID of the surface block
+	Biome  *Biome
+}
+
+// SurfaceSource is a generator that can tell where its surface is without
+// generating chunks, so decorations can be placed on it.
+type SurfaceSource interface {
+	Generator
+	BiomeSource
+
+	// Surface returns a function giving the top of columns for one seed.
+	Surface(seed int64) func(x, z int) Column
+}
+
+// Surface implements SurfaceSource. The surface is the top of the ground
+// once it has been shaped and caves carved, so a column whose top block a
+// tunnel took away has air or water there and nothing stands on it.
+func (g *Terrain) Surface(seed int64) func(x, z int) Column {
+	hm, cv := NewHeightMap(seed), NewCaves(seed)
+	return func(x, z int) Column {
+		s := hm.Sample(x, z)
+		strength := cv.Overhangs(x, z)
+		y, id := s.Height, g.block(s.Height, s)
+		if strength > 0 {
+			for y = s.Height + overhangBand; y > s.Height-overhangBand; y-- {
+				if id = g.shapedBlock(cv, x, y, z, s, strength); id != world.Air && id != g.water {
+					break
+				}
+			}
+		}
+		if y >= bottomY+floorDepth && (y < s.Height-caveRoof && cv.Chamber(x, y, z) || cv.InWorm(x, y, z)) {
+			id = world.Air
+			if y <= WaterLevel {
+				id = g.water
+			}
+		}
+		return Column{y, id, s.Biome}
+	}
+}
+
+// Decorated adds prefabs such as trees, plants and boulders on top of the
+// terrain of another generator.
+//
+// Each column rolls for every prefab, in order, and gets the first one
+// whose chance in the column's biome, scaled by the biome's Decoration,
+// passes and that can stand on its surface block. The rolls only depend on the seed and the column, so a
+// chunk finds every prefab that reaches into it by checking the columns
+// around it, and prefabs that cross chunk borders are written the same way
+// whichever chunk is generated first. Above the ground prefabs only fill
+// air, below it they replace the terrain (for wells and sunken boulders).
+type Decorated struct {
+	SurfaceSource
+	prefabs    []*prefab.Prefab
+	reach      int     // Largest prefab reach
+	decoration float64 // Largest biome Decoration
+}
+
+// Decorate places prefabs on the terrain of src.
+func Decorate(src SurfaceSource, prefabs []*prefab.Prefab) *Decorated {
+	d := &Decorated{SurfaceSource: src, prefabs: prefabs}
+	for _, p := range prefabs {
+		d.reach = max(d.reach, p.Reach())
+	}
+	for _, b := range Biomes {
+		d.decoration = max(d.decoration, b.Decoration)
+	}
+	return d
+}
+
+// GenerateChunk implements Generator.
+func (d *Decorated) GenerateChunk(seed int64, pos world.ChunkPos) *world.Chunk {
+	c := d.SurfaceSource.GenerateChunk(seed, pos)
+	if pos.Y < MinChunkY || pos.Y > MaxChunkY || len(d.prefabs) == 0 {
+		return c
+	}
+
+	o := pos.Origin()
+	d.each(seed, d.Surface(seed), o.X-d.reach, o.Z-d.reach, o.X+world.ChunkSize+d.reach, o.Z+world.ChunkSize+d.reach,
+		func(p *prefab.Prefab, at world.BlockPos, turns int) {
+			place(c, p, at, turns)
+		})
+	return c
+}
+
+// each calls fn with every prefab placed in the columns from x0, z0 up to
+// x1, z1, its origin and its turns.
+func (d *Decorated) each(seed int64, surface func(x, z int) Column, x0, z0, x1, z1 int, fn func(p *prefab.Prefab, at world.BlockPos, turns int)) {
+	salt := subSeed(seed, 11)
+	for x := x0; x < x1; x++ {
+		for z := z0; z < z1; z++ {
+			r := newRNG(salt, x, z)
+			var col *Column
+			for _, p := range d.prefabs {
+				roll, turns := r.float(), int(r.float()*4)
+				if roll >= p.MaxChance()*d.decoration {
+					continue
+				}
+				if col == nil {
+					s := surface(x, z)
+					col = &s
+				}
+				if col.Height <= WaterLevel || !p.CanStandOn(col.Block) || roll >= p.Chance(col.Biome.Name)*col.Biome.Decoration {
+					continue
+				}
+				if !p.Rotate {
+					turns = 0
+				}
+				fn(p, world.BlockPos{X: x, Y: col.Height + 1, Z: z}, turns)
+				break
+			}
+		}
+	}
+}
+
+// place writes the cells of prefab p that fall inside chunk c, with the
+// prefab origin at at.
+func place(c *world.Chunk, p *prefab.Prefab, at world.BlockPos, turns int) {
+	o := c.Pos.Origin()
+	if at.Y+p.Above() < o.Y || at.Y-p.Below() >= o.Y+world.ChunkSize {
+		return
+	}
+	p.Each(turns, func(dx, dy, dz, id int) {
+		x, y, z := at.X+dx-o.X, at.Y+dy-o.Y, at.Z+dz-o.Z
+		if !inChunk(x, y, z) {
+			return
+		}
+		if dy < 0 || c.Get(x, y, z) == world.Air {
+			c.Set(x, y, z, id)
+		}
+	})
+}
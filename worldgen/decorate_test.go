@@ -0,0 +1,178 @@
+package worldgen
+
+import (
+	"testing"
+
+	"craft3d/prefab"
+	"craft3d/world"
+)
+
+// flatTerrain is grass up to y=0 everywhere, in the plains.
+type flatTerrain struct {
+	grass int
+}
+
+func (f flatTerrain) GenerateChunk(seed int64, pos world.ChunkPos) *world.Chunk {
+	c := world.NewChunk(pos)
+	o := pos.Origin()
+	for y := 0; y < world.ChunkSize; y++ {
+		for z := 0; z < world.ChunkSize; z++ {
+			for x := 0; x < world.ChunkSize; x++ {
+				if o.Y+y <= 0 {
+					c.Set(x, y, z, f.grass)
+				}
+			}
+		}
+	}
+	return c
+}
+
+func (f flatTerrain) BiomeAt(seed int64, x, z int) *Biome { return Plains }
+
+func (f flatTerrain) TintAt(seed int64, x, z int) (grass, water [4]float32) {
+	return Plains.GrassTint, Plains.WaterTint
+}
+
+func (f flatTerrain) Surface(seed int64) func(x, z int) Column {
+	return func(x, z int) Column { return Column{0, f.grass, Plains} }
+}
+
+func TestDecorationsCrossChunks(t *testing.T) {
+	reg := testRegistry(t)
+	tree, err := prefab.Parse("tree", []byte(`{
+		"on": ["grass"], "chance": {"plains": 0.03}, "origin": [2, 0, 2],
+		"palette": {"L": "log", "#": "leaves"},
+		"layers": [
+			[".....", ".....", "..L..", ".....", "....."],
+			["#####", "#####", "#####", "#####", "#####"]
+		]
+	}`), reg, BiomeNames())
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := Decorate(flatTerrain{reg.ID("grass")}, []*prefab.Prefab{tree})
+
+	// Ground level chunks of a 4x4 area, assembled into one world
+	w := world.New()
+	for cx := -2; cx < 2; cx++ {
+		for cz := -2; cz < 2; cz++ {
+			w.SetChunk(g.GenerateChunk(9, world.ChunkPos{X: cx, Y: 0, Z: cz}))
+		}
+	}
+
+	log, leaves := reg.ID("log"), reg.ID("leaves")
+	trees, crossing := 0, 0
+	for x := -30; x < 30; x++ {
+		for z := -30; z < 30; z++ {
+			if w.GetBlock(world.BlockPos{X: x, Y: 1, Z: z}) != log {
+				continue
+			}
+			trees++
+			if world.ChunkPosOf(world.BlockPos{X: x - 2, Z: z - 2}) != world.ChunkPosOf(world.BlockPos{X: x + 2, Z: z + 2}) {
+				crossing++
+			}
+			for dx := -2; dx <= 2; dx++ {
+				for dz := -2; dz <= 2; dz++ {
+					if id := w.GetBlock(world.BlockPos{X: x + dx, Y: 2, Z: z + dz}); id != leaves {
+						t.Errorf("tree at %d,%d: block %d,%d is %d, want leaves", x, z, x+dx, z+dz, id)
+					}
+				}
+			}
+		}
+	}
+	if trees == 0 || crossing == 0 {
+		t.Fatalf("%d trees, %d crossing a chunk border; want some of each", trees, crossing)
+	}
+}
+
+func TestDecoratedTerrain(t *testing.T) {
+	reg := testRegistry(t)
+	prefabs, err := prefab.LoadDir("../prefabs", reg, BiomeNames())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := New("noise", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g SurfaceSource = Decorate(gen.(SurfaceSource), prefabs)
+	bare := Count(gen, 3, 4, 16)
+	decorated := Count(g, 3, 4, 16)
+
+	for _, name := range []string{"log", "leaves", "tall_grass"} {
+		if n := decorated.Total(reg.ID(name)); n == 0 {
+			t.Errorf("no %s placed", name)
+		}
+	}
+	// Decorations never touch the world below the surface, except for the
+	// few prefabs that sink into it
+	if got, want := decorated.Total(reg.ID("water")), bare.Total(reg.ID("water")); got < want {
+		t.Errorf("decorations removed water: %d, had %d", got, want)
+	}
+}
+
+func TestPrefabsStandOnGround(t *testing.T) {
+	reg := testRegistry(t)
+	prefabs, err := prefab.LoadDir("../prefabs", reg, BiomeNames())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := New("noise", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const seed = 42
+	d := Decorate(gen.(SurfaceSource), prefabs)
+
+	// The bare terrain under every prefab origin of a 24x24 chunk area,
+	// which has tunnels breaking through the surface
+	chunks := map[world.ChunkPos]*world.Chunk{}
+	placed := 0
+	d.each(seed, d.Surface(seed), -12*world.ChunkSize, -12*world.ChunkSize, 12*world.ChunkSize, 12*world.ChunkSize,
+		func(p *prefab.Prefab, at world.BlockPos, turns int) {
+			placed++
+			under := world.BlockPos{X: at.X, Y: at.Y - 1, Z: at.Z}
+			cp := world.ChunkPosOf(under)
+			c, ok := chunks[cp]
+			if !ok {
+				c = gen.GenerateChunk(seed, cp)
+				chunks[cp] = c
+			}
+			o := cp.Origin()
+			if id := c.Get(under.X-o.X, under.Y-o.Y, under.Z-o.Z); id == world.Air || reg.IsLiquid(id) {
+				t.Errorf("%s at %v stands on %s", p.Name, at, reg.StateName(id))
+			}
+		})
+	if placed == 0 {
+		t.Fatal("no prefabs placed")
+	}
+}
+
+func TestBiomeDecoration(t *testing.T) {
+	reg := testRegistry(t)
+	bush, err := prefab.Parse("bush", []byte(`{
+		"on": ["grass"], "chance": {"*": 0.05}, "palette": {"#": "leaves"}, "layers": [["#"]]
+	}`), reg, BiomeNames())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := Decorate(flatTerrain{reg.ID("grass")}, []*prefab.Prefab{bush})
+	count := func(decoration float64) int {
+		b := *Plains
+		b.Decoration = decoration
+		n := 0
+		d.each(5, func(x, z int) Column { return Column{0, reg.ID("grass"), &b} }, 0, 0, 200, 200,
+			func(p *prefab.Prefab, at world.BlockPos, turns int) { n++ })
+		return n
+	}
+	none, normal, dense := count(0), count(1), count(1.5)
+	if none != 0 {
+		t.Errorf("%d bushes where decoration is 0", none)
+	}
+	if normal < 1600 || normal > 2400 {
+		t.Errorf("%d bushes in 200x200 at 5%%, want about 2000", normal)
+	}
+	if dense < normal*13/10 || dense > normal*17/10 {
+		t.Errorf("%d bushes at 1.5 times the decoration, %d at 1", dense, normal)
+	}
+}
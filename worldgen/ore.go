@@ -0,0 +1,78 @@
+package worldgen
+
+import (
+	"craft3d/block"
+	"craft3d/world"
+)
+
+// oreSpec is an ore placed by a generator.
+type oreSpec struct {
+	id  int
+	ore block.Ore
+}
+
+// ores returns the ores defined in reg.
+func ores(reg *block.Registry) []oreSpec {
+	var list []oreSpec
+	for _, b := range reg.Ores() {
+		list = append(list, oreSpec{b.ID, *b.Ore})
+	}
+	return list
+}
+
+// placeOres replaces rock in c with ore veins.
+//
+// A vein is a random walk of Size blocks from a start picked in some chunk.
+// The walk only depends on the seed, the ore and the start chunk, and as
+// the block registry keeps Size at most world.ChunkSize it never leaves the
+// start chunk's neighbours, so each chunk also walks the veins of the 26
+// chunks around it to catch the ones that cross its border.
+func placeOres(c *world.Chunk, seed int64, specs []oreSpec, rock int) {
+	seed = subSeed(seed, 10)
+	for _, spec := range specs {
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				for dz := -1; dz <= 1; dz++ {
+					placeVeins(c, seed, spec, c.Pos.Add(dx, dy, dz), rock)
+				}
+			}
+		}
+	}
+}
+
+// placeVeins walks the veins of one ore that start in chunk from and writes
+// the blocks that fall inside c.
+func placeVeins(c *world.Chunk, seed int64, spec oreSpec, from world.ChunkPos, rock int) {
+	o := from.Origin()
+	if o.Y > spec.ore.MaxY || o.Y+world.ChunkSize <= spec.ore.MinY {
+		return
+	}
+	co := c.Pos.Origin()
+	r := newRNG(seed, spec.id, from.X, from.Y, from.Z)
+	n := int(spec.ore.Veins)
+	if r.float() < spec.ore.Veins-float64(n) {
+		n++
+	}
+	for i := 0; i < n; i++ {
+		x := o.X + int(r.float()*world.ChunkSize)
+		y := o.Y + int(r.float()*world.ChunkSize)
+		z := o.Z + int(r.float()*world.ChunkSize)
+		inRange := y >= spec.ore.MinY && y <= spec.ore.MaxY
+		for s := 0; s < spec.ore.Size; s++ {
+			lx, ly, lz := x-co.X, y-co.Y, z-co.Z
+			if inRange && inChunk(lx, ly, lz) && c.Get(lx, ly, lz) == rock {
+				c.Set(lx, ly, lz, spec.id)
+			}
+			n := directions[int(r.float()*6)]
+			x, y, z = x+n[0], y+n[1], z+n[2]
+		}
+	}
+}
+
+// directions are the six steps a vein can take.
+var directions = [6][3]int{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}}
+
+func inChunk(x, y, z int) bool {
+	const n = world.ChunkSize
+	return x >= 0 && x < n && y >= 0 && y < n && z >= 0 && z < n
+}
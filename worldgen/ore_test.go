@@ -0,0 +1,92 @@
+package worldgen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"craft3d/world"
+)
+
+func TestOreDistribution(t *testing.T) {
+	reg := testRegistry(t)
+	g, err := New("noise", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := Count(g, 11, 4, 8)
+
+	prev := -1
+	for _, b := range reg.Ores() {
+		total := stats.Total(b.ID)
+		if total == 0 {
+			t.Errorf("no %s generated", b.Name)
+		}
+		// Ores are listed from the most to the least common
+		if prev >= 0 && total >= prev {
+			t.Errorf("%s (%d) is not rarer than the previous ore (%d)", b.Name, total, prev)
+		}
+		prev = total
+
+		// A vein can wander at most Size blocks from its start
+		for i, n := range stats.Counts[b.ID] {
+			minY, maxY := stats.BandRange(i)
+			if n > 0 && (maxY < b.Ore.MinY-b.Ore.Size || minY > b.Ore.MaxY+b.Ore.Size) {
+				t.Errorf("%d %s in y %d..%d, outside %d..%d", n, b.Name, minY, maxY, b.Ore.MinY, b.Ore.MaxY)
+			}
+		}
+	}
+}
+
+func TestOreOnlyReplacesRock(t *testing.T) {
+	reg := testRegistry(t)
+	g, err := New("noise", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withOres := Count(g, 5, 2, 16)
+
+	// Without ores, the same chunks have exactly as many rock blocks as
+	// rock plus ores had, and everything else is unchanged
+	bare := g.(*Terrain)
+	saved := bare.ores
+	bare.ores = nil
+	without := Count(bare, 5, 2, 16)
+	bare.ores = saved
+
+	rock := reg.ID("rock")
+	ores := withOres.Total(rock)
+	for _, b := range reg.Ores() {
+		ores += withOres.Total(b.ID)
+	}
+	if got := without.Total(rock); got != ores {
+		t.Errorf("rock without ores = %d, want rock+ores = %d", got, ores)
+	}
+	for _, id := range []int{reg.ID("dirt"), reg.ID("sand"), reg.ID("grass"), reg.ID("water")} {
+		if withOres.Total(id) != without.Total(id) {
+			t.Errorf("block %d count changed by ores", id)
+		}
+	}
+}
+
+func TestStatsWrite(t *testing.T) {
+	reg := testRegistry(t)
+	s := &Stats{Band: 32, Chunks: 2, Counts: map[int][]int{reg.ID("coal_ore"): {3, 0, 1, 0}}}
+	var buf bytes.Buffer
+	if err := s.Write(&buf, reg.Ores()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if want := 1 + s.Bands() + 2; len(lines) != want {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), want, buf.String())
+	}
+	if !strings.Contains(lines[0], "coal_ore") {
+		t.Errorf("header %q does not name the ores", lines[0])
+	}
+	if f := strings.Fields(lines[len(lines)-2]); f[0] != "total" || f[1] != "4" {
+		t.Errorf("totals = %q", lines[len(lines)-2])
+	}
+	if minY, maxY := s.BandRange(0); minY != MinChunkY*world.ChunkSize || maxY != minY+31 {
+		t.Errorf("BandRange(0) = %d..%d", minY, maxY)
+	}
+}
@@ -0,0 +1,40 @@
+package worldgen
+
+import (
+	"image"
+	"image/color"
+
+	"craft3d/world"
+)
+
+// Slice draws the vertical plane z of the terrain made by g, one pixel per
+// block. x runs from minX to maxX-1, left to right, and y covers the whole
+// generated range with the highest blocks in the top row. colors gives the
+// colour of each block ID; air is left transparent.
+//
+// It is meant for looking at caves and overhangs without starting the game.
+func Slice(g Generator, seed int64, z, minX, maxX int, colors func(id int) color.RGBA) *image.RGBA {
+	minY := MinChunkY * world.ChunkSize
+	maxY := (MaxChunkY + 1) * world.ChunkSize
+	img := image.NewRGBA(image.Rect(0, 0, maxX-minX, maxY-minY))
+
+	cz := floorDiv(z, world.ChunkSize)
+	for cx := floorDiv(minX, world.ChunkSize); cx <= floorDiv(maxX-1, world.ChunkSize); cx++ {
+		for cy := MinChunkY; cy <= MaxChunkY; cy++ {
+			c := g.GenerateChunk(seed, world.ChunkPos{X: cx, Y: cy, Z: cz})
+			o := c.Pos.Origin()
+			for lx := 0; lx < world.ChunkSize; lx++ {
+				x := o.X + lx
+				if x < minX || x >= maxX {
+					continue
+				}
+				for ly := 0; ly < world.ChunkSize; ly++ {
+					if id := c.Get(lx, ly, z-o.Z); id != world.Air {
+						img.SetRGBA(x-minX, maxY-1-(o.Y+ly), colors(id))
+					}
+				}
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,100 @@
+package worldgen
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+// Stats counts the blocks of generated terrain per height band.
+type Stats struct {
+	Band   int           // Height of a band in blocks
+	Chunks int           // Number of chunks counted
+	Counts map[int][]int // Block ID -> count in each band, lowest band first
+}
+
+// Count generates every chunk within radius chunks of the origin on the X
+// and Z axes, over the whole generated height, and counts their blocks in
+// bands of band blocks starting at the bottom of the world.
+func Count(g Generator, seed int64, radius, band int) *Stats {
+	s := &Stats{Band: band, Counts: map[int][]int{}}
+	bands := s.Bands()
+	for cx := -radius; cx < radius; cx++ {
+		for cz := -radius; cz < radius; cz++ {
+			for cy := MinChunkY; cy <= MaxChunkY; cy++ {
+				c := g.GenerateChunk(seed, world.ChunkPos{X: cx, Y: cy, Z: cz})
+				s.Chunks++
+				c.Each(func(p world.BlockPos, state int) {
+					id := block.TypeOf(state) // Every state of a block counts as the block
+					counts := s.Counts[id]
+					if counts == nil {
+						counts = make([]int, bands)
+						s.Counts[id] = counts
+					}
+					counts[(p.Y-bottomY)/band]++
+				})
+			}
+		}
+	}
+	return s
+}
+
+// Bands returns the number of height bands.
+func (s *Stats) Bands() int {
+	height := (MaxChunkY - MinChunkY + 1) * world.ChunkSize
+	return (height + s.Band - 1) / s.Band
+}
+
+// BandRange returns the lowest and highest y of band i.
+func (s *Stats) BandRange(i int) (minY, maxY int) {
+	minY = bottomY + i*s.Band
+	return minY, minY + s.Band - 1
+}
+
+// Total returns the number of blocks of one type over all bands.
+func (s *Stats) Total(id int) int {
+	n := 0
+	for _, c := range s.Counts[id] {
+		n += c
+	}
+	return n
+}
+
+// Write prints a table of the counts of the given blocks, one row per band
+// with the highest band first, followed by the totals.
+func (s *Stats) Write(w io.Writer, blocks []*block.Block) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "y\t")
+	for _, b := range blocks {
+		fmt.Fprintf(tw, "%s\t", b.Name)
+	}
+	fmt.Fprintln(tw)
+
+	for i := s.Bands() - 1; i >= 0; i-- {
+		minY, maxY := s.BandRange(i)
+		fmt.Fprintf(tw, "%d..%d\t", minY, maxY)
+		for _, b := range blocks {
+			n := 0
+			if counts := s.Counts[b.ID]; counts != nil {
+				n = counts[i]
+			}
+			fmt.Fprintf(tw, "%d\t", n)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	fmt.Fprint(tw, "total\t")
+	for _, b := range blocks {
+		fmt.Fprintf(tw, "%d\t", s.Total(b.ID))
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "per chunk\t")
+	for _, b := range blocks {
+		fmt.Fprintf(tw, "%.2f\t", float64(s.Total(b.ID))/float64(s.Chunks))
+	}
+	fmt.Fprintln(tw)
+	return tw.Flush()
+}
@@ -0,0 +1,253 @@
+package worldgen
+
+import (
+	"math"
+
+	"craft3d/block"
+	"craft3d/noise"
+	"craft3d/world"
+)
+
+func init() {
+	Register("noise", NewTerrain)
+}
+
+// Terrain layout shared by the noise based generators.
+const (
+	WaterLevel = -1 // Highest water block
+	dirtDepth  = 3  // Dirt blocks under the surface before rock
+	rockLevel  = -2 // Below this there is only rock
+	bottomY    = MinChunkY * world.ChunkSize
+)
+
+// Noise settings of the height map. Frequencies are per block.
+var (
+	warpFractal     = noise.Fractal{Octaves: 3, Frequency: 1.0 / 256, Lacunarity: 2, Gain: 0.5}
+	baseFractal     = noise.Fractal{Octaves: 5, Frequency: 1.0 / 384, Lacunarity: 2, Gain: 0.5}
+	mountainMask    = noise.Fractal{Octaves: 2, Frequency: 1.0 / 640, Lacunarity: 2, Gain: 0.5}
+	mountainFractal = noise.Fractal{Octaves: 4, Frequency: 1.0 / 160, Lacunarity: 2.1, Gain: 0.5}
+	detailFractal   = noise.Fractal{Octaves: 2, Frequency: 1.0 / 24, Lacunarity: 2, Gain: 0.5}
+)
+
+// Terrain generates natural looking land from layered simplex noise: broad
+// plains and valleys from domain-warped fBm, ridged mountain ranges where a
+// low frequency mask allows them, and a little small-scale roughness. Each
+// column belongs to a biome, which picks the surface and filler blocks; the
+// shore is sand and water fills everything up to WaterLevel. Ore veins are
+// placed in the rock, then caves are carved out of the solid ground, see
+// Caves.
+type Terrain struct {
+	sand, rock, water, snow int
+
+	surface, filler []int // Block IDs per biome, same order as Biomes
+	ores            []oreSpec
+}
+
+// NewTerrain creates a noise terrain generator using blocks from reg.
+func NewTerrain(reg *block.Registry) (Generator, error) {
+	ids, err := lookup(reg, "sand", "rock", "water", "snow")
+	if err != nil {
+		return nil, err
+	}
+	g := &Terrain{sand: ids[0], rock: ids[1], water: ids[2], snow: ids[3], ores: ores(reg)}
+	for _, b := range Biomes {
+		ids, err := lookup(reg, b.Surface, b.Filler)
+		if err != nil {
+			return nil, err
+		}
+		g.surface = append(g.surface, ids[0])
+		g.filler = append(g.filler, ids[1])
+	}
+	return g, nil
+}
+
+// GenerateChunk implements Generator.
+func (g *Terrain) GenerateChunk(seed int64, pos world.ChunkPos) *world.Chunk {
+	c := world.NewChunk(pos)
+	if pos.Y < MinChunkY || pos.Y > MaxChunkY {
+		return c
+	}
+
+	hm, cv := NewHeightMap(seed), NewCaves(seed)
+	o := pos.Origin()
+	var heights [world.ChunkSize][world.ChunkSize]int
+	for lx := 0; lx < world.ChunkSize; lx++ {
+		for lz := 0; lz < world.ChunkSize; lz++ {
+			x, z := o.X+lx, o.Z+lz
+			s := hm.Sample(x, z)
+			heights[lx][lz] = s.Height
+			strength := cv.Overhangs(x, z)
+			for ly := 0; ly < world.ChunkSize; ly++ {
+				if id := g.shapedBlock(cv, x, o.Y+ly, z, s, strength); id != world.Air {
+					c.Set(lx, ly, lz, id)
+				}
+			}
+		}
+	}
+	placeOres(c, seed, g.ores, g.rock)
+	g.carve(c, cv, &heights)
+	return c
+}
+
+// shapedBlock returns the block at x, y, z of a column before caves are
+// carved: the layers of the column, reshaped near the surface with
+// strength (see Caves.Overhangs). Ground added above the surface is rock,
+// and ground taken away below the water level is flooded.
+func (g *Terrain) shapedBlock(cv *Caves, x, y, z int, s Sample, strength float64) int {
+	id := g.block(y, s)
+	if strength == 0 || y < bottomY {
+		return id
+	}
+	ground := id != world.Air && id != g.water
+	switch solid := cv.Solid(x, y, z, s.Height, strength); {
+	case solid && !ground:
+		return g.rock
+	case !solid && ground && y <= WaterLevel:
+		return g.water
+	case !solid && ground:
+		return world.Air
+	}
+	return id
+}
+
+// carve hollows out the caves of a chunk. Caves at or below WaterLevel are
+// flooded, and the bottom floorDepth layers of the world stay solid.
+func (g *Terrain) carve(c *world.Chunk, cv *Caves, heights *[world.ChunkSize][world.ChunkSize]int) {
+	if c.Empty() {
+		return
+	}
+	o := c.Pos.Origin()
+	hollow := func(x, y, z int) {
+		id := c.Get(x, y, z)
+		if id == world.Air || id == g.water || o.Y+y < bottomY+floorDepth {
+			return
+		}
+		if o.Y+y <= WaterLevel {
+			c.Set(x, y, z, g.water)
+		} else {
+			c.Set(x, y, z, world.Air)
+		}
+	}
+
+	for y := 0; y < world.ChunkSize; y++ {
+		for z := 0; z < world.ChunkSize; z++ {
+			for x := 0; x < world.ChunkSize; x++ {
+				if o.Y+y < heights[x][z]-caveRoof && cv.Chamber(o.X+x, o.Y+y, o.Z+z) {
+					hollow(x, y, z)
+				}
+			}
+		}
+	}
+	cv.EachWormBlock(c.Pos, hollow)
+}
+
+// block returns the block at height y of a column.
+func (g *Terrain) block(y int, s Sample) int {
+	h := s.Height
+	b := biomeIndex(s.Biome)
+	switch {
+	case y < bottomY:
+		return world.Air
+	case y > h && y <= WaterLevel:
+		return g.water
+	case y > h:
+		return world.Air
+	case y == h && y <= WaterLevel+1:
+		return g.sand // Shore/Seabed
+	case y == h && s.Biome.SnowLine != 0 && y >= s.Biome.SnowLine:
+		return g.snow
+	case y == h:
+		return g.surface[b]
+	case y < h-dirtDepth || y < rockLevel:
+		return g.rock
+	default:
+		return g.filler[b]
+	}
+}
+
+// BiomeAt implements BiomeSource.
+func (g *Terrain) BiomeAt(seed int64, x, z int) *Biome {
+	return NewHeightMap(seed).Sample(x, z).Biome
+}
+
+// TintAt implements BiomeSource.
+func (g *Terrain) TintAt(seed int64, x, z int) (grass, water [4]float32) {
+	w := NewHeightMap(seed).Sample(x, z).Weights
+	return blendTint(w, func(b *Biome) [4]float32 { return b.GrassTint }),
+		blendTint(w, func(b *Biome) [4]float32 { return b.WaterTint })
+}
+
+// HeightMap samples the noise terrain of one seed.
+type HeightMap struct {
+	warp, base, mask, mountains, detail *noise.Simplex
+	temperature, humidity               *noise.Simplex
+}
+
+// NewHeightMap creates the noise sources for seed. Each layer gets its own
+// derived seed so they are not correlated.
+func NewHeightMap(seed int64) *HeightMap {
+	return &HeightMap{
+		warp:        noise.NewSimplex(subSeed(seed, 1)),
+		base:        noise.NewSimplex(subSeed(seed, 2)),
+		mask:        noise.NewSimplex(subSeed(seed, 3)),
+		mountains:   noise.NewSimplex(subSeed(seed, 4)),
+		detail:      noise.NewSimplex(subSeed(seed, 5)),
+		temperature: noise.NewSimplex(subSeed(seed, 6)),
+		humidity:    noise.NewSimplex(subSeed(seed, 7)),
+	}
+}
+
+// Height returns the y of the surface block at x, z.
+func (hm *HeightMap) Height(x, z int) int {
+	return hm.Sample(x, z).Height
+}
+
+// Sample returns the height and biomes of column x, z.
+func (hm *HeightMap) Sample(x, z int) Sample {
+	fx, fz := float64(x), float64(z)
+
+	// Plains and valleys, bent by domain warping so they do not line up
+	wx, wz := noise.Warp2(hm.warp, warpFractal, fx, fz, 40)
+	continent := baseFractal.FBM2(hm.base, wx, wz)
+	m := smoothstep(0.05, 0.45, mountainMask.FBM2(hm.mask, fx, fz))
+
+	t := clamp(1.8 * climateFractal.FBM2(hm.temperature, fx, fz))
+	u := clamp(1.8 * climateFractal.FBM2(hm.humidity, fx, fz))
+	weights := biomeWeights(continent, m, t, u)
+
+	h := 4 + 14*continent + blend(weights, func(b *Biome) float64 { return b.HeightOffset })
+
+	// Mountain ranges only where the mask is high
+	if m > 0 {
+		r := mountainFractal.Ridged2(hm.mountains, wx, wz)
+		h += m * 48 * r * r
+	}
+
+	roughness := blend(weights, func(b *Biome) float64 { return b.Roughness })
+	h += roughness * detailFractal.FBM2(hm.detail, fx, fz)
+
+	return Sample{
+		Height:  int(math.Floor(h)),
+		Biome:   dominant(weights),
+		Weights: weights,
+	}
+}
+
+func smoothstep(edge0, edge1, x float64) float64 {
+	t := clamp01((x - edge0) / (edge1 - edge0))
+	return t * t * (3 - 2*t)
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func clamp(v float64) float64 {
+	return math.Max(-1, math.Min(1, v))
+}
+
+// subSeed derives an independent seed for one use of the world seed.
+func subSeed(seed int64, salt uint64) int64 {
+	state := uint64(seed) ^ salt*0x9e3779b97f4a7c15
+	return int64(noise.SplitMix64(&state))
+}
@@ -0,0 +1,73 @@
+package worldgen
+
+import (
+	"math"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+func init() {
+	Register("wave", NewWave)
+}
+
+// Wave is the original demo terrain: rolling sin/cos hills with sand
+// shores, a dirt layer over rock and water up to y=-1. It ignores the
+// seed.
+type Wave struct {
+	sand, rock, grass, dirt, water int
+}
+
+// Wave terrain layout.
+const (
+	waveBottom     = -5 // Lowest ground block, water in deep columns goes lower
+	waveWaterLevel = -1
+)
+
+// NewWave creates a wave generator using blocks from reg.
+func NewWave(reg *block.Registry) (Generator, error) {
+	ids, err := lookup(reg, "sand", "rock", "grass", "dirt", "water")
+	if err != nil {
+		return nil, err
+	}
+	return &Wave{ids[0], ids[1], ids[2], ids[3], ids[4]}, nil
+}
+
+// GenerateChunk implements Generator.
+func (g *Wave) GenerateChunk(seed int64, pos world.ChunkPos) *world.Chunk {
+	c := world.NewChunk(pos)
+	o := pos.Origin()
+
+	for lx := 0; lx < world.ChunkSize; lx++ {
+		for lz := 0; lz < world.ChunkSize; lz++ {
+			x, z := o.X+lx, o.Z+lz
+			// Simple wave function
+			h := int(float64(4.0) * (math.Sin(float64(x)*0.1) + math.Cos(float64(z)*0.1)))
+
+			for ly := 0; ly < world.ChunkSize; ly++ {
+				if id := g.block(o.Y+ly, h); id != world.Air {
+					c.Set(lx, ly, lz, id)
+				}
+			}
+		}
+	}
+	return c
+}
+
+// block returns the block at height y of a column whose surface is at h.
+func (g *Wave) block(y, h int) int {
+	switch {
+	case y > h && y <= waveWaterLevel:
+		return g.water
+	case y > h, y < waveBottom:
+		return world.Air
+	case y == h && y <= waveWaterLevel+1:
+		return g.sand // Shore/Seabed
+	case y == h:
+		return g.grass
+	case y < -2:
+		return g.rock // Rock deep down
+	default:
+		return g.dirt // Dirt in between
+	}
+}
@@ -0,0 +1,71 @@
+// Package worldgen creates terrain, one chunk at a time.
+//
+// Generators are registered by name and must be deterministic: the same
+// seed and chunk position always produce the same blocks, whatever order
+// chunks are generated in.
+package worldgen
+
+import (
+	"fmt"
+	"sort"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+// Vertical extent of generated terrain, in chunks. Chunks outside this range
+// are always empty.
+const (
+	MinChunkY = -4
+	MaxChunkY = 3
+)
+
+// Generator creates the blocks of a chunk.
+type Generator interface {
+	GenerateChunk(seed int64, pos world.ChunkPos) *world.Chunk
+}
+
+// Factory creates a generator that places blocks from the registry.
+type Factory func(reg *block.Registry) (Generator, error)
+
+var factories = map[string]Factory{}
+
+// Register makes a generator available by name.
+func Register(name string, f Factory) {
+	if _, dup := factories[name]; dup {
+		panic("worldgen: generator registered twice: " + name)
+	}
+	factories[name] = f
+}
+
+// New creates the generator with the given name.
+func New(name string, reg *block.Registry) (Generator, error) {
+	f, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown generator %q (available: %v)", name, Names())
+	}
+	return f(reg)
+}
+
+// Names returns the sorted names of the registered generators.
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup returns the IDs of the named blocks, failing if any is missing.
+func lookup(reg *block.Registry, names ...string) ([]int, error) {
+	ids := make([]int, len(names))
+	for i, name := range names {
+		b := reg.ByName(name)
+		if b == nil {
+			return nil, fmt.Errorf("worldgen: block %q is not defined", name)
+		}
+		ids[i] = b.ID
+	}
+	return ids, nil
+}
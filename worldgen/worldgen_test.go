@@ -0,0 +1,184 @@
+package worldgen
+
+import (
+	"bytes"
+	"testing"
+
+	"craft3d/block"
+	"craft3d/world"
+)
+
+func testRegistry(t testing.TB) *block.Registry {
+	t.Helper()
+	reg, err := block.Load("../blocks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+// chunkBytes serialises a chunk as little-endian block IDs.
+func chunkBytes(c *world.Chunk) []byte {
+	var buf bytes.Buffer
+	for y := 0; y < world.ChunkSize; y++ {
+		for z := 0; z < world.ChunkSize; z++ {
+			for x := 0; x < world.ChunkSize; x++ {
+				id := c.Get(x, y, z)
+				buf.WriteByte(byte(id))
+				buf.WriteByte(byte(id >> 8))
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+var samplePositions = []world.ChunkPos{
+	{X: 0, Y: 0, Z: 0}, {X: -1, Y: -1, Z: -1}, {X: 3, Y: 0, Z: -4}, {X: 0, Y: MinChunkY, Z: 0}, {X: 100, Y: 1, Z: -57},
+}
+
+func TestGeneratorsDeterministic(t *testing.T) {
+	reg := testRegistry(t)
+	for _, name := range Names() {
+		t.Run(name, func(t *testing.T) {
+			// Two generator instances, chunks requested in opposite orders
+			g1, err := New(name, reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g2, err := New(name, reg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first := map[world.ChunkPos][]byte{}
+			for _, seed := range []int64{0, 42} {
+				for _, cp := range samplePositions {
+					first[cp] = chunkBytes(g1.GenerateChunk(seed, cp))
+				}
+				for i := len(samplePositions) - 1; i >= 0; i-- {
+					cp := samplePositions[i]
+					if !bytes.Equal(first[cp], chunkBytes(g2.GenerateChunk(seed, cp))) {
+						t.Errorf("seed %d chunk %v differs between runs", seed, cp)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestNewUnknown(t *testing.T) {
+	if _, err := New("does-not-exist", testRegistry(t)); err == nil {
+		t.Errorf("expected error for unknown generator")
+	}
+}
+
+func TestNewMissingBlocks(t *testing.T) {
+	reg, err := block.Parse([]byte(`{"blocks": [{"id": 1, "name": "sand", "textures": {"all": "sand"}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New("wave", reg); err == nil {
+		t.Errorf("expected error when blocks are missing")
+	}
+}
+
+func TestWaveColumns(t *testing.T) {
+	reg := testRegistry(t)
+	g, err := New("wave", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := world.New()
+	for cy := -1; cy <= 0; cy++ {
+		w.SetChunk(g.GenerateChunk(0, world.ChunkPos{X: 0, Y: cy, Z: 0}))
+	}
+
+	// Column x=0, z=0: h = int(4*(sin(0)+cos(0))) = 4
+	want := map[int]string{
+		-6: "", -5: "rock", -3: "rock", -2: "dirt", 3: "dirt", 4: "grass", 5: "",
+	}
+	for y, name := range want {
+		if got := w.GetBlock(world.BlockPos{X: 0, Y: y, Z: 0}); got != reg.ID(name) {
+			t.Errorf("y=%d: block %d, want %q", y, got, name)
+		}
+	}
+
+	// Column x=47, z=31: h = int(4*(sin(4.7)+cos(3.1))) = -7, under water
+	w = world.New()
+	for cy := -1; cy <= 0; cy++ {
+		w.SetChunk(g.GenerateChunk(0, world.ChunkPos{X: 2, Y: cy, Z: 1}))
+	}
+	if got := w.GetBlock(world.BlockPos{X: 47, Y: -1, Z: 31}); got != reg.ID("water") {
+		t.Errorf("expected water at the surface of a deep column, got %d", got)
+	}
+	if got := w.GetBlock(world.BlockPos{X: 47, Y: -6, Z: 31}); got != reg.ID("water") {
+		t.Errorf("expected water down to the column height, got %d", got)
+	}
+	if got := w.GetBlock(world.BlockPos{X: 47, Y: -7, Z: 31}); got != world.Air {
+		t.Errorf("expected no ground below the bottom, got %d", got)
+	}
+	if got := w.GetBlock(world.BlockPos{X: 47, Y: 0, Z: 31}); got != world.Air {
+		t.Errorf("expected air above the water level, got %d", got)
+	}
+}
+
+func TestTerrainLayers(t *testing.T) {
+	reg := testRegistry(t)
+	g, err := New("noise", reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const seed = 99
+	hm := NewHeightMap(seed)
+
+	w := world.New()
+	for cy := MinChunkY; cy <= MaxChunkY; cy++ {
+		w.SetChunk(g.GenerateChunk(seed, world.ChunkPos{X: 0, Y: cy, Z: 0}))
+	}
+
+	for x := 0; x < world.ChunkSize; x++ {
+		for z := 0; z < world.ChunkSize; z++ {
+			sample := hm.Sample(x, z)
+			h := sample.Height
+			surface := w.GetBlock(world.BlockPos{X: x, Y: h, Z: z})
+			want := reg.ID(sample.Biome.Surface)
+			if h <= WaterLevel+1 {
+				want = reg.ID("sand")
+			}
+			if surface != want {
+				t.Fatalf("surface at %d,%d (h=%d) = %d, want %d", x, z, h, surface, want)
+			}
+			above := w.GetBlock(world.BlockPos{X: x, Y: h + 1, Z: z})
+			if h < WaterLevel && above != reg.ID("water") {
+				t.Fatalf("expected water above %d,%d (h=%d)", x, z, h)
+			}
+			if h >= WaterLevel && above != world.Air {
+				t.Fatalf("expected air above %d,%d (h=%d)", x, z, h)
+			}
+			if got := w.GetBlock(world.BlockPos{X: x, Y: bottomY, Z: z}); got != reg.ID("rock") {
+				t.Fatalf("expected rock at the bottom of %d,%d, got %d", x, z, got)
+			}
+		}
+	}
+}
+
+func TestHeightMapVariety(t *testing.T) {
+	hm := NewHeightMap(1)
+	lo, hi := 1000, -1000
+	for x := -1024; x < 1024; x += 8 {
+		for z := -1024; z < 1024; z += 8 {
+			h := hm.Height(x, z)
+			lo, hi = min(lo, h), max(hi, h)
+		}
+	}
+	if lo >= WaterLevel {
+		t.Errorf("no valleys under water: lowest %d", lo)
+	}
+	if hi < 20 {
+		t.Errorf("no hills or mountains: highest %d", hi)
+	}
+	if hi >= (MaxChunkY+1)*world.ChunkSize {
+		t.Errorf("terrain reaches %d, above the top of the world", hi)
+	}
+	t.Logf("heights %d..%d", lo, hi)
+}